@@ -76,8 +76,8 @@ type MQErrorLog struct {
 	Delay    int64       `json:"delay" bson:"delay"`
 	Retries  int64       `json:"retries" bson:"retries"`
 	Error    string      `json:"error" bson:"error"`
-	Ctime    int64       `json:"ctime" bson:"ctime"`
-	Utime    int64       `json:"utime" bson:"utime"`
+	Ctime    int64       `json:"ctime" bson:"ctime" autoCreateTime:"true"`
+	Utime    int64       `json:"utime" bson:"utime" autoUpdateTime:"true"`
 	State    int64       `json:"state" bson:"state"`
 }
 
@@ -238,7 +238,7 @@ func (self *AmqpManager) Pull(data LisData, callback func(msg MsgData) (MsgData,
 			log.Println(util.AddStr("exchange[", call.Exchange, "] - queue[", call.Queue, "] 监听处理异常: ", err.Error()))
 			if data.SendMgo {
 				uuid, _ := util.StrToInt64(util.GetUUID())
-				errlog := MQErrorLog{Id: uuid, Exchange: call.Exchange, Queue: call.Queue, Type: call.Type, Retries: call.Retries, Delay: call.Delay, Content: call.Content, Error: err.Error(), Ctime: util.Time(), Utime: util.Time(), State: 1}
+				errlog := MQErrorLog{Id: uuid, Exchange: call.Exchange, Queue: call.Queue, Type: call.Type, Retries: call.Retries, Delay: call.Delay, Content: call.Content, Error: err.Error(), State: 1}
 				if mongo, err := new(sqld.MGOManager).Get(); err != nil {
 					log.Println(err.Error())
 				} else {
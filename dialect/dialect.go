@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"errors"
 	"strconv"
+	"strings"
+	"sync"
 )
 
 /********************************** 分页方言实现 **********************************/
@@ -28,6 +30,56 @@ type IDialect interface {
 	GetLimitSql(sql string) (string, error)
 }
 
+// 分页方言构造函数
+type Creator func(pagination Dialect) IDialect
+
+var (
+	dialectMu sync.RWMutex
+	dialects  = map[string]Creator{
+		"mysql":     func(p Dialect) IDialect { return &MysqlDialect{p} },
+		"postgres":  func(p Dialect) IDialect { return &PostgreSQL{p} },
+		"sqlite3":   func(p Dialect) IDialect { return &SqliteDialect{p} },
+		"oracle":    func(p Dialect) IDialect { return &OracleDialect{p} },
+		"oracle12c": func(p Dialect) IDialect { return &Oracle12cDialect{p} },
+		"sqlserver": func(p Dialect) IDialect { return &SQLServer{p} },
+		"mssql2005": func(p Dialect) IDialect { return &SQLServer2005{p} },
+		"db2":       func(p Dialect) IDialect { return &DB2Dialect{p} },
+		"sybase":    func(p Dialect) IDialect { return &Sybase{p} },
+		"hsql":      func(p Dialect) IDialect { return &HSQLDialect{p} },
+		"derby":     func(p Dialect) IDialect { return &Derby{p} },
+	}
+)
+
+// 注册分页方言,driver为数据源驱动名称,重复注册时覆盖
+func RegDialect(driver string, creator Creator) error {
+	if len(driver) == 0 || creator == nil {
+		return errors.New("方言驱动名称和构造函数不能为空")
+	}
+	dialectMu.Lock()
+	dialects[driver] = creator
+	dialectMu.Unlock()
+	return nil
+}
+
+// 按数据源驱动名称创建分页方言,未注册时返回nil
+func NewDialect(driver string, pagination Dialect) IDialect {
+	dialectMu.RLock()
+	creator := dialects[driver]
+	dialectMu.RUnlock()
+	if creator == nil {
+		return nil
+	}
+	return creator(pagination)
+}
+
+// 分页起始下标和条数
+func (self *Dialect) bounds() (int64, int64) {
+	if self.IsOffset {
+		return self.PageNo, self.PageSize
+	}
+	return (self.PageNo - 1) * self.PageSize, self.PageSize
+}
+
 func (self *Dialect) Support() (bool, error) {
 	return false, errors.New("No implementation method [Support] was found")
 }
@@ -77,40 +129,120 @@ func (self *MysqlDialect) GetLimitSql(sql string) (string, error) {
 	return sqlbuf.String(), nil
 }
 
+/********************************** SQLite方言实现 **********************************/
+
+type SqliteDialect struct {
+	Dialect
+}
+
+func (self *SqliteDialect) Support() (bool, error) {
+	return true, nil
+}
+
+func (self *SqliteDialect) GetCountSql(sql string) (string, error) {
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString("select count(1) from (")
+	sqlbuf.WriteString(sql)
+	sqlbuf.WriteString(") as cba1")
+	return sqlbuf.String(), nil
+}
+
+func (self *SqliteDialect) GetLimitSql(sql string) (string, error) {
+	if b, _ := self.Support(); !b {
+		return "", errors.New("No implementation method [GetLimitSql] was support")
+	}
+	offset := strconv.FormatInt((self.PageNo-1)*self.PageSize, 10)
+	limit := strconv.FormatInt(self.PageSize, 10)
+	if self.IsOffset {
+		offset = strconv.FormatInt(self.PageNo, 10)
+		limit = strconv.FormatInt(self.PageSize, 10)
+	}
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString(sql)
+	sqlbuf.WriteString(" limit ")
+	sqlbuf.WriteString(limit)
+	sqlbuf.WriteString(" offset ")
+	sqlbuf.WriteString(offset)
+	return sqlbuf.String(), nil
+}
+
 /********************************** Oracle方言实现 **********************************/
 
+// Oracle方言,按ROWNUM分页,兼容12c以前版本
 type OracleDialect struct {
 	Dialect
 }
 
 func (self *OracleDialect) Support() (bool, error) {
-	return false, errors.New("No implementation method [Support] was found")
+	return true, nil
 }
 
 func (self *OracleDialect) GetCountSql(sql string) (string, error) {
-	return "", errors.New("No implementation method [GetCountSql] was found")
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString("select count(1) from (")
+	sqlbuf.WriteString(sql)
+	sqlbuf.WriteString(") cba1")
+	return sqlbuf.String(), nil
 }
 
 func (self *OracleDialect) GetLimitSql(sql string) (string, error) {
-	return "", errors.New("No implementation method [GetLimitSql] was found")
+	offset, limit := self.bounds()
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString("select * from (select cba2.*, rownum rownum_ from (")
+	sqlbuf.WriteString(sql)
+	sqlbuf.WriteString(") cba2 where rownum <= ")
+	sqlbuf.WriteString(strconv.FormatInt(offset+limit, 10))
+	sqlbuf.WriteString(") cba1 where rownum_ > ")
+	sqlbuf.WriteString(strconv.FormatInt(offset, 10))
+	return sqlbuf.String(), nil
+}
+
+/********************************** Oracle12c方言实现 **********************************/
+
+// Oracle 12c及以上版本,按OFFSET FETCH分页
+type Oracle12cDialect struct {
+	Dialect
+}
+
+func (self *Oracle12cDialect) Support() (bool, error) {
+	return true, nil
+}
+
+func (self *Oracle12cDialect) GetCountSql(sql string) (string, error) {
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString("select count(1) from (")
+	sqlbuf.WriteString(sql)
+	sqlbuf.WriteString(") cba1")
+	return sqlbuf.String(), nil
+}
+
+func (self *Oracle12cDialect) GetLimitSql(sql string) (string, error) {
+	offset, limit := self.bounds()
+	return offsetFetch(sql, offset, limit), nil
 }
 
 /********************************** DB2方言实现 **********************************/
 
+// DB2方言,首页使用FETCH FIRST,其余页使用OFFSET FETCH(11.1及以上版本)
 type DB2Dialect struct {
 	Dialect
 }
 
 func (self *DB2Dialect) Support() (bool, error) {
-	return false, errors.New("No implementation method [Support] was found")
+	return true, nil
 }
 
 func (self *DB2Dialect) GetCountSql(sql string) (string, error) {
-	return "", errors.New("No implementation method [GetCountSql] was found")
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString("select count(1) from (")
+	sqlbuf.WriteString(sql)
+	sqlbuf.WriteString(") as cba1")
+	return sqlbuf.String(), nil
 }
 
 func (self *DB2Dialect) GetLimitSql(sql string) (string, error) {
-	return "", errors.New("No implementation method [GetLimitSql] was found")
+	offset, limit := self.bounds()
+	return fetchFirst(sql, offset, limit), nil
 }
 
 /********************************** HSQL方言实现 **********************************/
@@ -120,69 +252,142 @@ type HSQLDialect struct {
 }
 
 func (self *HSQLDialect) Support() (bool, error) {
-	return false, errors.New("No implementation method [Support] was found")
+	return true, nil
 }
 
 func (self *HSQLDialect) GetCountSql(sql string) (string, error) {
-	return "", errors.New("No implementation method [GetCountSql] was found")
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString("select count(1) from (")
+	sqlbuf.WriteString(sql)
+	sqlbuf.WriteString(") as cba1")
+	return sqlbuf.String(), nil
 }
 
 func (self *HSQLDialect) GetLimitSql(sql string) (string, error) {
-	return "", errors.New("No implementation method [GetLimitSql] was found")
+	offset, limit := self.bounds()
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString(sql)
+	sqlbuf.WriteString(" limit ")
+	sqlbuf.WriteString(strconv.FormatInt(limit, 10))
+	sqlbuf.WriteString(" offset ")
+	sqlbuf.WriteString(strconv.FormatInt(offset, 10))
+	return sqlbuf.String(), nil
 }
 
 /********************************** SQLServer方言实现 **********************************/
 
+// SQL Server 2012及以上版本,按OFFSET FETCH分页,无排序时按(select null)排序
 type SQLServer struct {
 	Dialect
 }
 
 func (self *SQLServer) Support() (bool, error) {
-	return false, errors.New("No implementation method [Support] was found")
+	return true, nil
 }
 
 func (self *SQLServer) GetCountSql(sql string) (string, error) {
-	return "", errors.New("No implementation method [GetCountSql] was found")
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString("select count(1) from (")
+	sqlbuf.WriteString(trimOrderBy(sql))
+	sqlbuf.WriteString(") as cba1")
+	return sqlbuf.String(), nil
 }
 
 func (self *SQLServer) GetLimitSql(sql string) (string, error) {
-	return "", errors.New("No implementation method [GetLimitSql] was found")
+	offset, limit := self.bounds()
+	if lastOrderBy(sql) < 0 {
+		sql = sql + " order by (select null)"
+	}
+	return offsetFetch(sql, offset, limit), nil
 }
 
 /********************************** SQLServer2005方言实现 **********************************/
 
+// SQL Server 2005/2008,按ROW_NUMBER()分页,原语句排序条件移入over子句
 type SQLServer2005 struct {
 	Dialect
 }
 
 func (self *SQLServer2005) Support() (bool, error) {
-	return false, errors.New("No implementation method [Support] was found")
+	return true, nil
 }
 
 func (self *SQLServer2005) GetCountSql(sql string) (string, error) {
-	return "", errors.New("No implementation method [GetCountSql] was found")
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString("select count(1) from (")
+	sqlbuf.WriteString(trimOrderBy(sql))
+	sqlbuf.WriteString(") as cba1")
+	return sqlbuf.String(), nil
 }
 
 func (self *SQLServer2005) GetLimitSql(sql string) (string, error) {
-	return "", errors.New("No implementation method [GetLimitSql] was found")
+	offset, limit := self.bounds()
+	orderby := "order by (select null)"
+	if i := lastOrderBy(sql); i >= 0 {
+		orderby = strings.TrimSpace(sql[i:])
+		sql = strings.TrimSpace(sql[:i])
+	}
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString("select * from (")
+	// distinct语句需先去重再编号,其余语句直接在查询列前追加行号以保留表别名
+	if rest, ok := trimSelect(sql); ok && !hasPrefixFold(rest, "distinct ") {
+		sqlbuf.WriteString("select row_number() over (")
+		sqlbuf.WriteString(orderby)
+		sqlbuf.WriteString(") as rownum_, ")
+		sqlbuf.WriteString(rest)
+	} else {
+		sqlbuf.WriteString("select row_number() over (")
+		sqlbuf.WriteString(orderby)
+		sqlbuf.WriteString(") as rownum_, cba2.* from (")
+		sqlbuf.WriteString(sql)
+		sqlbuf.WriteString(") as cba2")
+	}
+	sqlbuf.WriteString(") as cba1 where rownum_ > ")
+	sqlbuf.WriteString(strconv.FormatInt(offset, 10))
+	sqlbuf.WriteString(" and rownum_ <= ")
+	sqlbuf.WriteString(strconv.FormatInt(offset+limit, 10))
+	sqlbuf.WriteString(" order by rownum_")
+	return sqlbuf.String(), nil
 }
 
 /********************************** Sybase方言实现 **********************************/
 
+// Sybase SQL Anywhere,按TOP START AT分页
 type Sybase struct {
 	Dialect
 }
 
 func (self *Sybase) Support() (bool, error) {
-	return false, errors.New("No implementation method [Support] was found")
+	return true, nil
 }
 
 func (self *Sybase) GetCountSql(sql string) (string, error) {
-	return "", errors.New("No implementation method [GetCountSql] was found")
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString("select count(1) from (")
+	sqlbuf.WriteString(trimOrderBy(sql))
+	sqlbuf.WriteString(") as cba1")
+	return sqlbuf.String(), nil
 }
 
 func (self *Sybase) GetLimitSql(sql string) (string, error) {
-	return "", errors.New("No implementation method [GetLimitSql] was found")
+	offset, limit := self.bounds()
+	rest, ok := trimSelect(sql)
+	if !ok {
+		return "", errors.New("Sybase分页语句必须以select开头")
+	}
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString("select ")
+	if hasPrefixFold(rest, "distinct ") {
+		sqlbuf.WriteString("distinct ")
+		rest = strings.TrimSpace(rest[len("distinct "):])
+	}
+	sqlbuf.WriteString("top ")
+	sqlbuf.WriteString(strconv.FormatInt(limit, 10))
+	sqlbuf.WriteString(" start at ")
+	sqlbuf.WriteString(strconv.FormatInt(offset+1, 10))
+	sqlbuf.WriteString(" ")
+	sqlbuf.WriteString(rest)
+	return sqlbuf.String(), nil
 }
 
 /********************************** PostgreSQL方言实现 **********************************/
@@ -192,31 +397,146 @@ type PostgreSQL struct {
 }
 
 func (self *PostgreSQL) Support() (bool, error) {
-	return false, errors.New("No implementation method [Support] was found")
+	return true, nil
 }
 
 func (self *PostgreSQL) GetCountSql(sql string) (string, error) {
-	return "", errors.New("No implementation method [GetCountSql] was found")
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString("select count(1) from (")
+	sqlbuf.WriteString(sql)
+	sqlbuf.WriteString(") as cba1")
+	return sqlbuf.String(), nil
 }
 
 func (self *PostgreSQL) GetLimitSql(sql string) (string, error) {
-	return "", errors.New("No implementation method [GetLimitSql] was found")
+	if b, _ := self.Support(); !b {
+		return "", errors.New("No implementation method [GetLimitSql] was support")
+	}
+	offset := strconv.FormatInt((self.PageNo-1)*self.PageSize, 10)
+	limit := strconv.FormatInt(self.PageSize, 10)
+	if self.IsOffset {
+		offset = strconv.FormatInt(self.PageNo, 10)
+		limit = strconv.FormatInt(self.PageSize, 10)
+	}
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString(sql)
+	sqlbuf.WriteString(" limit ")
+	sqlbuf.WriteString(limit)
+	sqlbuf.WriteString(" offset ")
+	sqlbuf.WriteString(offset)
+	return sqlbuf.String(), nil
 }
 
 /********************************** Derby方言实现 **********************************/
 
+// Derby 10.5及以上版本,按OFFSET FETCH分页
 type Derby struct {
 	Dialect
 }
 
 func (self *Derby) Support() (bool, error) {
-	return false, errors.New("No implementation method [Support] was found")
+	return true, nil
 }
 
 func (self *Derby) GetCountSql(sql string) (string, error) {
-	return "", errors.New("No implementation method [GetCountSql] was found")
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString("select count(1) from (")
+	sqlbuf.WriteString(sql)
+	sqlbuf.WriteString(") as cba1")
+	return sqlbuf.String(), nil
 }
 
 func (self *Derby) GetLimitSql(sql string) (string, error) {
-	return "", errors.New("No implementation method [GetLimitSql] was found")
+	offset, limit := self.bounds()
+	return fetchFirst(sql, offset, limit), nil
+}
+
+/********************************** 方言语句工具 **********************************/
+
+// 追加offset N rows fetch next M rows only
+func offsetFetch(sql string, offset, limit int64) string {
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString(sql)
+	sqlbuf.WriteString(" offset ")
+	sqlbuf.WriteString(strconv.FormatInt(offset, 10))
+	sqlbuf.WriteString(" rows fetch next ")
+	sqlbuf.WriteString(strconv.FormatInt(limit, 10))
+	sqlbuf.WriteString(" rows only")
+	return sqlbuf.String()
+}
+
+// 首页追加fetch first M rows only,其余页追加offset fetch
+func fetchFirst(sql string, offset, limit int64) string {
+	if offset > 0 {
+		return offsetFetch(sql, offset, limit)
+	}
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString(sql)
+	sqlbuf.WriteString(" fetch first ")
+	sqlbuf.WriteString(strconv.FormatInt(limit, 10))
+	sqlbuf.WriteString(" rows only")
+	return sqlbuf.String()
+}
+
+// 去除语句开头的select关键字
+func trimSelect(sql string) (string, bool) {
+	sql = strings.TrimSpace(sql)
+	if !hasPrefixFold(sql, "select ") {
+		return sql, false
+	}
+	return strings.TrimSpace(sql[len("select "):]), true
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// 去除最外层的order by子句
+func trimOrderBy(sql string) string {
+	if i := lastOrderBy(sql); i >= 0 {
+		return strings.TrimSpace(sql[:i])
+	}
+	return sql
+}
+
+// 查找最外层order by子句位置,忽略括号及引号内容,不存在时返回-1
+func lastOrderBy(sql string) int {
+	lower := strings.ToLower(sql)
+	index, depth := -1, 0
+	var quote byte
+	for i := 0; i < len(lower); i++ {
+		c := lower[i]
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"', '[':
+			if c == '[' {
+				c = ']'
+			}
+			quote = c
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case 'o':
+			if depth == 0 && i > 0 && isBlank(lower[i-1]) && strings.HasPrefix(lower[i:], "order") {
+				j := i + len("order")
+				for j < len(lower) && isBlank(lower[j]) {
+					j++
+				}
+				if j > i+len("order") && strings.HasPrefix(lower[j:], "by") && (j+2 == len(lower) || isBlank(lower[j+2])) {
+					index = i
+				}
+			}
+		}
+	}
+	return index
+}
+
+func isBlank(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
 }
@@ -0,0 +1,80 @@
+package dialect
+
+import (
+	"testing"
+)
+
+func TestDialectLimitSql(t *testing.T) {
+	page := Dialect{PageNo: 3, PageSize: 10}
+	sql := "select a.id, a.name from user a where a.state = ? order by a.id desc"
+	golden := map[string]string{
+		"mysql":     sql + " limit 20,10",
+		"postgres":  sql + " limit 10 offset 20",
+		"sqlite3":   sql + " limit 10 offset 20",
+		"hsql":      sql + " limit 10 offset 20",
+		"oracle":    "select * from (select cba2.*, rownum rownum_ from (" + sql + ") cba2 where rownum <= 30) cba1 where rownum_ > 20",
+		"oracle12c": sql + " offset 20 rows fetch next 10 rows only",
+		"sqlserver": sql + " offset 20 rows fetch next 10 rows only",
+		"mssql2005": "select * from (select row_number() over (order by a.id desc) as rownum_, a.id, a.name from user a where a.state = ?) as cba1 where rownum_ > 20 and rownum_ <= 30 order by rownum_",
+		"db2":       sql + " offset 20 rows fetch next 10 rows only",
+		"derby":     sql + " offset 20 rows fetch next 10 rows only",
+		"sybase":    "select top 10 start at 21 a.id, a.name from user a where a.state = ? order by a.id desc",
+	}
+	for driver, expected := range golden {
+		d := NewDialect(driver, page)
+		if d == nil {
+			t.Errorf("dialect [%s] not registered", driver)
+			continue
+		}
+		if b, err := d.Support(); !b || err != nil {
+			t.Errorf("dialect [%s] should be supported: %v", driver, err)
+		}
+		if limitSql, err := d.GetLimitSql(sql); err != nil || limitSql != expected {
+			t.Errorf("unexpected [%s] limit sql: %s %v", driver, limitSql, err)
+		}
+	}
+}
+
+func TestDialectEdgeCases(t *testing.T) {
+	first := Dialect{PageNo: 1, PageSize: 5}
+	if s, _ := NewDialect("db2", first).GetLimitSql("select id from t"); s != "select id from t fetch first 5 rows only" {
+		t.Errorf("unexpected db2 first page sql: %s", s)
+	}
+	if s, _ := NewDialect("sqlserver", first).GetLimitSql("select id from t"); s != "select id from t order by (select null) offset 0 rows fetch next 5 rows only" {
+		t.Errorf("unexpected sqlserver unordered sql: %s", s)
+	}
+	offset := Dialect{PageNo: 7, PageSize: 5, IsOffset: true}
+	if s, _ := NewDialect("oracle", offset).GetLimitSql("select id from t"); s != "select * from (select cba2.*, rownum rownum_ from (select id from t) cba2 where rownum <= 12) cba1 where rownum_ > 7" {
+		t.Errorf("unexpected oracle offset sql: %s", s)
+	}
+	distinct := "select distinct name from t where remark = 'order by' order by name"
+	if s, _ := NewDialect("mssql2005", first).GetLimitSql(distinct); s != "select * from (select row_number() over (order by name) as rownum_, cba2.* from (select distinct name from t where remark = 'order by') as cba2) as cba1 where rownum_ > 0 and rownum_ <= 5 order by rownum_" {
+		t.Errorf("unexpected mssql2005 distinct sql: %s", s)
+	}
+	if s, _ := NewDialect("sybase", first).GetLimitSql(distinct); s != "select distinct top 5 start at 1 name from t where remark = 'order by' order by name" {
+		t.Errorf("unexpected sybase distinct sql: %s", s)
+	}
+	counts := map[string]string{
+		"sqlserver": "select count(1) from (select id from t where id in (select id from s order by id)) as cba1",
+		"oracle":    "select count(1) from (select id from t where id in (select id from s order by id) order by id) cba1",
+	}
+	for driver, expected := range counts {
+		if s, _ := NewDialect(driver, first).GetCountSql("select id from t where id in (select id from s order by id) order by id"); s != expected {
+			t.Errorf("unexpected [%s] count sql: %s", driver, s)
+		}
+	}
+	defer func() {
+		dialectMu.Lock()
+		delete(dialects, "unknown")
+		dialectMu.Unlock()
+	}()
+	if NewDialect("unknown", first) != nil {
+		t.Error("unknown driver should not resolve dialect")
+	}
+	if err := RegDialect("unknown", func(p Dialect) IDialect { return &HSQLDialect{p} }); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := NewDialect("unknown", first).(*HSQLDialect); !ok {
+		t.Error("registered dialect not resolved")
+	}
+}
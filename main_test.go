@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/godaddy-x/jorm/amqp"
 	c2 "github.com/godaddy-x/jorm/cache/mc"
 	"github.com/godaddy-x/jorm/concurrent"
+	"github.com/godaddy-x/jorm/dialect"
 	"github.com/godaddy-x/jorm/exception"
 	"github.com/godaddy-x/jorm/gauth"
 	"github.com/godaddy-x/jorm/jwt"
@@ -39,8 +41,8 @@ type OwWallet struct {
 	Applytime    int64  `json:"applytime" bson:"applytime"`
 	Succtime     int64  `json:"succtime" bson:"succtime"`
 	Dealstate    int64  `json:"dealstate" bson:"dealstate"`
-	Ctime        int64  `json:"ctime" bson:"ctime"`
-	Utime        int64  `json:"utime" bson:"utime"`
+	Ctime        int64  `json:"ctime" bson:"ctime" autoCreateTime:"true"`
+	Utime        int64  `json:"utime" bson:"utime" autoUpdateTime:"true"`
 	State        int64  `json:"state" bson:"state"`
 }
 
@@ -108,6 +110,219 @@ func TestMysql(t *testing.T) {
 	}
 }
 
+func TestMysqlDelete(t *testing.T) {
+	db, err := new(sqld.MysqlManager).Get(sqld.Option{AutoTx: true, DsName: "TEST", CacheSync: true})
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	wallet := OwWallet{WalletID: util.GetUUID(), Ctime: util.Time()}
+	wallet1 := OwWallet{WalletID: util.GetUUID(), Ctime: util.Time()}
+	wallet2 := OwWallet{WalletID: util.GetUUID(), Ctime: util.Time()}
+	if err := db.Save(&wallet, &wallet1, &wallet2); err != nil {
+		panic(err)
+	}
+	if err := db.Delete(&wallet); err != nil {
+		panic(err)
+	}
+	if err := db.DeleteByIDs(&OwWallet{}, wallet1.Id); err != nil {
+		panic(err)
+	}
+	if err := db.DeleteByCnd(sqlc.M(OwWallet{}).Eq("walletID", wallet2.WalletID)); err != nil {
+		panic(err)
+	}
+}
+
+func TestMysqlContext(t *testing.T) {
+	db, err := new(sqld.MysqlManager).Get(sqld.Option{DsName: "TEST"})
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	time.Sleep(5 * time.Millisecond)
+	find := []*OwWallet{}
+	if err := db.WithContext(ctx).FindList(sqlc.M(OwWallet{}).Limit(1, 10), &find); err != sqld.ErrTimeout {
+		t.Errorf("expected timeout error, got: %v", err)
+	}
+}
+
+func TestMysqlWithTx(t *testing.T) {
+	wallet := OwWallet{WalletID: util.GetUUID(), Ctime: util.Time()}
+	wallet1 := OwWallet{WalletID: util.GetUUID(), Ctime: util.Time()}
+	err := sqld.WithTx(sqld.Option{DsName: "TEST"}, func(db *sqld.RDBManager) error {
+		if err := db.Save(&wallet); err != nil {
+			return err
+		}
+		// 嵌套事务以保存点执行,回滚不影响外层事务
+		db.WithTx(func(db *sqld.RDBManager) error {
+			if err := db.Save(&wallet1); err != nil {
+				return err
+			}
+			return errors.New("rollback to savepoint")
+		})
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	db, err := new(sqld.MysqlManager).Get(sqld.Option{DsName: "TEST"})
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	if c, err := db.Count(sqlc.M(OwWallet{}).In("walletID", wallet.WalletID, wallet1.WalletID)); err != nil {
+		panic(err)
+	} else if c != 1 {
+		t.Errorf("expected 1 row, got: %d", c)
+	}
+}
+
+func TestMysqlBatchSave(t *testing.T) {
+	db, err := new(sqld.MysqlManager).Get(sqld.Option{AutoTx: true, BatchSave: true, DsName: "TEST"})
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	datas := make([]interface{}, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		datas = append(datas, &OwWallet{WalletID: util.GetUUID(), Ctime: util.Time()})
+	}
+	if err := db.Save(datas...); err != nil {
+		panic(err)
+	}
+	if datas[0].(*OwWallet).Id+999 != datas[999].(*OwWallet).Id {
+		t.Error("batch save ids are not filled in order")
+	}
+}
+
+func TestMysqlUpsert(t *testing.T) {
+	db, err := new(sqld.MysqlManager).Get(sqld.Option{AutoTx: true, DsName: "TEST", CacheSync: true})
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	wallet := OwWallet{WalletID: util.GetUUID(), Alias: "alias", Ctime: util.Time()}
+	if err := db.Upsert(&wallet); err != nil {
+		panic(err)
+	}
+	wallet.Alias = "alias1"
+	db.UpsertFields = []string{"alias"}
+	if err := db.Upsert(&wallet); err != nil {
+		panic(err)
+	}
+	if err := db.UpsertByCnd(sqlc.M(OwWallet{}).Eq("walletID", wallet.WalletID).UpdateKeyValue([]string{"alias"}, "alias2")); err != nil {
+		panic(err)
+	}
+}
+
+type OwBalance struct {
+	Id      int64  `json:"id" bson:"_id" tb:"ow_balance"`
+	Address string `json:"address" bson:"address"`
+	Balance string `json:"balance" bson:"balance"`
+	Version int64  `json:"version" bson:"version" version:"true"`
+}
+
+func TestMysqlAutoTime(t *testing.T) {
+	db, err := new(sqld.MysqlManager).Get(sqld.Option{DsName: "TEST"})
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	wallet := OwWallet{WalletID: util.GetUUID()}
+	if err := db.Save(&wallet); err != nil {
+		panic(err)
+	}
+	if wallet.Ctime == 0 || wallet.Utime == 0 {
+		t.Errorf("expected ctime/utime to be set on save, got: %d/%d", wallet.Ctime, wallet.Utime)
+	}
+	ctime := wallet.Ctime
+	if err := db.Update(&wallet); err != nil {
+		panic(err)
+	}
+	if wallet.Ctime != ctime || wallet.Utime < ctime {
+		t.Errorf("expected only utime to change on update, got: %d/%d", wallet.Ctime, wallet.Utime)
+	}
+	if err := db.UpdateByCnd(sqlc.M(&OwWallet{}).Eq("id", wallet.Id).UpdateKeyValue([]string{"alias"}, "auto")); err != nil {
+		panic(err)
+	}
+}
+
+func TestMysqlReplica(t *testing.T) {
+	db, err := new(sqld.MysqlManager).Get(sqld.Option{DsName: "TEST", ForceMaster: true})
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	wallet := OwWallet{WalletID: util.GetUUID()}
+	if err := db.Save(&wallet); err != nil {
+		panic(err)
+	}
+	result := OwWallet{}
+	if err := db.FindOne(sqlc.M(&OwWallet{}).Eq("id", wallet.Id), &result); err != nil {
+		panic(err)
+	}
+	if result.Id != wallet.Id {
+		t.Errorf("expected read-after-write from master, got: %d", result.Id)
+	}
+}
+
+func TestMysqlVersion(t *testing.T) {
+	db, err := new(sqld.MysqlManager).Get(sqld.Option{DsName: "TEST"})
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	balance := OwBalance{Address: util.GetUUID(), Balance: "0"}
+	if err := db.Save(&balance); err != nil {
+		panic(err)
+	}
+	stale := balance
+	balance.Balance = "1"
+	if err := db.Update(&balance); err != nil {
+		panic(err)
+	}
+	stale.Balance = "2"
+	if err := db.Update(&stale); err != sqld.ErrStaleObject {
+		t.Errorf("expected stale object error, got: %v", err)
+	}
+}
+
+type OwAddress struct {
+	Id        int64  `json:"id" bson:"_id" tb:"ow_address"`
+	Address   string `json:"address" bson:"address"`
+	DeletedAt int64  `json:"deletedAt" bson:"deletedAt" softdelete:"true"`
+}
+
+func TestMysqlSoftDelete(t *testing.T) {
+	db, err := new(sqld.MysqlManager).Get(sqld.Option{DsName: "TEST"})
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	address := OwAddress{Address: util.GetUUID()}
+	if err := db.Save(&address); err != nil {
+		panic(err)
+	}
+	if err := db.Delete(&address); err != nil {
+		panic(err)
+	}
+	if c, err := db.Count(sqlc.M(&OwAddress{}).Eq("address", address.Address)); err != nil {
+		panic(err)
+	} else if c != 0 {
+		t.Errorf("expected soft deleted row to be hidden, got: %d", c)
+	}
+	if c, err := db.Count(sqlc.M(&OwAddress{}).Eq("address", address.Address).Unscoped()); err != nil {
+		panic(err)
+	} else if c != 1 {
+		t.Errorf("expected unscoped count 1, got: %d", c)
+	}
+	if err := db.ForceDelete(&address); err != nil {
+		panic(err)
+	}
+}
+
 func TestMongo(t *testing.T) {
 	db, err := new(sqld.MGOManager).Get(sqld.Option{DsName: "TEST"})
 	if err != nil {
@@ -306,3 +521,96 @@ func TestMapperList(t *testing.T) {
 	}
 	fmt.Println(util.ObjectToJson(result))
 }
+
+func TestFindBySQL(t *testing.T) {
+	db, err := new(sqld.MysqlManager).Get(sqld.Option{DsName: "TEST"})
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	page := &dialect.Dialect{PageNo: 1, PageSize: 2}
+	result := []*OwWallet{}
+	if err := db.FindBySQL("select * from ow_wallet where appID = :appID and id in (:ids)", map[string]interface{}{"appID": "", "ids": []int64{1, 2}}, &result, page); err != nil {
+		panic(err)
+	}
+	fmt.Println(page.PageTotal)
+	fmt.Println(util.ObjectToJson(result))
+	var total int64
+	if err := db.FindBySQL("select count(1) from ow_wallet where id > ?", []interface{}{0}, &total); err != nil {
+		panic(err)
+	}
+	if _, err := db.ExecSQL("update ow_wallet set alias = :alias where walletID = :walletID", &OwWallet{Alias: "raw", WalletID: util.GetUUID()}); err != nil {
+		panic(err)
+	}
+}
+
+func TestFindEach(t *testing.T) {
+	db, err := new(sqld.MGOManager).Get(sqld.Option{DsName: "TEST"})
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	defer db.Close()
+	count := 0
+	if err := db.FindEach(sqlc.M(&User{}).Orderby("_id", sqlc.ASC_), &User{}, func(row interface{}) error {
+		fmt.Println(row.(*User).Id)
+		if count++; count >= 100 {
+			return sqld.ErrStopEach
+		}
+		return nil
+	}); err != nil {
+		panic(err)
+	}
+}
+
+func TestAutoMigrate(t *testing.T) {
+	db, err := new(sqld.MysqlManager).Get(sqld.Option{DsName: "TEST"})
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	if err := db.AutoMigrate(&OwWallet{}, &OwBalance{}); err != nil {
+		panic(err)
+	}
+	if err := sqld.RegMigration("TEST", sqld.Migration{
+		Version: 2019101601,
+		Name:    "create ow_audit",
+		Up:      "create table ow_audit (id bigint not null primary key, content varchar(255) null)",
+		Down:    "drop table ow_audit",
+	}); err != nil {
+		panic(err)
+	}
+	if err := db.Migrate(); err != nil {
+		panic(err)
+	}
+	if err := db.MigrateDown(1); err != nil {
+		panic(err)
+	}
+}
+
+func TestPostgres(t *testing.T) {
+	conf := sqld.PostgresConfig{}
+	if err := util.ReadLocalJsonConfig("resource/postgres.json", &conf); err != nil {
+		panic(util.AddStr("读取postgres配置失败: ", err.Error()))
+	}
+	new(sqld.PostgresManager).InitConfig(conf)
+	db, err := new(sqld.PostgresManager).Get(sqld.Option{DsName: "PG", AutoID: true})
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	if err := db.AutoMigrate(&OwWallet{}); err != nil {
+		panic(err)
+	}
+	wallet := OwWallet{AppID: "pg", WalletID: util.GetUUID()}
+	if err := db.Save(&wallet); err != nil {
+		panic(err)
+	}
+	result := []*OwWallet{}
+	cnd := sqlc.M(&OwWallet{}).Eq("appID", "pg").Like("walletID", wallet.WalletID[0:8]).Limit(1, 10)
+	if err := db.FindList(cnd, &result); err != nil {
+		panic(err)
+	}
+	fmt.Println(cnd.Pagination.PageTotal)
+	fmt.Println(util.ObjectToJson(result))
+}
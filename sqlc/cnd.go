@@ -1,7 +1,13 @@
 package sqlc
 
 import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"github.com/godaddy-x/jorm/dialect"
+	"strings"
 )
 
 /**
@@ -40,16 +46,52 @@ const (
 )
 
 var (
-	Id     = "Id"
-	Ignore = "ignore"
-	Bson   = "bson"
-	Json   = "json"
-	Mg     = "mg"
-	True   = "true"
-	BsonId = "id"
-	Date   = "date"
+	Id             = "Id"
+	Ignore         = "ignore"
+	Bson           = "bson"
+	Json           = "json"
+	Mg             = "mg"
+	True           = "true"
+	BsonId         = "id"
+	Date           = "date"
+	Version        = "version"
+	SoftDelete     = "softdelete"
+	AutoCreateTime = "autoCreateTime"
+	AutoUpdateTime = "autoUpdateTime"
+	Shard          = "shard"
+	DBType         = "dbtype"
+	Size           = "size"
+	Index          = "index"
+	Unique         = "unique"
+	Rel            = "rel"
+	Fk             = "fk"
+	Ref            = "ref"
 )
 
+// 原生SQL片段标记,包含进程随机串,外部输入无法伪造
+var rawMark = newRawMark()
+
+func newRawMark() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic("原生SQL标记初始化失败: " + err.Error())
+	}
+	return "\x00raw:" + hex.EncodeToString(b) + ":"
+}
+
+// 原生SQL片段,用于字段,条件,排序,分组及连接表等需要表达式的场景,跳过标识符校验和引号处理,禁止拼接外部输入
+func Raw(sql string) string {
+	return rawMark + sql
+}
+
+// 是否原生SQL片段,返回去除标记后的SQL
+func IsRaw(s string) (string, bool) {
+	if strings.HasPrefix(s, rawMark) {
+		return s[len(rawMark):], true
+	}
+	return s, false
+}
+
 // 数据库操作逻辑条件对象
 type Condition struct {
 	Logic  int
@@ -88,6 +130,22 @@ type Cnd struct {
 	JoinCond    []JoinCond
 	CacheConfig CacheConfig
 	Aggregates  []Condition
+	IsUnscoped  bool
+	Keyset      Keyset
+	Preloads    []string
+}
+
+// 游标分页令牌,由边界行排序字段值编码,调用方无需解析
+type Token string
+
+// 游标(keyset)分页参数,按Orderbys字段定位边界行,不统计总条数
+type Keyset struct {
+	Open   bool          // 是否游标分页
+	Before bool          // true.查询边界行之前数据 false.查询边界行之后数据
+	Keys   []interface{} // 边界行排序字段值,与Orderbys顺序一致,为空时查询首页
+	Token  Token         // 边界行令牌,Keys为空时使用
+	Next   Token         // 查询后回写,传入After获取下一页,无后续数据时为空
+	Prev   Token         // 查询后回写,传入Before获取上一页,无前序数据时为空
 }
 
 // 缓存结果集参数
@@ -254,6 +312,79 @@ func (self *Cnd) Offset(offset int64, limit int64) *Cnd {
 	return self
 }
 
+// 游标分页,查询边界行之后的数据,参数为上一页末行排序字段值或Next令牌,无参数时查询首页,每页条数由Limit指定
+func (self *Cnd) After(lastKey ...interface{}) *Cnd {
+	return self.seek(false, lastKey)
+}
+
+// 游标分页,查询边界行之前的数据,参数为当前页首行排序字段值或Prev令牌
+func (self *Cnd) Before(firstKey ...interface{}) *Cnd {
+	return self.seek(true, firstKey)
+}
+
+func (self *Cnd) seek(before bool, keys []interface{}) *Cnd {
+	self.Keyset = Keyset{Open: true, Before: before}
+	if len(keys) == 1 {
+		if token, ok := keys[0].(Token); ok {
+			self.Keyset.Token = token
+			return self
+		}
+	}
+	self.Keyset.Keys = keys
+	return self
+}
+
+// 获取边界行排序字段值,Keys为空时解析令牌
+func (self *Keyset) Values() ([]interface{}, error) {
+	if len(self.Keys) > 0 || len(self.Token) == 0 {
+		return self.Keys, nil
+	}
+	return self.Token.Decode()
+}
+
+// 按排序字段值生成游标分页令牌
+func NewToken(keys []interface{}) (Token, error) {
+	b, err := json.Marshal(keys)
+	if err != nil {
+		return "", err
+	}
+	return Token(base64.RawURLEncoding.EncodeToString(b)), nil
+}
+
+// 解析游标分页令牌,整数还原为int64,其余数值为float64
+func (self Token) Decode() ([]interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(string(self))
+	if err != nil {
+		return nil, errors.New("游标分页令牌无效")
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(b)))
+	decoder.UseNumber()
+	keys := make([]interface{}, 0)
+	if err := decoder.Decode(&keys); err != nil {
+		return nil, errors.New("游标分页令牌无效")
+	}
+	for i := range keys {
+		if n, ok := keys[i].(json.Number); ok {
+			if v, err := n.Int64(); err == nil {
+				keys[i] = v
+			} else if v, err := n.Float64(); err == nil {
+				keys[i] = v
+			}
+		}
+	}
+	return keys, nil
+}
+
+// 预加载关联字段,按结构体字段名称或json标签指定,多级关联使用"Roles.Permissions"
+func (self *Cnd) Preload(names ...string) *Cnd {
+	for e := range names {
+		if len(names[e]) > 0 {
+			self.Preloads = append(self.Preloads, names[e])
+		}
+	}
+	return self
+}
+
 // 筛选字段去重
 func (self *Cnd) Distinct(keys ...string) *Cnd {
 	for e := range keys {
@@ -305,6 +436,12 @@ func (self *Cnd) Cache(config CacheConfig) *Cnd {
 	return self
 }
 
+// 忽略逻辑删除条件,查询包含已删除数据,按条件删除时执行物理删除
+func (self *Cnd) Unscoped() *Cnd {
+	self.IsUnscoped = true
+	return self
+}
+
 // 指定更新字段
 func (self *Cnd) UpdateKeyValue(keys []string, values ...interface{}) *Cnd {
 	if len(keys) == 0 || len(keys) != len(values) {
@@ -0,0 +1,83 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/jorm/util"
+	"reflect"
+)
+
+/********************************** 自动时间字段实现 **********************************/
+
+// 获取自动时间字段,create为true时返回创建时间字段(autoCreateTime),否则返回更新时间字段(autoUpdateTime)
+// 仅支持int64和string类型字段
+func getAutoTimeFields(model interface{}, create bool) []*FieldMeta {
+	if model == nil {
+		return nil
+	}
+	meta, err := GetModelMeta(model)
+	if err != nil {
+		return nil
+	}
+	if create {
+		return meta.CreateTimes
+	}
+	return meta.UpdateTimes
+}
+
+// 自动时间字段取值,string类型为时间格式字符串,format为true时date:"true"字段同样格式化
+func autoTimeValue(field *FieldMeta, now int64, format bool) interface{} {
+	if field.Kind == reflect.String || format && field.IsDate {
+		return util.Time2Str(now)
+	}
+	return now
+}
+
+// 设置对象自动时间字段,新增时设置值为空的创建时间和更新时间字段,更新时设置更新时间字段
+// int64字段赋值为毫秒时间戳,配合date:"true"时由保存方法格式化
+func setAutoTime(data interface{}, create bool) {
+	vof := reflect.ValueOf(data)
+	if vof.Kind() != reflect.Ptr || vof.Elem().Kind() != reflect.Struct {
+		return
+	}
+	vof = vof.Elem()
+	now := util.Time()
+	fields := getAutoTimeFields(data, false)
+	if create {
+		fields = append(append([]*FieldMeta{}, getAutoTimeFields(data, true)...), fields...)
+	}
+	for e := range fields {
+		value := vof.FieldByIndex(fields[e].Index)
+		if !value.CanSet() {
+			continue
+		}
+		switch value.Kind() {
+		case reflect.Int64:
+			if !create || value.Int() <= 0 {
+				value.SetInt(now)
+			}
+		case reflect.String:
+			if !create || len(value.String()) == 0 {
+				value.SetString(util.Time2Str(now))
+			}
+		}
+	}
+}
+
+// 按条件更新时追加更新时间字段,已指定该字段时不覆盖,返回新的更新字段集合,不修改原条件对象
+func autoUpdateKV(model interface{}, updateKV map[string]interface{}, format bool) map[string]interface{} {
+	fields := getAutoTimeFields(model, false)
+	if len(fields) == 0 || len(updateKV) == 0 {
+		return updateKV
+	}
+	now := util.Time()
+	result := make(map[string]interface{}, len(updateKV)+len(fields))
+	for k, v := range updateKV {
+		result[k] = v
+	}
+	for e := range fields {
+		name := fields[e].Column
+		if _, b := result[name]; !b {
+			result[name] = autoTimeValue(fields[e], now, format)
+		}
+	}
+	return result
+}
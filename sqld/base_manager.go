@@ -2,8 +2,8 @@ package sqld
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
-	"fmt"
 	"github.com/godaddy-x/jorm/cache"
 	"github.com/godaddy-x/jorm/dialect"
 	"github.com/godaddy-x/jorm/log"
@@ -11,41 +11,62 @@ import (
 	"github.com/godaddy-x/jorm/util"
 	"go.uber.org/zap"
 	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	MYSQL    = "mysql"
+	POSTGRES = "postgres"
+	SQLITE   = "sqlite3"
+	MONGO    = "mongo"
 )
 
 var (
-	rdbs        = map[string]*RDBManager{}
-	sql_slowlog *zap.Logger
+	rdbs           = map[string]*RDBManager{}
+	sql_slowlog    *zap.Logger
+	ErrTimeout     = util.Error("数据库操作超时")
+	ErrCanceled    = util.Error("数据库操作已取消")
+	ErrStaleObject = util.Error("数据版本已过期,请重新查询后更新")
+	ErrStopEach    = util.Error("中止遍历")
 )
 
 /********************************** 数据库配置参数 **********************************/
 
 // 数据库配置
 type DBConfig struct {
-	Host        string // 地址IP
-	Port        int    // 数据库端口
-	Database    string // 数据库名称
-	Username    string // 账号
-	Password    string // 密码
-	Debug       bool   // debug模式
-	CacheSync   bool   // 是否缓存数据
-	DsName      string // 数据源名称
-	Node        int    // 节点
-	AutoID      bool   // 自主ID模式
-	SlowQuery   int64  // 0.不开启筛选 >0开启筛选查询 毫秒
-	SlowLogPath string // 慢查询写入地址
+	Host        string          // 地址IP
+	Port        int             // 数据库端口
+	Database    string          // 数据库名称
+	Username    string          // 账号
+	Password    string          // 密码
+	Debug       bool            // debug模式
+	CacheSync   bool            // 是否缓存数据
+	DsName      string          // 数据源名称
+	Node        int             // 节点
+	AutoID      bool            // 自主ID模式
+	SlowQuery   int64           // 0.不开启筛选 >0开启筛选查询 毫秒
+	SlowLogPath string          // 慢查询写入地址
+	Replicas    []ReplicaConfig // 从库列表,配置后查询操作路由至从库
+	Balance     string          // 从库负载策略 random.随机 roundRobin.轮询 weighted.权重,默认random
+	CheckPeriod int             // 从库健康检查间隔(秒),默认10秒
+	StmtCache   int             // 预编译语句缓存数量,0默认256,<0不缓存
 }
 
 // 数据选项
 type Option struct {
-	Node         int          // 节点
-	AutoID       bool         // 自主ID模式
-	AutoTx       bool         // 是否自动事务提交 false.否 true.是
-	DsName       string       // 数据源,分库时使用
-	CacheSync    bool         // 是否数据缓存,比如redis,mongo等
-	CacheManager cache.ICache // 缓存管理器
-	SlowQuery    int64        // 0.不开启筛选 >0开启筛选查询 毫秒
-	SlowLogPath  string       // 慢查询写入地址
+	Node         int             // 节点
+	AutoID       bool            // 自主ID模式
+	AutoTx       bool            // 是否自动事务提交 false.否 true.是
+	BatchSave    bool            // 是否批量保存(多行insert) false.否 true.是
+	UpsertFields []string        // Upsert冲突时更新的字段,为空时更新全部非ID字段
+	DsName       string          // 数据源,分库时使用
+	CacheSync    bool            // 是否数据缓存,比如redis,mongo等
+	CacheManager cache.ICache    // 缓存管理器
+	SlowQuery    int64           // 0.不开启筛选 >0开启筛选查询 毫秒
+	SlowLogPath  string          // 慢查询写入地址
+	Context      context.Context // 上下文,用于超时和取消控制
+	ForceMaster  bool            // 是否强制查询主库(写后读场景) false.否 true.是
 }
 
 // 数据库管理器
@@ -55,6 +76,10 @@ type DBManager struct {
 	CacheManager cache.ICache  // 缓存管理器
 	CacheObject  []interface{} // 需要缓存的数据 CacheSync为true时有效
 	CacheCnd     *sqlc.Cnd     // 需要缓存的条件对象 CacheSync为true时有效
+	CacheDelete  []interface{} // 需要同步删除的数据 CacheSync为true时有效
+	CacheDelCnd  []*sqlc.Cnd   // 需要同步删除的条件对象 CacheSync为true时有效
+	CacheUpsert  []interface{} // 需要同步新增或更新的数据 CacheSync为true时有效
+	CacheUpsCnd  []*sqlc.Cnd   // 需要同步新增或更新的条件对象 CacheSync为true时有效
 	Errors       []error       // 错误异常记录
 }
 
@@ -72,10 +97,18 @@ type IDBase interface {
 	Update(datas ...interface{}) error
 	// 按条件更新数据
 	UpdateByCnd(cnd *sqlc.Cnd) error
+	// 新增或更新数据(主键或唯一键冲突时更新)
+	Upsert(datas ...interface{}) error
+	// 按条件新增或更新数据(等值条件为冲突键,UpdateKV为更新字段)
+	UpsertByCnd(cnd *sqlc.Cnd) error
 	// 删除数据
 	Delete(datas ...interface{}) error
 	// 删除数据(ID列表)
 	DeleteByIDs(data interface{}, ids ...interface{}) error
+	// 按条件删除数据
+	DeleteByCnd(cnd *sqlc.Cnd) error
+	// 物理删除数据(忽略逻辑删除字段)
+	ForceDelete(datas ...interface{}) error
 	// 统计数据
 	Count(cnd *sqlc.Cnd) (int64, error)
 	// 按ID查询单条数据
@@ -86,6 +119,8 @@ type IDBase interface {
 	FindList(cnd *sqlc.Cnd, data interface{}) error
 	// 按复杂条件查询数据
 	FindComplex(cnd *sqlc.Cnd, data interface{}) error
+	// 按条件逐行遍历数据
+	FindEach(cnd *sqlc.Cnd, model interface{}, fn func(row interface{}) error) error
 	// 构建数据表别名
 	BuildCondKey(cnd *sqlc.Cnd, key string) string
 	// 构建逻辑条件
@@ -120,6 +155,14 @@ func (self *DBManager) UpdateByCnd(cnd *sqlc.Cnd) error {
 	return util.Error("No implementation method [UpdateByCnd] was found")
 }
 
+func (self *DBManager) Upsert(datas ...interface{}) error {
+	return util.Error("No implementation method [Upsert] was found")
+}
+
+func (self *DBManager) UpsertByCnd(cnd *sqlc.Cnd) error {
+	return util.Error("No implementation method [UpsertByCnd] was found")
+}
+
 func (self *DBManager) Delete(datas ...interface{}) error {
 	return util.Error("No implementation method [Delete] was found")
 }
@@ -128,6 +171,14 @@ func (self *DBManager) DeleteByIDs(data interface{}, ids ...interface{}) error {
 	return util.Error("No implementation method [DeleteByIDs] was found")
 }
 
+func (self *DBManager) DeleteByCnd(cnd *sqlc.Cnd) error {
+	return util.Error("No implementation method [DeleteByCnd] was found")
+}
+
+func (self *DBManager) ForceDelete(datas ...interface{}) error {
+	return util.Error("No implementation method [ForceDelete] was found")
+}
+
 func (self *DBManager) Count(cnd *sqlc.Cnd) (int64, error) {
 	return 0, util.Error("No implementation method [Count] was found")
 }
@@ -148,6 +199,10 @@ func (self *DBManager) FindComplex(cnd *sqlc.Cnd, data interface{}) error {
 	return util.Error("No implementation method [FindComplex] was found")
 }
 
+func (self *DBManager) FindEach(cnd *sqlc.Cnd, model interface{}, fn func(row interface{}) error) error {
+	return util.Error("No implementation method [FindEach] was found")
+}
+
 func (self *DBManager) Close() error {
 	return util.Error("No implementation method [Close] was found")
 }
@@ -177,6 +232,40 @@ func (self *DBManager) BuildPagination(cnd *sqlc.Cnd, sql string, values []inter
 	return "", util.Error("No implementation method [BuildPagination] was found")
 }
 
+// 获取上下文,未设置时使用默认上下文
+func (self *DBManager) getContext() context.Context {
+	if self.Context == nil {
+		return context.Background()
+	}
+	return self.Context
+}
+
+// 上下文超时或取消时返回对应异常
+func (self *DBManager) contextError(err ...error) error {
+	var cerr error
+	if self.Context != nil {
+		cerr = self.Context.Err()
+	}
+	if cerr == nil && len(err) > 0 {
+		cerr = err[0]
+	}
+	switch cerr {
+	case context.DeadlineExceeded:
+		return ErrTimeout
+	case context.Canceled:
+		return ErrCanceled
+	}
+	return nil
+}
+
+// 数据库操作异常,上下文超时或取消时返回ErrTimeout或ErrCanceled
+func (self *DBManager) ctxError(err error, msg ...interface{}) error {
+	if cerr := self.contextError(err); cerr != nil {
+		return self.Error(cerr)
+	}
+	return self.Error(util.AddStr(append(msg, err.Error())...))
+}
+
 func (self *DBManager) Error(data interface{}) error {
 	if err, ok := data.(error); ok {
 		self.Errors = append(self.Errors, err)
@@ -194,8 +283,15 @@ func (self *DBManager) Error(data interface{}) error {
 // 关系数据库连接管理器
 type RDBManager struct {
 	DBManager
-	Db *sql.DB
-	Tx *sql.Tx
+	Db          *sql.DB
+	Tx          *sql.Tx
+	Driver      string       // 数据库驱动名称
+	replicas    *replicaPool // 从库连接池
+	savepoints  []savepoint
+	shards      map[string]*RDBManager // 分片数据源管理器
+	shardTable  string                 // 分片数据表名称,分片执行时有效
+	cacheTables []string               // 事务中待失效查询缓存的数据表,提交后执行
+	stmts       *stmtCache             // 预编译语句缓存,同一数据源共享
 }
 
 func (self *RDBManager) initSlowLog() {
@@ -221,6 +317,46 @@ func (self *RDBManager) getSlowLog() *zap.Logger {
 	return sql_slowlog
 }
 
+// 设置上下文,后续数据库操作将在上下文超时或取消时中止
+func (self *RDBManager) WithContext(ctx context.Context) *RDBManager {
+	self.Context = ctx
+	return self
+}
+
+// 按配置注册关系数据库数据源,open按地址和账号创建连接池,从库账号为空时使用主库账号
+func buildRDB(driver string, conf DBConfig, manager cache.ICache, open func(host string, port int, username, password string) *sql.DB) *RDBManager {
+	replicas := make([]*replica, 0, len(conf.Replicas))
+	for _, v := range conf.Replicas {
+		if len(v.Username) == 0 {
+			v.Username, v.Password = conf.Username, conf.Password
+		}
+		addr := util.AddStr(v.Host, ":", util.AnyToStr(v.Port))
+		replicas = append(replicas, &replica{db: open(v.Host, v.Port, v.Username, v.Password), addr: addr, weight: v.Weight})
+	}
+	rdb := &RDBManager{}
+	rdb.Db = open(conf.Host, conf.Port, conf.Username, conf.Password)
+	rdb.replicas = newReplicaPool(conf.Balance, conf.CheckPeriod, replicas)
+	rdb.stmts = newStmtCache(conf.StmtCache)
+	rdb.Driver = driver
+	rdb.SlowQuery = conf.SlowQuery
+	rdb.SlowLogPath = conf.SlowLogPath
+	rdb.Debug = conf.Debug
+	rdb.CacheSync = conf.CacheSync
+	rdb.CacheManager = manager
+	if len(conf.DsName) == 0 {
+		rdb.DsName = MASTER
+	} else {
+		rdb.DsName = conf.DsName
+	}
+	rdb.initSlowLog()
+	// 重新初始化时停止原数据源从库健康检查
+	if old := rdbs[rdb.DsName]; old != nil && old.replicas != nil {
+		old.replicas.Close()
+	}
+	rdbs[rdb.DsName] = rdb
+	return rdb
+}
+
 func (self *RDBManager) GetDB(option ...Option) error {
 	var ds string
 	if option != nil && len(option) > 0 {
@@ -234,6 +370,9 @@ func (self *RDBManager) GetDB(option ...Option) error {
 		return self.Error(util.AddStr("SQL数据源[", ds, "]未找到,请检查..."))
 	}
 	self.Db = rdb.Db
+	self.Driver = rdb.Driver
+	self.replicas = rdb.replicas
+	self.stmts = rdb.stmts
 	self.Debug = rdb.Debug
 	self.SlowQuery = rdb.SlowQuery
 	self.SlowLogPath = rdb.SlowLogPath
@@ -245,11 +384,9 @@ func (self *RDBManager) GetDB(option ...Option) error {
 		ops.SlowLogPath = rdb.SlowLogPath
 		self.CacheSync = ops.CacheSync
 		if ops.AutoTx {
-			if tx, err := self.Db.Begin(); err != nil {
-				return self.Error(util.AddStr("数据库开启事务失败: ", err.Error()))
-			} else {
-				self.AutoTx = ops.AutoTx
-				self.Tx = tx
+			self.Context = ops.Context
+			if err := self.Begin(); err != nil {
+				return err
 			}
 		}
 		ops.DsName = ds
@@ -262,8 +399,26 @@ func (self *RDBManager) Save(datas ...interface{}) error {
 	if datas == nil || len(datas) == 0 {
 		return self.Error("参数列表不能为空")
 	}
+	if router := self.getShardRouter(datas[0]); router != nil {
+		return self.shardSave(router, datas)
+	}
+	if err := runHooks(self, beforeSave, datas...); err != nil {
+		return err
+	}
+	if self.BatchSave && len(datas) > 1 {
+		if err := self.saveBatch(datas...); err != nil {
+			return err
+		}
+		return runHooks(self, afterSave, datas...)
+	}
 	var stmt *sql.Stmt
+	var release func(err error)
 	var svsql string
+	defer func() {
+		if release != nil {
+			release(nil)
+		}
+	}()
 	for e := range datas {
 		data := datas[e]
 		start := util.Time()
@@ -273,133 +428,144 @@ func (self *RDBManager) Save(datas ...interface{}) error {
 		if reflect.ValueOf(data).Kind() != reflect.Ptr {
 			return self.Error("参数值必须为指针类型")
 		}
-		var fieldPart1, fieldPart2 bytes.Buffer
-		var valuePart = make([]interface{}, 0)
-		var idValue reflect.Value
-		tof := reflect.TypeOf(data).Elem()
-		vof := reflect.ValueOf(data).Elem()
-		for i := 0; i < tof.NumField(); i++ {
-			field := tof.Field(i)
-			value := vof.Field(i)
-			if util.ValidIgnore(field) {
-				continue
-			}
-			if field.Name == sqlc.Id {
-				if self.AutoID {
-					fieldPart1.WriteString(field.Tag.Get(sqlc.Json))
-					fieldPart1.WriteString(",")
-					fieldPart2.WriteString("?,")
-					if valueID, err := util.StrToInt64(util.GetUUID(int64(self.Node))); err != nil {
-						return self.Error(err)
-					} else {
-						valuePart = append(valuePart, valueID)
-						value.SetInt(valueID)
-					}
-				} else {
-					idValue = value
-				}
-				continue
-			}
-			kind := value.Kind()
-			if kind == reflect.String {
-				valuePart = append(valuePart, value.String())
-			} else if kind == reflect.Int || kind == reflect.Int8 || kind == reflect.Int16 || kind == reflect.Int32 || kind == reflect.Int64 {
-				rt := value.Int()
-				if kind == reflect.Int64 && util.ValidDate(field) {
-					if rt < 0 {
-						rt = 0
-					}
-					valuePart = append(valuePart, util.Time2Str(rt))
-				} else {
-					valuePart = append(valuePart, rt)
-				}
-			} else if !value.IsNil() && kind == reflect.Slice {
-				if str, err := util.ObjectToJson(value.Interface()); err != nil {
-					return self.Error(util.AddStr("字段[", field.Name, "]转换失败: ", err.Error()))
-				} else {
-					valuePart = append(valuePart, str)
-				}
-			} else if !value.IsNil() && kind == reflect.Map {
-				if str, err := util.ObjectToJson(value.Interface()); err != nil {
-					return self.Error(util.AddStr("字段[", field.Name, "]转换失败: ", err.Error()))
-				} else {
-					valuePart = append(valuePart, str)
-				}
-			} else if !value.IsNil() && kind == reflect.Slice {
-				if str, err := util.ObjectToJson(value.Interface()); err != nil {
-					return self.Error(util.AddStr("字段[", field.Name, "]转换失败: ", err.Error()))
-				} else {
-					valuePart = append(valuePart, str)
-				}
-			} else if value.IsNil() {
-				continue
-			} else {
-				str, err := util.ObjectToJson(value.Interface());
-				if err != nil {
-					fmt.Println("字段输出json失败: " + value.String())
-				}
-				fmt.Println(util.AddStr("警告: 不支持的字段[", field.Name, "]类型[", kind.String(), "] --- ", str))
-				continue
-			}
-			fieldPart1.WriteString(field.Tag.Get(sqlc.Bson))
-			fieldPart1.WriteString(",")
-			fieldPart2.WriteString("?,")
+		columns, s2, valuePart, idValue, err := self.buildInsertPart(data, len(self.shardTable) > 0)
+		if err != nil {
+			return self.Error(err)
 		}
-		s1 := fieldPart1.String()
-		s2 := fieldPart2.String()
 		var sqlbuf bytes.Buffer
 		sqlbuf.WriteString("insert into ")
-		if tb, err := util.GetDbAndTb(data); err != nil {
+		if tb, err := self.tableName(data); err != nil {
 			return self.Error(err)
 		} else {
-			sqlbuf.WriteString(tb)
+			sqlbuf.WriteString(self.quote(tb))
 		}
 		sqlbuf.WriteString(" (")
-		sqlbuf.WriteString(util.Substr(s1, 0, len(s1)-1))
+		sqlbuf.WriteString(self.quoteColumns(columns))
 		sqlbuf.WriteString(")")
 		sqlbuf.WriteString(" values (")
-		sqlbuf.WriteString(util.Substr(s2, 0, len(s2)-1))
+		sqlbuf.WriteString(s2)
 		sqlbuf.WriteString(")")
-		if len(svsql) == 0 {
-			svsql = sqlbuf.String()
-			var err error
-			defer self.debug("Save", svsql, valuePart, start)
-			if self.AutoTx {
-				stmt, err = self.Tx.Prepare(svsql)
-			} else {
-				stmt, err = self.Db.Prepare(svsql)
+		if self.returningId() {
+			sqlbuf.WriteString(" returning ")
+			sqlbuf.WriteString(self.quote(sqlc.BsonId))
+		}
+		// 同一批次复用预编译语句,拦截器改写SQL时重新预编译
+		err = self.intercept(self.invocation("Save", data, sqlbuf.String(), valuePart, start), func(inv *Invocation) error {
+			if stmt == nil || svsql != inv.SQL {
+				if release != nil {
+					release(nil)
+				}
+				var err error
+				if stmt, release, err = self.prepare(inv.SQL, false); err != nil {
+					return self.ctxError(err, "预编译sql[", inv.SQL, "]失败: ")
+				}
+				svsql = inv.SQL
 			}
+			if self.returningId() {
+				rows, err := stmt.QueryContext(self.getContext(), inv.Args...)
+				if err != nil {
+					release(err)
+					stmt, release = nil, nil
+					return self.ctxError(err, "保存数据失败: ")
+				}
+				defer rows.Close()
+				if rowsAffected, err := scanReturning(rows, []reflect.Value{idValue}); err != nil {
+					return self.ctxError(err, "保存数据失败: ")
+				} else if rowsAffected <= 0 {
+					return self.Error(util.AddStr("保存数据失败: 受影响行数 -> ", util.AnyToStr(rowsAffected)))
+				}
+				return nil
+			}
+			ret, err := stmt.ExecContext(self.getContext(), inv.Args...)
 			if err != nil {
-				return self.Error(util.AddStr("预编译sql[", svsql, "]失败: ", err.Error()))
+				release(err)
+				stmt, release = nil, nil
+				return self.ctxError(err, "保存数据失败: ")
 			}
-			defer stmt.Close()
-		}
-		ret, err := stmt.Exec(valuePart...)
+			if rowsAffected, err := ret.RowsAffected(); err != nil {
+				return self.ctxError(err, "保存数据失败: ")
+			} else if rowsAffected <= 0 {
+				return self.Error(util.AddStr("保存数据失败: 受影响行数 -> ", util.AnyToStr(rowsAffected)))
+			}
+			if !self.AutoID {
+				if lastInsertId, err := ret.LastInsertId(); err != nil {
+					return self.ctxError(err, "保存数据失败: ")
+				} else {
+					if lastInsertId > 0 && idValue.IsValid() {
+						idValue.SetInt(lastInsertId)
+					}
+				}
+			}
+			return nil
+		})
 		if err != nil {
-			return self.Error(util.AddStr("保存数据失败: ", err.Error()))
-		}
-		if rowsAffected, err := ret.RowsAffected(); err != nil {
-			return self.Error(util.AddStr("保存数据失败: ", err.Error()))
-		} else if rowsAffected <= 0 {
-			return self.Error(util.AddStr("保存数据失败: 受影响行数 -> ", util.AnyToStr(rowsAffected)))
+			return err
 		}
-		if !self.AutoID {
-			if lastInsertId, err := ret.LastInsertId(); err != nil {
-				return self.Error(util.AddStr("保存数据失败: ", err.Error()))
-			} else {
-				if lastInsertId > 0 {
-					idValue.SetInt(lastInsertId)
+	}
+	if err := runHooks(self, afterSave, datas...); err != nil {
+		return err
+	}
+	return self.AddCacheSync(datas...)
+}
+
+// 构建保存对象的列名,占位符部分及参数值,返回ID字段用于回填,keepId为true时保留已有ID值
+func (self *RDBManager) buildInsertPart(data interface{}, keepId bool) ([]string, string, []interface{}, reflect.Value, error) {
+	var fieldPart2 bytes.Buffer
+	var columns = make([]string, 0)
+	var valuePart = make([]interface{}, 0)
+	var idValue reflect.Value
+	meta, err := GetModelMeta(data)
+	if err != nil {
+		return nil, "", nil, idValue, err
+	}
+	setAutoTime(data, true)
+	vof := reflect.ValueOf(data).Elem()
+	for _, field := range meta.Fields {
+		value := vof.FieldByIndex(field.Index)
+		if field.IsId {
+			idValue = value
+			if keepId && value.Int() > 0 {
+				columns = append(columns, field.JsonName)
+				fieldPart2.WriteString("?,")
+				valuePart = append(valuePart, value.Int())
+			} else if self.AutoID {
+				columns = append(columns, field.JsonName)
+				fieldPart2.WriteString("?,")
+				if valueID, err := util.StrToInt64(util.GetUUID(int64(self.Node))); err != nil {
+					return nil, "", nil, idValue, err
+				} else {
+					valuePart = append(valuePart, valueID)
+					value.SetInt(valueID)
 				}
 			}
+			continue
 		}
+		v, ok, err := field.encode(value)
+		if err != nil {
+			return nil, "", nil, idValue, err
+		} else if !ok {
+			continue
+		}
+		valuePart = append(valuePart, v)
+		columns = append(columns, field.Column)
+		fieldPart2.WriteString("?,")
 	}
-	return self.AddCacheSync(datas...)
+	s2 := fieldPart2.String()
+	return columns, util.Substr(s2, 0, len(s2)-1), valuePart, idValue, nil
 }
 
 func (self *RDBManager) Update(datas ...interface{}) error {
 	if datas == nil || len(datas) == 0 {
 		return self.Error("参数列表不能为空")
 	}
+	if router := self.getShardRouter(datas[0]); router != nil {
+		return self.shardExec(router, datas, true, func(db *RDBManager, datas []interface{}) error {
+			return db.Update(datas...)
+		})
+	}
+	if err := runHooks(self, beforeUpdate, datas...); err != nil {
+		return err
+	}
 	for e := range datas {
 		data := datas[e]
 		start := util.Time()
@@ -409,100 +575,86 @@ func (self *RDBManager) Update(datas ...interface{}) error {
 		if reflect.ValueOf(data).Kind() != reflect.Ptr {
 			return self.Error("参数值必须为指针类型")
 		}
+		setAutoTime(data, false)
 		var fieldPart1, fieldPart2 bytes.Buffer
 		var valuePart = make([]interface{}, 0)
-		var idValue reflect.Value
-		tof := reflect.TypeOf(data).Elem()
+		var idValue, versionValue reflect.Value
+		var versionName string
+		meta, err := GetModelMeta(data)
+		if err != nil {
+			return self.Error(err)
+		}
 		vof := reflect.ValueOf(data).Elem()
-		for i := 0; i < tof.NumField(); i++ {
-			field := tof.Field(i)
-			value := vof.Field(i)
-			if util.ValidIgnore(field) {
-				continue
-			}
-			if field.Name == sqlc.Id {
-				if value.Kind() != reflect.Int64 {
+		for _, field := range meta.Fields {
+			value := vof.FieldByIndex(field.Index)
+			if field.IsId {
+				if field.Kind != reflect.Int64 {
 					return self.Error("实体ID必须为int64类型")
 				}
 				idValue = value
-				fieldPart2.WriteString("id = ?,")
+				fieldPart2.WriteString(self.quote(sqlc.BsonId))
+				fieldPart2.WriteString(" = ?")
 				continue
 			}
-			kind := value.Kind()
-			if kind == reflect.String {
-				valuePart = append(valuePart, value.String())
-			} else if kind == reflect.Int || kind == reflect.Int8 || kind == reflect.Int16 || kind == reflect.Int32 || kind == reflect.Int64 {
-				rt := value.Int()
-				if kind == reflect.Int64 && util.ValidDate(field) {
-					if rt < 0 {
-						rt = 0
-					}
-					valuePart = append(valuePart, util.Time2Str(rt))
-				} else {
-					valuePart = append(valuePart, rt)
-				}
-			} else if !value.IsNil() && kind == reflect.Slice {
-				if str, err := util.ObjectToJson(value.Interface()); err != nil {
-					return self.Error(util.AddStr("字段[", field.Name, "]转换失败: ", err.Error()))
-				} else {
-					valuePart = append(valuePart, str)
-				}
-			} else if !value.IsNil() && kind == reflect.Map {
-				if str, err := util.ObjectToJson(value.Interface()); err != nil {
-					return self.Error(util.AddStr("字段[", field.Name, "]转换失败: ", err.Error()))
-				} else {
-					valuePart = append(valuePart, str)
-				}
-			} else if !value.IsNil() && kind == reflect.Slice {
-				if str, err := util.ObjectToJson(value.Interface()); err != nil {
-					return self.Error(util.AddStr("字段[", field.Name, "]转换失败: ", err.Error()))
-				} else {
-					valuePart = append(valuePart, str)
+			if field.IsVersion {
+				if field.Kind != reflect.Int64 {
+					return self.Error("版本字段必须为int64类型")
 				}
-			} else if value.IsNil() {
+				versionValue = value
+				versionName = field.Column
+				valuePart = append(valuePart, value.Int()+1)
+			} else if v, ok, err := field.encode(value); err != nil {
+				return self.Error(err)
+			} else if !ok {
 				continue
 			} else {
-				str, err := util.ObjectToJson(value.Interface());
-				if err != nil {
-					fmt.Println("字段输出json失败: " + value.String())
-				}
-				fmt.Println(util.AddStr("警告: 不支持的字段[", field.Name, "]类型[", kind.String(), "] --- ", str))
-				continue
+				valuePart = append(valuePart, v)
 			}
 			fieldPart1.WriteString(" ")
-			fieldPart1.WriteString(field.Tag.Get(sqlc.Bson))
+			fieldPart1.WriteString(self.quote(field.Column))
 			fieldPart1.WriteString(" = ?,")
 		}
+		if !idValue.IsValid() {
+			return self.Error("实体Id字段不能为空")
+		}
 		valuePart = append(valuePart, idValue.Int())
+		if versionValue.IsValid() {
+			fieldPart2.WriteString(" and ")
+			fieldPart2.WriteString(self.quote(versionName))
+			fieldPart2.WriteString(" = ?")
+			valuePart = append(valuePart, versionValue.Int())
+		}
 		s1 := fieldPart1.String()
-		s2 := fieldPart2.String()
 		var sqlbuf bytes.Buffer
 		sqlbuf.WriteString("update ")
-		if tb, err := util.GetDbAndTb(data); err != nil {
+		if tb, err := self.tableName(data); err != nil {
 			return self.Error(err)
 		} else {
-			sqlbuf.WriteString(tb)
+			sqlbuf.WriteString(self.quote(tb))
 		}
 		sqlbuf.WriteString(" set")
 		sqlbuf.WriteString(util.Substr(s1, 0, len(s1)-1))
 		sqlbuf.WriteString(" where ")
-		sqlbuf.WriteString(util.Substr(s2, 0, len(s2)-1))
-		defer self.debug("Update", sqlbuf.String(), valuePart, start)
-		var stmt *sql.Stmt
-		var err error
-		if self.AutoTx {
-			stmt, err = self.Tx.Prepare(sqlbuf.String())
-		} else {
-			stmt, err = self.Db.Prepare(sqlbuf.String())
-		}
+		sqlbuf.WriteString(fieldPart2.String())
+		err = self.exec(self.invocation("Update", data, sqlbuf.String(), valuePart, start), "更新数据失败: ", func(ret sql.Result) error {
+			if !versionValue.IsValid() {
+				return nil
+			}
+			if rowsAffected, err := ret.RowsAffected(); err != nil {
+				return self.ctxError(err, "更新数据失败: ")
+			} else if rowsAffected <= 0 {
+				return self.Error(ErrStaleObject)
+			}
+			versionValue.SetInt(versionValue.Int() + 1)
+			return nil
+		})
 		if err != nil {
-			return self.Error(util.AddStr("预编译sql[", sqlbuf.String(), "]失败: ", err.Error()))
-		}
-		defer stmt.Close()
-		if _, err := stmt.Exec(valuePart...); err != nil {
-			return self.Error(util.AddStr("更新数据失败: ", err.Error()))
+			return err
 		}
 	}
+	if err := runHooks(self, afterUpdate, datas...); err != nil {
+		return err
+	}
 	return self.AddCacheSync(datas...)
 }
 
@@ -515,12 +667,20 @@ func (self *RDBManager) UpdateByCnd(cnd *sqlc.Cnd) error {
 	if len(cnd.UpdateKV) == 0 {
 		return self.Error("更新条件不能为空")
 	}
+	if router := self.getShardRouter(elem); router != nil {
+		return self.shardExecCnd(router, cnd, true, func(db *RDBManager) error {
+			return db.UpdateByCnd(cnd)
+		})
+	}
+	if err := self.checkIdents(cnd); err != nil {
+		return self.Error(err)
+	}
 	var fieldPart1, fieldPart2 bytes.Buffer
 	var valuePart = make([]interface{}, 0)
-	for k, v := range cnd.UpdateKV {
-		fieldPart1.WriteString(k)
+	for k, v := range autoUpdateKV(elem, cnd.UpdateKV, true) {
+		fieldPart1.WriteString(self.quote(k))
 		fieldPart1.WriteString(" = ?,")
-		valuePart = append(valuePart, v)
+		valuePart = append(valuePart, encodeArg(v))
 	}
 	part, args := self.BuildWhereCase(cnd)
 	for e := range args {
@@ -535,34 +695,155 @@ func (self *RDBManager) UpdateByCnd(cnd *sqlc.Cnd) error {
 	s2 := fieldPart2.String()
 	var sqlbuf bytes.Buffer
 	sqlbuf.WriteString("update ")
-	if tb, err := util.GetDbAndTb(elem); err != nil {
+	if tb, err := self.tableName(elem); err != nil {
 		return self.Error(err)
 	} else {
-		sqlbuf.WriteString(tb)
+		sqlbuf.WriteString(self.quote(tb))
 	}
 	sqlbuf.WriteString(" set ")
 	sqlbuf.WriteString(util.Substr(s1, 0, len(s1)-1))
 	sqlbuf.WriteString(util.Substr(s2, 0, len(s2)-1))
-	defer self.debug("UpdateByCnd", sqlbuf.String(), valuePart, start)
-	var stmt *sql.Stmt
-	var err error
-	if self.AutoTx {
-		stmt, err = self.Tx.Prepare(sqlbuf.String())
-	} else {
-		stmt, err = self.Db.Prepare(sqlbuf.String())
+	if err := self.exec(self.invocation("UpdateByCnd", elem, sqlbuf.String(), valuePart, start), "更新数据失败: ", nil); err != nil {
+		return err
+	}
+	return self.AddCacheSync2(cnd)
+}
+
+// 按对象ID删除数据
+func (self *RDBManager) Delete(datas ...interface{}) error {
+	if datas == nil || len(datas) == 0 {
+		return self.Error("参数列表不能为空")
+	}
+	if router := self.getShardRouter(datas[0]); router != nil {
+		return self.shardExec(router, datas, true, func(db *RDBManager, datas []interface{}) error {
+			return db.Delete(datas...)
+		})
+	}
+	if err := runHooks(self, beforeDelete, datas...); err != nil {
+		return err
+	}
+	ids := make([]interface{}, 0, len(datas))
+	for e := range datas {
+		data := datas[e]
+		if data == nil {
+			return self.Error("参数元素不能为空")
+		}
+		if reflect.ValueOf(data).Kind() != reflect.Ptr {
+			return self.Error("参数值必须为指针类型")
+		}
+		if reflect.TypeOf(data) != reflect.TypeOf(datas[0]) {
+			return self.Error("参数列表对象类型必须一致")
+		}
+		if vid := getDataID(data); vid <= 0 {
+			return self.Error("对象ID值不能为空")
+		} else {
+			ids = append(ids, vid)
+		}
+	}
+	if err := self.deleteByIDs("Delete", datas[0], ids, false); err != nil {
+		return err
+	}
+	if err := runHooks(self, afterDelete, datas...); err != nil {
+		return err
+	}
+	return self.AddCacheDelete(datas...)
+}
+
+// 按ID列表删除数据
+func (self *RDBManager) DeleteByIDs(data interface{}, ids ...interface{}) error {
+	if data == nil || len(ids) == 0 {
+		return self.Error("参数列表不能为空")
+	}
+	if reflect.ValueOf(data).Kind() != reflect.Ptr {
+		return self.Error("参数值必须为指针类型")
 	}
+	if router := self.getShardRouter(data); router != nil {
+		return self.shardExecCnd(router, sqlc.M(data).In(sqlc.BsonId, ids...), true, func(db *RDBManager) error {
+			return db.DeleteByIDs(data, ids...)
+		})
+	}
+	if err := self.deleteByIDs("DeleteByIDs", data, ids, false); err != nil {
+		return err
+	}
+	return self.AddCacheDelCnd(sqlc.M(data).In(sqlc.BsonId, ids...))
+}
+
+func (self *RDBManager) deleteByIDs(title string, data interface{}, ids []interface{}, force bool) error {
+	start := util.Time()
+	var fieldPart bytes.Buffer
+	for range ids {
+		fieldPart.WriteString("?,")
+	}
+	s := fieldPart.String()
+	tb, err := self.tableName(data)
 	if err != nil {
-		return self.Error(util.AddStr("预编译sql[", sqlbuf.String(), "]失败: ", err.Error()))
+		return self.Error(err)
 	}
-	defer stmt.Close()
-	if _, err := stmt.Exec(valuePart...); err != nil {
-		return self.Error(util.AddStr("更新数据失败: ", err.Error()))
+	var sqlbuf bytes.Buffer
+	var valuePart = ids
+	// 存在逻辑删除字段时更新删除标记
+	if field, ok := getSoftDeleteField(data); ok && !force {
+		sqlbuf.WriteString("update ")
+		sqlbuf.WriteString(self.quote(tb))
+		sqlbuf.WriteString(" set ")
+		sqlbuf.WriteString(self.quote(field.Column))
+		sqlbuf.WriteString(" = ?")
+		valuePart = append([]interface{}{softDeleteValue(field)}, ids...)
+	} else {
+		sqlbuf.WriteString("delete from ")
+		sqlbuf.WriteString(self.quote(tb))
 	}
-	return self.AddCacheSync2(cnd)
+	sqlbuf.WriteString(util.AddStr(" where ", self.quote(sqlc.BsonId), " in("))
+	sqlbuf.WriteString(util.Substr(s, 0, len(s)-1))
+	sqlbuf.WriteString(")")
+	return self.exec(self.invocation(title, data, sqlbuf.String(), valuePart, start), "删除数据失败: ", nil)
 }
 
-func (self *RDBManager) Delete(datas ...interface{}) error {
-	return util.Error("No implementation method [Delete] was found")
+// 按条件删除数据
+func (self *RDBManager) DeleteByCnd(cnd *sqlc.Cnd) error {
+	start := util.Time()
+	if cnd == nil {
+		return self.Error("条件参数不能为空")
+	}
+	var elem = cnd.Model
+	if elem == nil {
+		return self.Error("ORM对象类型不能为空,请通过M(...)方法设置对象类型")
+	}
+	if len(cnd.Conditions) == 0 {
+		return self.Error("删除条件不能为空")
+	}
+	if router := self.getShardRouter(elem); router != nil {
+		return self.shardExecCnd(router, cnd, true, func(db *RDBManager) error {
+			return db.DeleteByCnd(cnd)
+		})
+	}
+	if err := self.checkIdents(cnd); err != nil {
+		return self.Error(err)
+	}
+	part, valuePart := self.BuildWhereCase(cnd)
+	if part.Len() == 0 {
+		return self.Error("删除条件不能为空")
+	}
+	if field, ok := getSoftDeleteField(elem); ok && !cnd.IsUnscoped {
+		if err := self.softDeleteByCnd(cnd, field, part, valuePart, start); err != nil {
+			return err
+		}
+		return self.AddCacheDelCnd(cnd)
+	}
+	s := part.String()
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString("delete from ")
+	if tb, err := self.tableName(elem); err != nil {
+		return self.Error(err)
+	} else {
+		sqlbuf.WriteString(self.quote(tb))
+	}
+	sqlbuf.WriteString(" where")
+	sqlbuf.WriteString(util.Substr(s, 0, len(s)-3))
+	if err := self.exec(self.invocation("DeleteByCnd", elem, sqlbuf.String(), valuePart, start), "删除数据失败: ", nil); err != nil {
+		return err
+	}
+	return self.AddCacheDelCnd(cnd)
 }
 
 // 根据条件统计查询
@@ -572,6 +853,12 @@ func (self *RDBManager) Count(cnd *sqlc.Cnd) (int64, error) {
 	if elem == nil {
 		return 0, self.Error("ORM对象类型不能为空,请通过M(...)方法设置对象类型")
 	}
+	if router := self.getShardRouter(elem); router != nil {
+		return self.shardCount(router, cnd)
+	}
+	if err := self.checkIdents(cnd); err != nil {
+		return 0, self.Error(err)
+	}
 	var fieldPart1, fieldPart2 bytes.Buffer
 	var valuePart = make([]interface{}, 0)
 	fieldPart1.WriteString("count(1)")
@@ -590,40 +877,41 @@ func (self *RDBManager) Count(cnd *sqlc.Cnd) (int64, error) {
 	sqlbuf.WriteString("select ")
 	sqlbuf.WriteString(s1)
 	sqlbuf.WriteString(" from ")
-	if tb, err := util.GetDbAndTb(elem); err != nil {
+	if tb, err := self.tableName(elem); err != nil {
 		return 0, self.Error(err)
 	} else {
-		sqlbuf.WriteString(tb)
+		sqlbuf.WriteString(self.quote(tb))
 	}
 	sqlbuf.WriteString(" ")
 	sqlbuf.WriteString(util.Substr(s2, 0, len(s2)-1))
-	defer self.debug("Count", sqlbuf.String(), valuePart, start)
-	var stmt *sql.Stmt
-	var err error
-	if self.AutoTx {
-		stmt, err = self.Tx.Prepare(sqlbuf.String())
-	} else {
-		stmt, err = self.Db.Prepare(sqlbuf.String())
-	}
-	if err != nil {
-		return 0, self.Error(util.AddStr("预编译sql[", sqlbuf.String(), "]失败: ", err.Error()))
-	}
-	defer stmt.Close()
-	rows, err := stmt.Query(valuePart...)
-	if rows != nil {
-		defer rows.Close()
-	}
-	if err != nil {
-		return 0, self.Error(util.AddStr("查询失败: ", err.Error()))
-	}
 	var pageTotal int64
-	for rows.Next() {
-		if err := rows.Scan(&pageTotal); err != nil {
-			return 0, self.Error(util.AddStr("匹配结果异常: ", err.Error()))
+	inv := self.invocation("Count", elem, sqlbuf.String(), valuePart, start)
+	key, hit, err := self.getByCache(cnd, inv.SQL, inv.Args, true, &pageTotal)
+	if err != nil {
+		return 0, err
+	} else if hit {
+		inv.Op = "Count by Cache"
+		err = self.intercept(inv, func(inv *Invocation) error {
+			return nil
+		})
+	} else {
+		err = self.query(inv, true, func(rows *sql.Rows) error {
+			for rows.Next() {
+				if err := rows.Scan(&pageTotal); err != nil {
+					return self.ctxError(err, "匹配结果异常: ")
+				}
+			}
+			if err := rows.Err(); err != nil {
+				return self.ctxError(err, "读取查询结果失败: ")
+			}
+			return nil
+		})
+		if err == nil {
+			self.putByCache(cnd, key, pageTotal)
 		}
 	}
-	if err := rows.Err(); err != nil {
-		return 0, self.Error(util.Error("读取查询结果失败: ", err.Error()))
+	if err != nil {
+		return 0, err
 	}
 	if pageTotal > 0 && cnd.Pagination.PageSize > 0 {
 		var pageCount int64
@@ -649,86 +937,66 @@ func (self *RDBManager) FindById(data interface{}) error {
 	if reflect.ValueOf(data).Kind() != reflect.Ptr {
 		return self.Error("返回值必须为指针类型")
 	}
+	if router := self.getShardRouter(data); router != nil {
+		return self.shardFindById(router, data)
+	}
 	var fieldPart1, fieldPart2 bytes.Buffer
 	var valuePart = make([]interface{}, 0)
-	var fieldArray []reflect.StructField
-	if vid := util.GetDataID(data); vid <= 0 {
+	meta, err := GetModelMeta(data)
+	if err != nil {
+		return self.Error(err)
+	}
+	if vid := meta.getId(reflect.ValueOf(data).Elem()); vid <= 0 {
 		return self.Error("对象ID值不能为空")
 	} else {
 		valuePart = append(valuePart, vid)
 	}
-	tof := util.TypeOf(data)
-	for i := 0; i < tof.NumField(); i++ {
-		field := tof.Field(i)
-		if util.ValidIgnore(field) {
-			continue
-		}
-		fname := field.Tag.Get(sqlc.Bson)
-		if len(fname) == 0 {
-			return self.Error(util.AddStr("字段[", field.Name, "]无效bson标签"))
-		}
-		if field.Name == sqlc.Id {
-			fieldPart1.WriteString(" id,")
-			fieldArray = append(fieldArray, field)
-			continue
-		} else {
-			fieldPart1.WriteString(" ")
-			fieldPart1.WriteString(fname)
-			fieldPart1.WriteString(",")
-			fieldArray = append(fieldArray, field)
-			continue
-		}
+	fieldArray, err := meta.selectFields(nil)
+	if err != nil {
+		return self.Error(err)
 	}
-	fieldPart2.WriteString(" where id = ?,")
+	for _, field := range fieldArray {
+		fieldPart1.WriteString(" ")
+		fieldPart1.WriteString(self.quote(field.Column))
+		fieldPart1.WriteString(",")
+	}
+	fieldPart2.WriteString(util.AddStr(" where ", self.quote(sqlc.BsonId), " = ?,"))
 	s1 := fieldPart1.String()
 	s2 := fieldPart2.String()
 	var sqlbuf bytes.Buffer
 	sqlbuf.WriteString("select ")
 	sqlbuf.WriteString(util.Substr(s1, 0, len(s1)-1))
 	sqlbuf.WriteString(" from ")
-	if tb, err := util.GetDbAndTb(data); err != nil {
+	if tb, err := self.tableName(data); err != nil {
 		return self.Error(err)
 	} else {
-		sqlbuf.WriteString(tb)
+		sqlbuf.WriteString(self.quote(tb))
 	}
 	sqlbuf.WriteString(" ")
 	sqlbuf.WriteString(util.Substr(s2, 0, len(s2)-1))
-	defer self.debug("FindById", sqlbuf.String(), valuePart, start)
-	var stmt *sql.Stmt
-	var err error
-	if self.AutoTx {
-		stmt, err = self.Tx.Prepare(sqlbuf.String())
-	} else {
-		stmt, err = self.Db.Prepare(sqlbuf.String())
-	}
-	if err != nil {
-		return self.Error(util.AddStr("预编译sql[", sqlbuf.String(), "]失败: ", err.Error()))
-	}
-	defer stmt.Close()
-	rows, err := stmt.Query(valuePart...)
-	if rows != nil {
-		defer rows.Close()
-	}
-	if err != nil {
-		return self.Error(util.AddStr("查询失败: ", err.Error()))
-	}
-	columns, err := rows.Columns()
-	if err != nil && len(columns) != len(fieldArray) {
-		return self.Error(util.AddStr("读取查询结果列长度失败: ", err.Error()))
-	}
-	raws, err := EchoResultRows(rows, len(columns))
+	var raws [][][]byte
+	inv := self.invocation("FindById", data, sqlbuf.String(), valuePart, start)
+	inv.Result = data
+	err = self.query(inv, false, func(rows *sql.Rows) error {
+		columns, err := rows.Columns()
+		if err != nil && len(columns) != len(fieldArray) {
+			return self.ctxError(err, "读取查询结果列长度失败: ")
+		}
+		if raws, err = EchoResultRows(rows, len(columns)); err != nil {
+			return self.ctxError(err, "读取查询结果失败: ")
+		}
+		return nil
+	})
 	if err != nil {
-		return self.Error(util.AddStr("读取查询结果失败: ", err.Error()))
+		return err
 	}
 	if len(raws) <= 0 {
 		return nil
 	}
-	if str, err := DataToMap(fieldArray, raws[0]); err != nil {
-		return self.Error(err)
-	} else if err := util.JsonToObject(str, data); err != nil {
+	if err := decodeRow(fieldArray, raws[0], reflect.ValueOf(data).Elem()); err != nil {
 		return self.Error(err)
 	}
-	return nil
+	return runAfterFind(self, data)
 }
 
 // 按条件查询单条数据
@@ -742,7 +1010,6 @@ func (self *RDBManager) FindOne(cnd *sqlc.Cnd, data interface{}) error {
 	}
 	var fieldPart1, fieldPart2 bytes.Buffer
 	var valuePart = make([]interface{}, 0)
-	var fieldArray []reflect.StructField
 	var elem = cnd.Model
 	if elem == nil {
 		return self.Error("ORM对象类型不能为空,请通过M(...)方法设置对象类型")
@@ -750,47 +1017,24 @@ func (self *RDBManager) FindOne(cnd *sqlc.Cnd, data interface{}) error {
 	if util.TypeOf(data).Kind() != reflect.Struct {
 		return self.Error("返回结果必须为struct类型")
 	}
-	tof := util.TypeOf(elem)
-	if tof.Kind() != reflect.Struct && tof.Kind() != reflect.Ptr {
-		return self.Error("ORM对象类型必须为struct或ptr")
+	if router := self.getShardRouter(elem); router != nil {
+		return self.shardFindOne(router, cnd, data)
 	}
-	for i := 0; i < tof.NumField(); i++ {
-		field := tof.Field(i)
-		if util.ValidIgnore(field) {
-			continue
-		}
-		fname := field.Tag.Get(sqlc.Bson)
-		if len(fname) == 0 {
-			return self.Error(util.AddStr("字段[", field.Name, "]无效bson标签"))
-		}
-		if cnd != nil && len(cnd.AnyFields) > 0 {
-			for e := range cnd.AnyFields {
-				if field.Name == sqlc.Id && cnd.AnyFields[e] == sqlc.BsonId {
-					fieldPart1.WriteString(" id,")
-					fieldArray = append(fieldArray, field)
-					continue
-				}
-				if cnd.AnyFields[e] == fname {
-					fieldPart1.WriteString(" ")
-					fieldPart1.WriteString(fname)
-					fieldPart1.WriteString(",")
-					fieldArray = append(fieldArray, field)
-					continue
-				}
-			}
-		} else {
-			if field.Name == sqlc.Id {
-				fieldPart1.WriteString(" id,")
-				fieldArray = append(fieldArray, field)
-				continue
-			} else {
-				fieldPart1.WriteString(" ")
-				fieldPart1.WriteString(fname)
-				fieldPart1.WriteString(",")
-				fieldArray = append(fieldArray, field)
-				continue
-			}
-		}
+	meta, err := GetModelMeta(elem)
+	if err != nil {
+		return self.Error(err)
+	}
+	if err := newIdentScope(meta).checkCnd(cnd); err != nil {
+		return self.Error(err)
+	}
+	fieldArray, err := meta.selectFields(cnd.AnyFields)
+	if err != nil {
+		return self.Error(err)
+	}
+	for _, field := range fieldArray {
+		fieldPart1.WriteString(" ")
+		fieldPart1.WriteString(self.quote(field.Column))
+		fieldPart1.WriteString(",")
 	}
 	part, args := self.BuildWhereCase(cnd)
 	for e := range args {
@@ -807,10 +1051,10 @@ func (self *RDBManager) FindOne(cnd *sqlc.Cnd, data interface{}) error {
 	sqlbuf.WriteString("select ")
 	sqlbuf.WriteString(util.Substr(s1, 0, len(s1)-1))
 	sqlbuf.WriteString(" from ")
-	if tb, err := util.GetDbAndTb(elem); err != nil {
+	if tb, err := self.tableName(elem); err != nil {
 		return self.Error(err)
 	} else {
-		sqlbuf.WriteString(tb)
+		sqlbuf.WriteString(self.quote(tb))
 	}
 	sqlbuf.WriteString(" ")
 	sqlbuf.WriteString(util.Substr(s2, 0, len(s2)-1))
@@ -819,42 +1063,28 @@ func (self *RDBManager) FindOne(cnd *sqlc.Cnd, data interface{}) error {
 		sqlbuf.WriteString(sortby)
 	}
 	cnd.Pagination = dialect.Dialect{PageNo: 1, PageSize: 1}
-	limitSql, err := self.BuildPagination(cnd, sqlbuf.String(), valuePart);
+	limitSql, err := self.BuildPagination(cnd, sqlbuf.String(), valuePart)
 	if err != nil {
 		return self.Error(err)
 	}
-	defer self.debug("FindOne", sqlbuf.String(), valuePart, start)
-	var stmt *sql.Stmt
-	if self.AutoTx {
-		stmt, err = self.Tx.Prepare(limitSql)
-	} else {
-		stmt, err = self.Db.Prepare(limitSql)
-	}
-	if err != nil {
-		return self.Error(util.AddStr("预编译sql[", sqlbuf.String(), "]失败: ", err.Error()))
-	}
-	defer stmt.Close()
-	rows, err := stmt.Query(valuePart...)
-	if rows != nil {
-		defer rows.Close()
-	}
+	inv := self.invocation("FindOne", elem, limitSql, valuePart, start)
+	inv.Result = data
+	columns, raws, err := self.queryRows(cnd, inv)
 	if err != nil {
-		return self.Error(util.AddStr("查询失败: ", err.Error()))
-	}
-	columns, err := rows.Columns()
-	if err != nil && len(columns) != len(fieldArray) {
-		return self.Error(util.AddStr("读取查询结果列长度失败: ", err.Error()))
+		return err
 	}
-	raws, err := EchoResultRows(rows, len(columns))
-	if err != nil {
-		return self.Error(util.AddStr("读取查询结果失败: ", err.Error()))
+	// 分页方言可能追加行号列,结果列与查询字段不一致时按列名匹配
+	if len(columns) != len(fieldArray) {
+		fieldArray = meta.columnFields(columns)
 	}
 	if len(raws) > 0 {
-		if str, err := DataToMap(fieldArray, raws[0]); err != nil {
+		if err := decodeOne(meta, fieldArray, raws[0], data); err != nil {
 			return self.Error(err)
-		} else if err := util.JsonToObject(str, data); err != nil {
+		}
+		if err := preload(self, cnd, data); err != nil {
 			return self.Error(err)
 		}
+		return runAfterFind(self, data)
 	}
 	return nil
 }
@@ -882,200 +1112,30 @@ func mapperObject(rows *sql.Rows, model interface{}, resultv interface{}, one bo
 	data := make([][][]byte, 0)
 	for rows.Next() {
 		result := make([][]byte, len(col))
-		dest := make([]interface{}, len(col))
-		for i, _ := range result {
-			dest[i] = &result[i]
-		}
-		if err := rows.Scan(dest...); err != nil {
-			return err
-		}
-		data = append(data, result)
-	}
-	if err := rows.Err(); err != nil {
-		return err
-	}
-	tof := util.TypeOf(model)
-	if tof.Kind() != reflect.Struct && tof.Kind() != reflect.Ptr {
-		return util.Error("ORM对象类型必须为struct或ptr")
-	}
-	valList := make([]map[string]interface{}, 0, len(data))
-	typList := make([]FieldKeyKind, 0, len(col))
-	for _, v := range col {
-		for i := 0; i < tof.NumField(); i++ {
-			field := tof.Field(i)
-			if v == field.Tag.Get(sqlc.Json) {
-				typList = append(typList,
-					FieldKeyKind{
-						Name:   v,
-						Kind:   field.Type.String(),
-						IsDate: util.ValidDate(field),
-					})
-			}
-		}
-	}
-	for _, v := range data {
-		result := map[string]interface{}{}
-		for i, v1 := range v {
-			typ := typList[i]
-			f := typ.Name
-			kind := typ.Kind
-			vs := string(v1)
-			if len(vs) == 0 {
-				continue
-			}
-			if kind == "int" {
-				if i0, err := util.StrToInt(vs); err != nil {
-					return util.Error("对象字段[", f, "]转换int失败")
-				} else {
-					result[f] = i0
-				}
-			} else if kind == "int8" {
-				if i8, err := util.StrToInt8(string(vs)); err != nil {
-					return util.Error("对象字段[", f, "]转换int8失败")
-				} else {
-					result[f] = i8
-				}
-			} else if kind == "int16" {
-				if i16, err := util.StrToInt16(string(vs)); err != nil {
-					return util.Error("对象字段[", f, "]转换int16失败")
-				} else {
-					result[f] = i16
-				}
-			} else if kind == "int32" {
-				if i32, err := util.StrToInt32(string(vs)); err != nil {
-					return util.Error("对象字段[", f, "]转换int32失败")
-				} else {
-					result[f] = i32
-				}
-			} else if kind == "int64" {
-				if typ.IsDate {
-					if vs == "0000-00-00 00:00:00" {
-						result[f] = 0
-					} else {
-						if i64, err := util.Str2Time(vs); err != nil {
-							return util.Error("对象字段[", f, "]转换int64失败: ", err.Error())
-						} else {
-							result[f] = i64
-						}
-					}
-				} else {
-					if i64, err := util.StrToInt64(vs); err != nil {
-						return util.Error("对象字段[", f, "]转换int64失败")
-					} else {
-						result[f] = i64
-					}
-				}
-			} else if kind == "string" {
-				result[f] = vs
-			} else if kind == "[]string" {
-				array := make([]string, 0)
-				if err := util.JsonToObject(vs, &array); err != nil {
-					return err
-				}
-				result[f] = array
-			} else if kind == "[]int" {
-				array := make([]int, 0)
-				if err := util.JsonToObject(vs, &array); err != nil {
-					return err
-				}
-				result[f] = array
-			} else if kind == "[]int8" {
-				array := make([]int8, 0)
-				if err := util.JsonToObject(vs, &array); err != nil {
-					return err
-				}
-				result[f] = array
-			} else if kind == "[]int16" {
-				array := make([]int16, 0)
-				if err := util.JsonToObject(vs, &array); err != nil {
-					return err
-				}
-				result[f] = array
-			} else if kind == "[]int32" {
-				array := make([]int32, 0)
-				if err := util.JsonToObject(vs, &array); err != nil {
-					return err
-				}
-				result[f] = array
-			} else if kind == "[]int64" {
-				array := make([]int64, 0)
-				if err := util.JsonToObject(vs, &array); err != nil {
-					return err
-				}
-				result[f] = array
-			} else if kind == "[]interface {}" {
-				array := make([]interface{}, 0)
-				if err := util.JsonToObject(vs, &array); err != nil {
-					return err
-				}
-				result[f] = array
-			} else if kind == "[]string" {
-				array := make([]string, 0)
-				if err := util.JsonToObject(vs, &array); err != nil {
-					return err
-				}
-				result[f] = array
-			} else if kind == "map[string]interface {}" {
-				mmp := make(map[string]interface{})
-				if err := util.JsonToObject(vs, &mmp); err != nil {
-					return err
-				}
-				result[f] = mmp
-			} else if kind == "map[string]int" {
-				mmp := make(map[string]int)
-				if err := util.JsonToObject(vs, &mmp); err != nil {
-					return err
-				}
-				result[f] = mmp
-			} else if kind == "map[string]int8" {
-				mmp := make(map[string]int8)
-				if err := util.JsonToObject(vs, &mmp); err != nil {
-					return err
-				}
-				result[f] = mmp
-			} else if kind == "map[string]int16" {
-				mmp := make(map[string]int16)
-				if err := util.JsonToObject(vs, &mmp); err != nil {
-					return err
-				}
-				result[f] = mmp
-			} else if kind == "map[string]int32" {
-				mmp := make(map[string]int32)
-				if err := util.JsonToObject(vs, &mmp); err != nil {
-					return err
-				}
-				result[f] = mmp
-			} else if kind == "map[string]int64" {
-				mmp := make(map[string]int64)
-				if err := util.JsonToObject(vs, &mmp); err != nil {
-					return err
-				}
-				result[f] = mmp
-			} else if kind == "map[string]string" {
-				mmp := make(map[string]string)
-				if err := util.JsonToObject(vs, &mmp); err != nil {
-					return err
-				}
-				result[f] = mmp
-			} else {
-				return util.Error("对象字段[", f, "]转换失败([", kind, "]类型不支持)")
-			}
+		dest := make([]interface{}, len(col))
+		for i, _ := range result {
+			dest[i] = &result[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
 		}
-		valList = append(valList, result)
+		data = append(data, result)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	meta, err := GetModelMeta(model)
+	if err != nil {
+		return err
 	}
-	if len(valList) == 0 {
+	if len(data) == 0 {
 		return nil
 	}
+	fields := meta.columnFields(col)
 	if one {
-		if err := util.JsonToAny(valList[0], model); err != nil {
-			return err
-		}
-	} else {
-		if err := util.JsonToAny(valList, resultv); err != nil {
-			return err
-		}
+		return decodeOne(meta, fields, data[0], model)
 	}
-	return nil
+	return decodeList(meta, fields, data, resultv)
 }
 
 type FieldKeyKind struct {
@@ -1095,9 +1155,6 @@ func (self *RDBManager) FindList(cnd *sqlc.Cnd, data interface{}) error {
 	if reflect.TypeOf(data).Kind() != reflect.Ptr {
 		return self.Error("返回值必须为指针类型")
 	}
-	var fieldPart1, fieldPart2 bytes.Buffer
-	var valuePart = make([]interface{}, 0)
-	var fieldArray []reflect.StructField
 	var elem = cnd.Model
 	if elem == nil {
 		return self.Error("ORM对象类型不能为空,请通过M(...)方法设置对象类型")
@@ -1105,52 +1162,81 @@ func (self *RDBManager) FindList(cnd *sqlc.Cnd, data interface{}) error {
 	if util.TypeOf(data).Kind() != reflect.Slice {
 		return self.Error("返回结果必须为数组类型")
 	}
-	tof := util.TypeOf(elem)
-	if tof.Kind() != reflect.Struct && tof.Kind() != reflect.Ptr {
-		return self.Error("ORM对象类型必须为struct或ptr")
+	if router := self.getShardRouter(elem); router != nil {
+		return self.shardFindList(router, cnd, data)
 	}
-	for i := 0; i < tof.NumField(); i++ {
-		field := tof.Field(i)
-		if util.ValidIgnore(field) {
-			continue
-		}
-		fname := field.Tag.Get(sqlc.Bson)
-		if len(fname) == 0 {
-			return self.Error(util.AddStr("字段[", field.Name, "]无效bson标签"))
+	meta, fieldArray, limitSql, valuePart, err := self.buildFindList(cnd)
+	if err != nil {
+		return self.Error(err)
+	}
+	inv := self.invocation("FindList", elem, limitSql, valuePart, start)
+	inv.Result = data
+	columns, raws, err := self.queryRows(cnd, inv)
+	if err != nil {
+		return err
+	}
+	// 分页方言可能追加行号列,结果列与查询字段不一致时按列名匹配
+	if len(columns) != len(fieldArray) {
+		fieldArray = meta.columnFields(columns)
+	}
+	if err := decodeList(meta, fieldArray, raws, data); err != nil {
+		return self.Error(err)
+	}
+	if cnd.Keyset.Open {
+		orders, err := keysetOrders(meta, cnd)
+		if err != nil {
+			return self.Error(err)
 		}
-		if cnd != nil && len(cnd.AnyFields) > 0 {
-			for e := range cnd.AnyFields {
-				if field.Name == sqlc.Id && cnd.AnyFields[e] == sqlc.BsonId {
-					fieldPart1.WriteString(" id,")
-					fieldArray = append(fieldArray, field)
-					continue
-				}
-				if cnd.AnyFields[e] == fname {
-					fieldPart1.WriteString(" ")
-					fieldPart1.WriteString(fname)
-					fieldPart1.WriteString(",")
-					fieldArray = append(fieldArray, field)
-					continue
-				}
-			}
-		} else {
-			if field.Name == sqlc.Id {
-				fieldPart1.WriteString(" id,")
-				fieldArray = append(fieldArray, field)
-				continue
-			} else {
-				fieldPart1.WriteString(" ")
-				fieldPart1.WriteString(fname)
-				fieldPart1.WriteString(",")
-				fieldArray = append(fieldArray, field)
-				continue
-			}
+		if err := finishKeyset(cnd, orders, keysetSize(cnd), data); err != nil {
+			return self.Error(err)
 		}
 	}
+	if err := preload(self, cnd, data); err != nil {
+		return self.Error(err)
+	}
+	return runAfterFind(self, data)
+}
+
+// 构建列表查询语句,返回模型元数据,查询字段,分页语句及参数
+func (self *RDBManager) buildFindList(cnd *sqlc.Cnd) (*ModelMeta, []*FieldMeta, string, []interface{}, error) {
+	var fieldPart1, fieldPart2 bytes.Buffer
+	var valuePart = make([]interface{}, 0)
+	var elem = cnd.Model
+	meta, err := GetModelMeta(elem)
+	if err != nil {
+		return nil, nil, "", nil, err
+	}
+	if err := newIdentScope(meta).checkCnd(cnd); err != nil {
+		return nil, nil, "", nil, err
+	}
+	fieldArray, err := meta.selectFields(cnd.AnyFields)
+	if err != nil {
+		return nil, nil, "", nil, err
+	}
+	for _, field := range fieldArray {
+		fieldPart1.WriteString(" ")
+		fieldPart1.WriteString(self.quote(field.Column))
+		fieldPart1.WriteString(",")
+	}
 	part, args := self.BuildWhereCase(cnd)
 	for e := range args {
 		valuePart = append(valuePart, args[e])
 	}
+	// 游标分页追加边界条件,向前翻页时反向排序
+	sortCnd := cnd
+	if cnd.Keyset.Open {
+		orders, err := keysetOrders(meta, cnd)
+		if err != nil {
+			return nil, nil, "", nil, err
+		}
+		s, args, err := self.buildKeysetCase(cnd, orders)
+		if err != nil {
+			return nil, nil, "", nil, err
+		}
+		part.WriteString(s)
+		valuePart = append(valuePart, args...)
+		sortCnd = keysetCnd(cnd, orders)
+	}
 	if part.Len() > 0 {
 		fieldPart2.WriteString("where")
 		s := part.String()
@@ -1162,67 +1248,22 @@ func (self *RDBManager) FindList(cnd *sqlc.Cnd, data interface{}) error {
 	sqlbuf.WriteString("select ")
 	sqlbuf.WriteString(util.Substr(s1, 0, len(s1)-1))
 	sqlbuf.WriteString(" from ")
-	if tb, err := util.GetDbAndTb(elem); err != nil {
-		return self.Error(err)
+	if tb, err := self.tableName(elem); err != nil {
+		return nil, nil, "", nil, err
 	} else {
-		sqlbuf.WriteString(tb)
+		sqlbuf.WriteString(self.quote(tb))
 	}
 	sqlbuf.WriteString(" ")
 	sqlbuf.WriteString(util.Substr(s2, 0, len(s2)-1))
-	sortby := self.BuilSortBy(cnd)
+	sortby := self.BuilSortBy(sortCnd)
 	if len(sortby) > 0 {
 		sqlbuf.WriteString(sortby)
 	}
-	limitSql, err := self.BuildPagination(cnd, sqlbuf.String(), valuePart);
-	if err != nil {
-		return self.Error(err)
-	}
-	defer self.debug("FindList", sqlbuf.String(), valuePart, start)
-	var stmt *sql.Stmt
-	if self.AutoTx {
-		stmt, err = self.Tx.Prepare(limitSql)
-	} else {
-		stmt, err = self.Db.Prepare(limitSql)
-	}
-	if err != nil {
-		return self.Error(util.AddStr("预编译sql[", sqlbuf.String(), "]失败: ", err.Error()))
-	}
-	defer stmt.Close()
-	rows, err := stmt.Query(valuePart...)
-	if rows != nil {
-		defer rows.Close()
-	}
+	limitSql, err := self.BuildPagination(cnd, sqlbuf.String(), valuePart)
 	if err != nil {
-		return self.Error(util.AddStr("查询失败: ", err.Error()))
-	}
-	columns, err := rows.Columns()
-	if err != nil && len(columns) != len(fieldArray) {
-		return self.Error(util.AddStr("读取查询结果列长度失败: ", err.Error()))
-	}
-	raws, err := EchoResultRows(rows, len(columns))
-	if err != nil {
-		return self.Error(util.AddStr("读取查询结果失败: ", err.Error()))
-	}
-	resultv := reflect.ValueOf(data)
-	if resultv.Kind() != reflect.Ptr || resultv.Elem().Kind() != reflect.Slice {
-		return self.Error("列表结果参数必须是指针类型")
+		return nil, nil, "", nil, err
 	}
-	slicev := resultv.Elem()
-	slicev = slicev.Slice(0, slicev.Cap())
-	for i := 0; i < len(raws); i++ {
-		str, err := DataToMap(fieldArray, raws[i])
-		if err != nil {
-			return self.Error(err)
-		}
-		model := util.NewInstance(elem)
-		if err := util.JsonToObject(str, &model); err != nil {
-			return self.Error(err)
-		}
-		slicev = reflect.Append(slicev, reflect.ValueOf(model))
-	}
-	slicev = slicev.Slice(0, slicev.Cap())
-	resultv.Elem().Set(slicev.Slice(0, len(raws)))
-	return nil
+	return meta, fieldArray, limitSql, valuePart, nil
 }
 
 func (self *RDBManager) FindComplex(cnd *sqlc.Cnd, data interface{}) error {
@@ -1239,21 +1280,28 @@ func (self *RDBManager) FindComplex(cnd *sqlc.Cnd, data interface{}) error {
 	if len(cnd.AnyFields) == 0 {
 		return self.Error("查询字段不能为空")
 	}
-	var fieldPart1, fieldPart2 bytes.Buffer
+	var fieldPart2 bytes.Buffer
 	var valuePart = make([]interface{}, 0)
 	var elem = cnd.Model
 	if elem == nil {
 		return self.Error("ORM对象类型不能为空,请通过M(...)方法设置对象类型")
 	}
-	tof := util.TypeOf(elem)
-	if tof.Kind() != reflect.Struct && tof.Kind() != reflect.Ptr {
-		return self.Error("ORM对象类型必须为struct或ptr")
+	meta, err := GetModelMeta(elem)
+	if err != nil {
+		return self.Error(err)
 	}
-	for i := 0; i < len(cnd.AnyFields); i++ {
-		fieldPart1.WriteString(" ")
-		fieldPart1.WriteString(cnd.AnyFields[i])
-		fieldPart1.WriteString(",")
-		continue
+	// 字段,表名及连接条件按模型列名和声明的别名校验,表达式需使用sqlc.Raw
+	scope := newIdentScope(meta)
+	from, err := self.buildComplexFrom(cnd, scope)
+	if err != nil {
+		return self.Error(err)
+	}
+	fields, err := self.buildComplexFields(cnd, scope)
+	if err != nil {
+		return self.Error(err)
+	}
+	if err := scope.checkCnd(cnd); err != nil {
+		return self.Error(err)
 	}
 	part, args := self.BuildWhereCase(cnd)
 	for e := range args {
@@ -1264,35 +1312,12 @@ func (self *RDBManager) FindComplex(cnd *sqlc.Cnd, data interface{}) error {
 		s := part.String()
 		fieldPart2.WriteString(util.Substr(s, 0, len(s)-3))
 	}
-	s1 := fieldPart1.String()
 	s2 := fieldPart2.String()
 	var sqlbuf bytes.Buffer
 	sqlbuf.WriteString("select ")
-	sqlbuf.WriteString(util.Substr(s1, 0, len(s1)-1))
+	sqlbuf.WriteString(fields)
 	sqlbuf.WriteString(" from ")
-	sqlbuf.WriteString(cnd.FromCond.Table)
-	sqlbuf.WriteString(" ")
-	if len(cnd.JoinCond) > 0 {
-		for e := range cnd.JoinCond {
-			cond := cnd.JoinCond[e]
-			if len(cond.Table) == 0 || len(cond.On) == 0 {
-				continue
-			}
-			if cond.Type == sqlc.LEFT_ {
-				sqlbuf.WriteString(" left join ")
-			} else if cond.Type == sqlc.RIGHT_ {
-				sqlbuf.WriteString(" right join ")
-			} else if cond.Type == sqlc.INNER_ {
-				sqlbuf.WriteString(" inner join ")
-			} else {
-				continue
-			}
-			sqlbuf.WriteString(cond.Table)
-			sqlbuf.WriteString(" on ")
-			sqlbuf.WriteString(cond.On)
-			sqlbuf.WriteString(" ")
-		}
-	}
+	sqlbuf.WriteString(from)
 	sqlbuf.WriteString(util.Substr(s2, 0, len(s2)-1))
 	groupby := self.BuilGroupBy(cnd)
 	if len(groupby) > 0 {
@@ -1304,77 +1329,26 @@ func (self *RDBManager) FindComplex(cnd *sqlc.Cnd, data interface{}) error {
 		sqlbuf.WriteString(" ")
 		sqlbuf.WriteString(sortby)
 	}
-	limitSql, err := self.BuildPagination(cnd, sqlbuf.String(), valuePart);
+	limitSql, err := self.BuildPagination(cnd, sqlbuf.String(), valuePart)
 	if err != nil {
 		return self.Error(err)
 	}
-	defer self.debug("FindComplex", sqlbuf.String(), valuePart, start)
-	var stmt *sql.Stmt
-	if self.AutoTx {
-		stmt, err = self.Tx.Prepare(limitSql)
-	} else {
-		stmt, err = self.Db.Prepare(limitSql)
-	}
-	if err != nil {
-		return self.Error(util.AddStr("预编译sql[", sqlbuf.String(), "]失败: ", err.Error()))
-	}
-	defer stmt.Close()
-	rows, err := stmt.Query(valuePart...)
-	if rows != nil {
-		defer rows.Close()
-	}
-	if err != nil {
-		return self.Error(util.AddStr("查询失败: ", err.Error()))
+	inv := self.invocation("FindComplex", nil, limitSql, valuePart, start)
+	if table, _, err := parseTable(cnd.FromCond.Table); err == nil {
+		inv.Table, _ = sqlc.IsRaw(table)
 	}
-	columns, err := rows.Columns()
-	if err != nil && len(columns) != len(cnd.AnyFields) {
-		return self.Error(util.AddStr("读取查询结果列长度失败: ", err.Error()))
-	}
-	raws, err := EchoResultRows(rows, len(columns))
+	inv.Result = data
+	columns, raws, err := self.queryRows(cnd, inv)
 	if err != nil {
-		return self.Error(util.AddStr("读取查询结果失败: ", err.Error()))
-	}
-	var fieldArray []reflect.StructField
-	for e := range columns {
-		for i := 0; i < tof.NumField(); i++ {
-			field := tof.Field(i)
-			fname := field.Tag.Get(sqlc.Json)
-			if len(fname) == 0 {
-				return self.Error(util.AddStr("字段[", field.Name, "]无效json标签"))
-			}
-			if columns[e] == fname {
-				fieldArray = append(fieldArray, field)
-				continue
-			}
-		}
+		return err
 	}
+	fieldArray := meta.columnFields(columns)
 	if reflect.TypeOf(data).Elem().Kind() == reflect.Slice {
-		resultv := reflect.ValueOf(data)
-		if resultv.Kind() != reflect.Ptr || resultv.Elem().Kind() != reflect.Slice {
-			return self.Error("列表结果参数必须是指针类型")
-		}
-		slicev := resultv.Elem()
-		slicev = slicev.Slice(0, slicev.Cap())
-		for i := 0; i < len(raws); i++ {
-			str, err := DataToMap(fieldArray, raws[i])
-			if err != nil {
-				return self.Error(err)
-			}
-			model := util.NewInstance(elem)
-			if err := util.JsonToObject(str, &model); err != nil {
-				return self.Error(err)
-			}
-			slicev = reflect.Append(slicev, reflect.ValueOf(model))
-		}
-		slicev = slicev.Slice(0, slicev.Cap())
-		resultv.Elem().Set(slicev.Slice(0, len(raws)))
-	} else {
-		if len(raws) <= 0 {
-			return nil
-		}
-		if str, err := DataToMap(fieldArray, raws[0]); err != nil {
+		if err := decodeList(meta, fieldArray, raws, data); err != nil {
 			return self.Error(err)
-		} else if err := util.JsonToObject(str, data); err != nil {
+		}
+	} else if len(raws) > 0 {
+		if err := decodeOne(meta, fieldArray, raws[0], data); err != nil {
 			return self.Error(err)
 		}
 	}
@@ -1382,16 +1356,15 @@ func (self *RDBManager) FindComplex(cnd *sqlc.Cnd, data interface{}) error {
 }
 
 func (self *RDBManager) Close() error {
+	if len(self.shards) > 0 {
+		self.closeShards()
+	}
 	if self.AutoTx && self.Tx != nil {
+		self.savepoints = self.savepoints[:1]
 		if self.Errors != nil && len(self.Errors) > 0 {
-			if err := self.Tx.Rollback(); err != nil {
-				log.Println("事务回滚失败: ", err.Error())
-			}
-			return nil
-		} else {
-			if err := self.Tx.Commit(); err != nil {
-				log.Println("事务提交失败: ", err.Error())
-			}
+			return self.Rollback()
+		} else if err := self.Commit(); err != nil {
+			return err
 		}
 	}
 	if self.Errors == nil && len(self.Errors) == 0 && self.CacheSync && len(self.CacheObject) > 0 {
@@ -1406,20 +1379,45 @@ func (self *RDBManager) Close() error {
 			log.Print(err.Error())
 		}
 	}
+	if self.Errors == nil && len(self.Errors) == 0 && self.CacheSync && len(self.CacheUpsert) > 0 {
+		if err := self.mongoSyncUpsert(self.CacheUpsert...); err != nil {
+			log.Print(err.Error())
+		}
+	}
+	if self.Errors == nil && len(self.Errors) == 0 && self.CacheSync && len(self.CacheUpsCnd) > 0 {
+		for e := range self.CacheUpsCnd {
+			if err := self.mongoSyncUpsert2(self.CacheUpsCnd[e]); err != nil {
+				log.Print(err.Error())
+			}
+		}
+	}
+	if self.Errors == nil && len(self.Errors) == 0 && self.CacheSync && len(self.CacheDelete) > 0 {
+		if err := self.mongoSyncDelete(self.CacheDelete...); err != nil {
+			log.Print(err.Error())
+		}
+	}
+	if self.Errors == nil && len(self.Errors) == 0 && self.CacheSync && len(self.CacheDelCnd) > 0 {
+		for e := range self.CacheDelCnd {
+			if err := self.mongoSyncDelete2(self.CacheDelCnd[e]); err != nil {
+				log.Print(err.Error())
+			}
+		}
+	}
 	return nil
 }
 
 // mongo同步数据
 func (self *RDBManager) mongoSyncData(data interface{}) error {
-	if sync, err := util.ValidSyncMongo(data); err != nil {
+	if sync, err := validSyncMongo(data); err != nil {
 		return util.Error("实体字段异常: ", err.Error())
 	} else if sync {
-		mongo, err := new(MGOManager).Get(self.Option);
+		mongo, err := new(MGOManager).Get(self.Option)
 		if err != nil {
 			return util.Error("获取mongo连接失败: ", err.Error())
 		}
 		defer mongo.Close()
-		if err := mongo.Save(data); err != nil {
+		// 钩子已在关系数据库保存时执行,同步时不再重复执行
+		if err := mongo.save(data); err != nil {
 			if s, e := util.ObjectToJson(data); e != nil {
 				return util.Error("同步mongo数据失败,JSON对象转换失败: ", e.Error())
 			} else {
@@ -1432,10 +1430,10 @@ func (self *RDBManager) mongoSyncData(data interface{}) error {
 
 // mongo同步条件数据
 func (self *RDBManager) mongoSyncData2(cnd *sqlc.Cnd) error {
-	if sync, err := util.ValidSyncMongo(cnd.Model); err != nil {
+	if sync, err := validSyncMongo(cnd.Model); err != nil {
 		return util.Error("实体字段异常: ", err.Error())
 	} else if sync {
-		mongo, err := new(MGOManager).Get(self.Option);
+		mongo, err := new(MGOManager).Get(self.Option)
 		if err != nil {
 			return util.Error("获取mongo连接失败: ", err.Error())
 		}
@@ -1447,6 +1445,74 @@ func (self *RDBManager) mongoSyncData2(cnd *sqlc.Cnd) error {
 	return nil
 }
 
+// mongo同步新增或更新数据
+func (self *RDBManager) mongoSyncUpsert(datas ...interface{}) error {
+	if sync, err := validSyncMongo(datas[0]); err != nil {
+		return util.Error("实体字段异常: ", err.Error())
+	} else if sync {
+		mongo, err := new(MGOManager).Get(self.Option)
+		if err != nil {
+			return util.Error("获取mongo连接失败: ", err.Error())
+		}
+		defer mongo.Close()
+		if err := mongo.Upsert(datas...); err != nil {
+			return util.Error("同步mongo数据失败: ", err.Error())
+		}
+	}
+	return nil
+}
+
+// mongo同步条件新增或更新数据
+func (self *RDBManager) mongoSyncUpsert2(cnd *sqlc.Cnd) error {
+	if sync, err := validSyncMongo(cnd.Model); err != nil {
+		return util.Error("实体字段异常: ", err.Error())
+	} else if sync {
+		mongo, err := new(MGOManager).Get(self.Option)
+		if err != nil {
+			return util.Error("获取mongo连接失败: ", err.Error())
+		}
+		defer mongo.Close()
+		if err := mongo.UpsertByCnd(cnd); err != nil {
+			return util.Error("同步mongo数据失败: ", err.Error())
+		}
+	}
+	return nil
+}
+
+// mongo同步删除数据
+func (self *RDBManager) mongoSyncDelete(datas ...interface{}) error {
+	if sync, err := validSyncMongo(datas[0]); err != nil {
+		return util.Error("实体字段异常: ", err.Error())
+	} else if sync {
+		mongo, err := new(MGOManager).Get(self.Option)
+		if err != nil {
+			return util.Error("获取mongo连接失败: ", err.Error())
+		}
+		defer mongo.Close()
+		if err := mongo.delete("Delete", false, datas...); err != nil {
+			return util.Error("同步mongo删除数据失败: ", err.Error())
+		}
+	}
+	return nil
+}
+
+// mongo同步条件删除数据
+func (self *RDBManager) mongoSyncDelete2(cnd *sqlc.Cnd) error {
+	if sync, err := validSyncMongo(cnd.Model); err != nil {
+		return util.Error("实体字段异常: ", err.Error())
+	} else if sync {
+		mongo, err := new(MGOManager).Get(self.Option)
+		if err != nil {
+			return util.Error("获取mongo连接失败: ", err.Error())
+		}
+		defer mongo.Close()
+		if err := mongo.DeleteByCnd(cnd); err != nil {
+			return util.Error("同步mongo删除数据失败: ", err.Error())
+		}
+	}
+	return nil
+}
+
 // 结果集根据对象字段类型填充到map实例
 func DataToMap(fieldArray []reflect.StructField, raw [][]byte) (string, error) {
 	result := make(map[string]interface{})
@@ -1628,7 +1694,7 @@ func EchoResultRows(rows *sql.Rows, len int) ([][][]byte, error) {
 func (self *RDBManager) BuildCondKey(cnd *sqlc.Cnd, key string) string {
 	var fieldPart bytes.Buffer
 	fieldPart.WriteString(" ")
-	fieldPart.WriteString(key)
+	fieldPart.WriteString(self.quote(key))
 	return fieldPart.String()
 }
 
@@ -1710,11 +1776,15 @@ func (self *RDBManager) BuildWhereCase(cnd *sqlc.Cnd) (bytes.Buffer, []interface
 			fieldPart.WriteString(") and")
 		case sqlc.LIKE_:
 			fieldPart.WriteString(self.BuildCondKey(cnd, key))
-			fieldPart.WriteString(" like concat('%',?,'%') and")
+			fieldPart.WriteString(" like ")
+			fieldPart.WriteString(self.likeHolder())
+			fieldPart.WriteString(" and")
 			valuePart = append(valuePart, value)
 		case sqlc.NO_TLIKE_:
 			fieldPart.WriteString(self.BuildCondKey(cnd, key))
-			fieldPart.WriteString(" not like concat('%',?,'%') and")
+			fieldPart.WriteString(" not like ")
+			fieldPart.WriteString(self.likeHolder())
+			fieldPart.WriteString(" and")
 			valuePart = append(valuePart, value)
 		case sqlc.OR_:
 			var orpart bytes.Buffer
@@ -1743,6 +1813,15 @@ func (self *RDBManager) BuildWhereCase(cnd *sqlc.Cnd) (bytes.Buffer, []interface
 			}
 		}
 	}
+	// 存在逻辑删除字段时仅匹配未删除数据
+	if field, ok := getSoftDeleteField(cnd.Model); ok && !cnd.IsUnscoped {
+		fieldPart.WriteString(self.BuildCondKey(cnd, softDeleteKey(cnd, field.Column)))
+		fieldPart.WriteString(" = ? and")
+		valuePart = append(valuePart, 0)
+	}
+	for i := range valuePart {
+		valuePart[i] = encodeArg(valuePart[i])
+	}
 	return fieldPart, valuePart
 }
 
@@ -1758,7 +1837,7 @@ func (self *RDBManager) BuilGroupBy(cnd *sqlc.Cnd) string {
 			continue
 		}
 		groupby.WriteString(" ")
-		groupby.WriteString(cnd.Groupbys[e])
+		groupby.WriteString(self.quote(cnd.Groupbys[e]))
 		groupby.WriteString(",")
 	}
 	s := groupby.String()
@@ -1776,7 +1855,7 @@ func (self *RDBManager) BuilSortBy(cnd *sqlc.Cnd) string {
 	for e := range cnd.Orderbys {
 		orderby := cnd.Orderbys[e]
 		sortby.WriteString(" ")
-		sortby.WriteString(orderby.Key)
+		sortby.WriteString(self.quote(orderby.Key))
 		if orderby.Value == sqlc.DESC_ {
 			sortby.WriteString(" desc,")
 		} else if orderby.Value == sqlc.ASC_ {
@@ -1788,12 +1867,60 @@ func (self *RDBManager) BuilSortBy(cnd *sqlc.Cnd) string {
 	return s
 }
 
+// 按数据源驱动获取分页方言,未注册的驱动使用MySQL方言
+func (self *RDBManager) getDialect(pagination dialect.Dialect) dialect.IDialect {
+	if d := dialect.NewDialect(self.Driver, pagination); d != nil {
+		return d
+	}
+	return &dialect.MysqlDialect{Dialect: pagination}
+}
+
+// 模糊匹配占位符
+func (self *RDBManager) likeHolder() string {
+	switch self.Driver {
+	case POSTGRES, SQLITE:
+		return "'%' || ? || '%'"
+	}
+	return "concat('%',?,'%')"
+}
+
+// 按数据源驱动转换?占位符,PostgreSQL转换为$1,$2...,忽略引号内的?
+func (self *RDBManager) rebind(query string) string {
+	if self.Driver != POSTGRES || strings.IndexByte(query, '?') < 0 {
+		return query
+	}
+	var sqlbuf bytes.Buffer
+	var quote byte
+	n := 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+		} else if c == '\'' || c == '"' {
+			quote = c
+		} else if c == '?' {
+			n++
+			sqlbuf.WriteString("$")
+			sqlbuf.WriteString(strconv.Itoa(n))
+			continue
+		}
+		sqlbuf.WriteByte(c)
+	}
+	return sqlbuf.String()
+}
+
 // 构建分页命令
 func (self *RDBManager) BuildPagination(cnd *sqlc.Cnd, sqlbuf string, values []interface{}) (string, error) {
 	start := util.Time()
 	if cnd == nil {
 		return sqlbuf, nil
 	}
+	// 游标分页仅截取首段数据,不统计总条数
+	if cnd.Keyset.Open {
+		return self.getDialect(dialect.Dialect{PageSize: keysetSize(cnd), IsOffset: true}).GetLimitSql(sqlbuf)
+	}
 	pagination := cnd.Pagination
 	if pagination.PageNo == 0 && pagination.PageSize == 0 {
 		return sqlbuf, nil
@@ -1801,37 +1928,56 @@ func (self *RDBManager) BuildPagination(cnd *sqlc.Cnd, sqlbuf string, values []i
 	if pagination.PageSize <= 0 {
 		pagination.PageSize = 10
 	}
-	dialect := dialect.MysqlDialect{pagination}
+	dialect := self.getDialect(pagination)
 	limitSql, err := dialect.GetLimitSql(sqlbuf)
 	if err != nil {
 		return "", err
 	}
-	if !dialect.IsOffset {
+	if !pagination.IsOffset {
 		countSql, err := dialect.GetCountSql(sqlbuf)
-		defer self.debug("PageCountSql", countSql, values, start)
 		if err != nil {
 			return "", err
 		}
-		var rows *sql.Rows
-		if self.AutoTx {
-			rows, err = self.Tx.Query(countSql, values...)
-		} else {
-			rows, err = self.Db.Query(countSql, values...)
-		}
-		if rows != nil {
-			defer rows.Close()
-		}
+		var pageTotal int64
+		key, hit, err := self.getByCache(cnd, countSql, values, true, &pageTotal)
 		if err != nil {
-			return "", self.Error(util.AddStr("Count查询失败: ", err.Error()))
+			return "", err
 		}
-		var pageTotal int64
-		for rows.Next() {
-			if err := rows.Scan(&pageTotal); err != nil {
-				return "", self.Error(util.AddStr("匹配结果异常: ", err.Error()))
-			}
+		inv := self.invocation("PageCountSql", cnd.Model, countSql, values, start)
+		if hit {
+			inv.Op = "PageCountSql by Cache"
 		}
-		if err := rows.Err(); err != nil {
-			return "", self.Error(util.Error("读取查询结果失败: ", err.Error()))
+		err = self.intercept(inv, func(inv *Invocation) error {
+			if hit {
+				return nil
+			}
+			var rows *sql.Rows
+			var err error
+			if self.AutoTx {
+				rows, err = self.Tx.QueryContext(self.getContext(), self.rebind(inv.SQL), inv.Args...)
+			} else {
+				rows, err = self.queryRead(self.rebind(inv.SQL), inv.Args...)
+			}
+			if rows != nil {
+				defer rows.Close()
+			}
+			if err != nil {
+				return self.ctxError(err, "Count查询失败: ")
+			}
+			for rows.Next() {
+				if err := rows.Scan(&pageTotal); err != nil {
+					return self.ctxError(err, "匹配结果异常: ")
+				}
+			}
+			if err := rows.Err(); err != nil {
+				return self.ctxError(err, "读取查询结果失败: ")
+			}
+			return nil
+		})
+		if err != nil {
+			return "", err
+		} else if !hit {
+			self.putByCache(cnd, key, pageTotal)
 		}
 		var pageCount int64
 		if pageTotal%cnd.Pagination.PageSize == 0 {
@@ -1845,8 +1991,9 @@ func (self *RDBManager) BuildPagination(cnd *sqlc.Cnd, sqlbuf string, values []i
 	return limitSql, nil
 }
 
-// 添加缓存同步对象
+// 添加缓存同步对象,同时使查询缓存失效
 func (self *RDBManager) AddCacheSync(models ...interface{}) error {
+	self.expireCache(models...)
 	if self.CacheSync && models != nil && len(models) > 0 {
 		for e := range models {
 			self.CacheObject = append(self.CacheObject, models[e])
@@ -1855,28 +2002,57 @@ func (self *RDBManager) AddCacheSync(models ...interface{}) error {
 	return nil
 }
 
-// 添加缓存同步对象
+// 添加缓存同步对象,同时使查询缓存失效
 func (self *RDBManager) AddCacheSync2(cnd *sqlc.Cnd) error {
+	if cnd != nil {
+		self.expireCache(cnd.Model)
+	}
 	if self.CacheSync && cnd.UpdateKV != nil && len(cnd.UpdateKV) > 0 {
 		self.CacheCnd = cnd
 	}
 	return nil
 }
 
-func (self *RDBManager) debug(title, sql string, values interface{}, start int64) {
-	cost := util.Time() - start
-	if self.SlowQuery > 0 && cost > self.SlowQuery {
-		if title == "Count" || title == "FindOne" || title == "FindList" || title == "UpdateByCnd" {
-			l := self.getSlowLog()
-			if l != nil {
-				l.Warn(title, log.Int64("cost", cost), log.String("sql", sql), log.Any("value", values))
-			}
+// 添加缓存同步新增或更新对象,同时使查询缓存失效
+func (self *RDBManager) AddCacheUpsert(models ...interface{}) error {
+	self.expireCache(models...)
+	if self.CacheSync && models != nil && len(models) > 0 {
+		for e := range models {
+			self.CacheUpsert = append(self.CacheUpsert, models[e])
 		}
 	}
-	if self.Debug {
-		if self.Debug {
-			str, _ := util.ObjectToJson(values)
-			log.Println(util.AddStr("mysql debug -> ", title, ": ", sql, " --- ", str, " --- cost: ", util.AnyToStr(util.Time()-start)))
+	return nil
+}
+
+// 添加缓存同步新增或更新条件,同时使查询缓存失效
+func (self *RDBManager) AddCacheUpsCnd(cnd *sqlc.Cnd) error {
+	if cnd != nil {
+		self.expireCache(cnd.Model)
+	}
+	if self.CacheSync && cnd != nil {
+		self.CacheUpsCnd = append(self.CacheUpsCnd, cnd)
+	}
+	return nil
+}
+
+// 添加缓存同步删除对象,同时使查询缓存失效
+func (self *RDBManager) AddCacheDelete(models ...interface{}) error {
+	self.expireCache(models...)
+	if self.CacheSync && models != nil && len(models) > 0 {
+		for e := range models {
+			self.CacheDelete = append(self.CacheDelete, models[e])
 		}
 	}
+	return nil
+}
+
+// 添加缓存同步删除条件,同时使查询缓存失效
+func (self *RDBManager) AddCacheDelCnd(cnd *sqlc.Cnd) error {
+	if cnd != nil {
+		self.expireCache(cnd.Model)
+	}
+	if self.CacheSync && cnd != nil {
+		self.CacheDelCnd = append(self.CacheDelCnd, cnd)
+	}
+	return nil
 }
@@ -0,0 +1,149 @@
+package sqld
+
+import (
+	"bytes"
+	"database/sql"
+	"github.com/godaddy-x/jorm/sqlc"
+	"github.com/godaddy-x/jorm/util"
+	"reflect"
+)
+
+var (
+	BatchMaxArgs = map[string]int{ // 批量保存单条语句最大占位符数量,按数据库驱动区分,未配置时按MySQL
+		MYSQL:    65535,
+		POSTGRES: 65535,
+		SQLITE:   32766,
+	}
+	BatchMaxPacket = 4 << 20 // 批量保存单条语句最大字节数,需小于数据库max_allowed_packet
+)
+
+// 获取当前驱动批量保存单条语句最大占位符数量
+func (self *RDBManager) batchMaxArgs() int {
+	if n, b := BatchMaxArgs[self.Driver]; b && n > 0 {
+		return n
+	}
+	return BatchMaxArgs[MYSQL]
+}
+
+// 批量保存数据块
+type batchChunk struct {
+	fields   string
+	holders  string
+	values   []interface{}
+	idValues []reflect.Value
+	size     int
+}
+
+// 批量保存数据,按字段列表分组并根据占位符数量和数据包大小自动拆分为多条insert into t (...) values (...),(...)
+// 非自主ID模式下按LastInsertId顺序回填ID,需保证数据库自增ID连续分配(如innodb_autoinc_lock_mode=0/1),PostgreSQL按returning结果回填
+func (self *RDBManager) saveBatch(datas ...interface{}) error {
+	maxArgs := self.batchMaxArgs()
+	var tb string
+	var chunks []*batchChunk
+	var chunk *batchChunk
+	for e := range datas {
+		data := datas[e]
+		if data == nil {
+			return self.Error("参数元素不能为空")
+		}
+		if reflect.ValueOf(data).Kind() != reflect.Ptr {
+			return self.Error("参数值必须为指针类型")
+		}
+		if reflect.TypeOf(data) != reflect.TypeOf(datas[0]) {
+			return self.Error("参数列表对象类型必须一致")
+		}
+		if len(tb) == 0 {
+			if s, err := self.tableName(data); err != nil {
+				return self.Error(err)
+			} else {
+				tb = s
+			}
+		}
+		columns, holders, valuePart, idValue, err := self.buildInsertPart(data, len(self.shardTable) > 0)
+		if err != nil {
+			return self.Error(err)
+		}
+		fields := self.quoteColumns(columns)
+		size := len(holders) + 3
+		for i := range valuePart {
+			switch v := valuePart[i].(type) {
+			case string:
+				size += len(v)
+			case []byte:
+				size += len(v)
+			default:
+				size += 8
+			}
+		}
+		if chunk == nil || chunk.fields != fields || len(chunk.values)+len(valuePart) > maxArgs || chunk.size+size > BatchMaxPacket {
+			chunk = &batchChunk{fields: fields, holders: holders, size: len(tb) + len(fields) + 30}
+			chunks = append(chunks, chunk)
+		}
+		chunk.values = append(chunk.values, valuePart...)
+		chunk.idValues = append(chunk.idValues, idValue)
+		chunk.size += size
+	}
+	for e := range chunks {
+		if err := self.execBatch(tb, chunks[e]); err != nil {
+			return err
+		}
+	}
+	return self.AddCacheSync(datas...)
+}
+
+// 执行批量保存数据块
+func (self *RDBManager) execBatch(tb string, chunk *batchChunk) error {
+	start := util.Time()
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString("insert into ")
+	sqlbuf.WriteString(self.quote(tb))
+	sqlbuf.WriteString(" (")
+	sqlbuf.WriteString(chunk.fields)
+	sqlbuf.WriteString(") values ")
+	for i := range chunk.idValues {
+		if i > 0 {
+			sqlbuf.WriteString(",")
+		}
+		sqlbuf.WriteString("(")
+		sqlbuf.WriteString(chunk.holders)
+		sqlbuf.WriteString(")")
+	}
+	if self.returningId() {
+		sqlbuf.WriteString(" returning ")
+		sqlbuf.WriteString(self.quote(sqlc.BsonId))
+	}
+	inv := &Invocation{Op: "SaveBatch", Driver: self.Driver, Table: tb, SQL: sqlbuf.String(), Args: chunk.values, Start: start}
+	if self.returningId() {
+		return self.query(inv, false, func(rows *sql.Rows) error {
+			if rowsAffected, err := scanReturning(rows, chunk.idValues); err != nil {
+				return self.ctxError(err, "批量保存数据失败: ")
+			} else if rowsAffected < int64(len(chunk.idValues)) {
+				return self.Error(util.AddStr("批量保存数据失败: 受影响行数 -> ", util.AnyToStr(rowsAffected)))
+			}
+			return nil
+		})
+	}
+	return self.exec(inv, "批量保存数据失败: ", func(ret sql.Result) error {
+		if rowsAffected, err := ret.RowsAffected(); err != nil {
+			return self.ctxError(err, "批量保存数据失败: ")
+		} else if rowsAffected < int64(len(chunk.idValues)) {
+			return self.Error(util.AddStr("批量保存数据失败: 受影响行数 -> ", util.AnyToStr(rowsAffected)))
+		}
+		if !self.AutoID {
+			if lastInsertId, err := ret.LastInsertId(); err != nil {
+				return self.ctxError(err, "批量保存数据失败: ")
+			} else if lastInsertId > 0 {
+				// MySQL返回首行ID,SQLite返回末行ID
+				if self.Driver == SQLITE {
+					lastInsertId -= int64(len(chunk.idValues) - 1)
+				}
+				for i := range chunk.idValues {
+					if chunk.idValues[i].IsValid() {
+						chunk.idValues[i].SetInt(lastInsertId + int64(i))
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
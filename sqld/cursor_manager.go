@@ -0,0 +1,245 @@
+package sqld
+
+import (
+	"database/sql"
+	"github.com/godaddy-x/jorm/sqlc"
+	"github.com/godaddy-x/jorm/util"
+	"gopkg.in/mgo.v2"
+	"reflect"
+)
+
+/********************************** 游标遍历实现 **********************************/
+
+// 游标对象,逐行读取查询结果,使用完毕必须调用Close释放连接
+type Cursor struct {
+	db      IDBase
+	rows    *sql.Rows
+	stmt    func(err error) // 释放预编译语句
+	meta    *ModelMeta
+	fields  []*FieldMeta
+	raw     [][]byte
+	dest    []interface{}
+	iter    *mgo.Iter
+	release func()
+	err     error
+	closed  bool
+}
+
+// 读取下一行数据到data,无数据或异常时返回false
+func (self *Cursor) Next(data interface{}) bool {
+	if self.closed || self.err != nil || (self.iter == nil && self.rows == nil) {
+		return false
+	}
+	if self.iter != nil {
+		if !self.iter.Next(data) {
+			if err := self.iter.Err(); err != nil {
+				self.fail(util.Error("mongo读取查询结果失败: ", err.Error()))
+			}
+			return false
+		}
+	} else {
+		if !self.rows.Next() {
+			if err := self.rows.Err(); err != nil {
+				self.fail(util.Error("读取查询结果失败: ", err.Error()))
+			}
+			return false
+		}
+		if err := self.rows.Scan(self.dest...); err != nil {
+			self.fail(util.Error("数据结果匹配异常: ", err.Error()))
+			return false
+		}
+		if err := decodeOne(self.meta, self.fields, self.raw, data); err != nil {
+			self.fail(err)
+			return false
+		}
+	}
+	if err := runAfterFind(self.db, data); err != nil {
+		self.err = err
+		return false
+	}
+	return true
+}
+
+// 游标遍历异常
+func (self *Cursor) Err() error {
+	return self.err
+}
+
+// 关闭游标,释放连接或会话,事务模式下事务由管理器Close结束
+func (self *Cursor) Close() error {
+	if self.closed {
+		return self.err
+	}
+	self.closed = true
+	if self.iter != nil {
+		if err := self.iter.Close(); err != nil && self.err == nil {
+			self.fail(util.Error("mongo关闭游标失败: ", err.Error()))
+		}
+	}
+	var rerr error
+	if self.rows != nil {
+		// 游标异常已转换为文本,按结果集原始异常判断是否连接异常
+		rerr = self.rows.Err()
+		self.rows.Close()
+	}
+	if self.stmt != nil {
+		self.stmt(rerr)
+	}
+	if self.release != nil {
+		self.release()
+	}
+	return self.err
+}
+
+func (self *Cursor) fail(err error) {
+	self.err = err
+	if self.db != nil {
+		self.db.Error(err)
+	}
+}
+
+// 遍历游标,每行创建model类型新对象回调fn,fn返回ErrStopEach时正常中止
+func eachCursor(cursor *Cursor, model interface{}, fn func(row interface{}) error) error {
+	defer cursor.Close()
+	tof := util.TypeOf(model)
+	for tof.Kind() == reflect.Ptr {
+		tof = tof.Elem()
+	}
+	for {
+		row := reflect.New(tof).Interface()
+		if !cursor.Next(row) {
+			break
+		}
+		if err := fn(row); err != nil {
+			if err == ErrStopEach {
+				return nil
+			}
+			return cursor.db.Error(err)
+		}
+	}
+	return cursor.Close()
+}
+
+// 按条件打开游标,分片模型仅支持路由至单一分片的条件
+func (self *RDBManager) FindCursor(cnd *sqlc.Cnd) (*Cursor, error) {
+	start := util.Time()
+	if cnd == nil {
+		return nil, self.Error("条件参数不能为空")
+	}
+	if cnd.Model == nil {
+		return nil, self.Error("ORM对象类型不能为空,请通过M(...)方法设置对象类型")
+	}
+	if router := self.getShardRouter(cnd.Model); router != nil {
+		routes, err := router.routeCnd(cnd)
+		if err != nil {
+			return nil, self.Error(err)
+		}
+		if len(routes) != 1 {
+			return nil, self.Error("分片模型游标查询条件必须包含分片键")
+		}
+		var cursor *Cursor
+		err = self.withShard(routes[0], false, func(db *RDBManager) error {
+			var err error
+			cursor, err = db.FindCursor(cnd)
+			return err
+		})
+		return cursor, err
+	}
+	meta, fieldArray, limitSql, valuePart, err := self.buildFindList(cnd)
+	if err != nil {
+		return nil, self.Error(err)
+	}
+	cursor := &Cursor{db: self, meta: meta, fields: fieldArray}
+	err = self.intercept(self.invocation("FindCursor", cnd.Model, limitSql, valuePart, start), func(inv *Invocation) error {
+		rows, release, err := self.openRows(inv.SQL, true, inv.Args)
+		if err != nil {
+			return err
+		}
+		cursor.stmt = release
+		cursor.rows = rows
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	} else if cursor.rows == nil {
+		return cursor, nil
+	}
+	columns, err := cursor.rows.Columns()
+	if err != nil {
+		cursor.Close()
+		return nil, self.ctxError(err, "读取查询结果列失败: ")
+	}
+	if len(columns) != len(fieldArray) {
+		cursor.fields = meta.columnFields(columns)
+	}
+	cursor.raw = make([][]byte, len(columns))
+	cursor.dest = make([]interface{}, len(columns))
+	for i := range cursor.raw {
+		cursor.dest[i] = &cursor.raw[i]
+	}
+	return cursor, nil
+}
+
+// 按条件逐行遍历数据,fn返回ErrStopEach时中止遍历
+func (self *RDBManager) FindEach(cnd *sqlc.Cnd, model interface{}, fn func(row interface{}) error) error {
+	if model == nil || fn == nil {
+		return self.Error("对象类型和回调函数不能为空")
+	}
+	cursor, err := self.FindCursor(cnd)
+	if err != nil {
+		return err
+	}
+	return eachCursor(cursor, model, fn)
+}
+
+// 按条件打开游标,不使用查询缓存
+func (self *MGOManager) FindCursor(cnd *sqlc.Cnd) (*Cursor, error) {
+	start := util.Time()
+	if cnd == nil {
+		return nil, self.Error("条件参数不能为空")
+	}
+	if cnd.Model == nil {
+		return nil, self.Error("ORM对象类型不能为空,请通过M(...)方法设置对象类型")
+	}
+	copySession, release, err := self.copySession()
+	if err != nil {
+		return nil, err
+	}
+	db, err := self.GetDatabase(copySession, cnd.Model)
+	if err != nil {
+		release()
+		return nil, self.Error(err)
+	}
+	pipe, err := self.buildPipeCondition(cnd, false)
+	if err != nil {
+		release()
+		return nil, self.Error(util.AddStr("mongo构建查询命令失败: ", err.Error()))
+	}
+	cursor := &Cursor{db: mgoHookDB{self}, release: release}
+	err = self.intercept(self.invocation("FindCursor", cnd.Model, pipe, start), func(inv *Invocation) error {
+		iter := db.Pipe(inv.Pipe).Iter()
+		if err := iter.Err(); err != nil {
+			iter.Close()
+			return self.ctxError(err, "mongo查询数据失败: ")
+		}
+		cursor.iter = iter
+		return nil
+	})
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return cursor, nil
+}
+
+// 按条件逐行遍历数据,fn返回ErrStopEach时中止遍历
+func (self *MGOManager) FindEach(cnd *sqlc.Cnd, model interface{}, fn func(row interface{}) error) error {
+	if model == nil || fn == nil {
+		return self.Error("对象类型和回调函数不能为空")
+	}
+	cursor, err := self.FindCursor(cnd)
+	if err != nil {
+		return err
+	}
+	return eachCursor(cursor, model, fn)
+}
@@ -0,0 +1,99 @@
+package sqld
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"github.com/godaddy-x/jorm/sqlc"
+	"io"
+	"testing"
+)
+
+// 内存测试驱动,每次查询返回固定结果集
+type cursorDriver struct{}
+
+type cursorConn struct{}
+
+type cursorStmt struct{}
+
+type cursorRows struct {
+	index int
+}
+
+var cursorRowsClosed int
+
+func (self cursorDriver) Open(name string) (driver.Conn, error) { return cursorConn{}, nil }
+
+func (self cursorConn) Prepare(query string) (driver.Stmt, error) { return cursorStmt{}, nil }
+
+func (self cursorConn) Close() error { return nil }
+
+func (self cursorConn) Begin() (driver.Tx, error) { return nil, io.EOF }
+
+func (self cursorStmt) Close() error { return nil }
+
+func (self cursorStmt) NumInput() int { return -1 }
+
+func (self cursorStmt) Exec(args []driver.Value) (driver.Result, error) { return nil, io.EOF }
+
+func (self cursorStmt) Query(args []driver.Value) (driver.Rows, error) { return &cursorRows{}, nil }
+
+func (self *cursorRows) Columns() []string { return []string{"id", "app_id", "balance", "remark"} }
+
+func (self *cursorRows) Close() error {
+	cursorRowsClosed++
+	return nil
+}
+
+func (self *cursorRows) Next(dest []driver.Value) error {
+	if self.index >= 3 {
+		return io.EOF
+	}
+	self.index++
+	dest[0] = []byte{byte('0' + self.index)}
+	dest[1] = []byte("app")
+	dest[2] = []byte("1.5")
+	dest[3] = nil
+	return nil
+}
+
+func init() {
+	sql.Register("sqld_cursor", cursorDriver{})
+}
+
+func TestFindEach(t *testing.T) {
+	db, err := sql.Open("sqld_cursor", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	manager := &RDBManager{Db: db, Driver: MYSQL}
+	ids := make([]int64, 0)
+	err = manager.FindEach(sqlc.M(&rawWallet{}), &rawWallet{}, func(row interface{}) error {
+		wallet := row.(*rawWallet)
+		ids = append(ids, wallet.Id)
+		if wallet.AppID != "app" || wallet.Balance != 1.5 || wallet.Remark != nil {
+			t.Errorf("unexpected row: %+v", wallet)
+		}
+		if len(ids) == 2 {
+			return ErrStopEach
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[1] != 2 || cursorRowsClosed != 1 {
+		t.Errorf("expected early stop with rows closed, got: %v %d", ids, cursorRowsClosed)
+	}
+	cursor, err := manager.FindCursor(sqlc.M(&rawWallet{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for wallet := new(rawWallet); cursor.Next(wallet); wallet = new(rawWallet) {
+		count++
+	}
+	if err := cursor.Close(); err != nil || count != 3 || cursorRowsClosed != 2 {
+		t.Errorf("unexpected cursor iteration: %d %v", count, err)
+	}
+}
@@ -0,0 +1,133 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/jorm/util"
+	"reflect"
+)
+
+/********************************** 模型生命周期钩子实现 **********************************/
+
+// 保存前钩子,返回异常时中止保存
+type IBeforeSave interface {
+	BeforeSave(db IDBase) error
+}
+
+// 保存后钩子
+type IAfterSave interface {
+	AfterSave(db IDBase) error
+}
+
+// 更新前钩子,返回异常时中止更新
+type IBeforeUpdate interface {
+	BeforeUpdate(db IDBase) error
+}
+
+// 更新后钩子
+type IAfterUpdate interface {
+	AfterUpdate(db IDBase) error
+}
+
+// 删除前钩子,返回异常时中止删除
+type IBeforeDelete interface {
+	BeforeDelete(db IDBase) error
+}
+
+// 删除后钩子
+type IAfterDelete interface {
+	AfterDelete(db IDBase) error
+}
+
+// 查询后钩子
+type IAfterFind interface {
+	AfterFind() error
+}
+
+// 钩子类型
+const (
+	beforeSave = iota
+	afterSave
+	beforeUpdate
+	afterUpdate
+	beforeDelete
+	afterDelete
+)
+
+// 执行对象钩子,异常时中止后续操作并记录至Errors,事务模式下Close时回滚
+func runHooks(db IDBase, hook int, datas ...interface{}) error {
+	for _, data := range datas {
+		var err error
+		switch hook {
+		case beforeSave:
+			if v, ok := data.(IBeforeSave); ok {
+				err = v.BeforeSave(db)
+			}
+		case afterSave:
+			if v, ok := data.(IAfterSave); ok {
+				err = v.AfterSave(db)
+			}
+		case beforeUpdate:
+			if v, ok := data.(IBeforeUpdate); ok {
+				err = v.BeforeUpdate(db)
+			}
+		case afterUpdate:
+			if v, ok := data.(IAfterUpdate); ok {
+				err = v.AfterUpdate(db)
+			}
+		case beforeDelete:
+			if v, ok := data.(IBeforeDelete); ok {
+				err = v.BeforeDelete(db)
+			}
+		case afterDelete:
+			if v, ok := data.(IAfterDelete); ok {
+				err = v.AfterDelete(db)
+			}
+		}
+		if err != nil {
+			return db.Error(err)
+		}
+	}
+	return nil
+}
+
+// 执行查询后钩子,data为对象指针或切片指针
+func runAfterFind(db IDBase, data interface{}) error {
+	vof := reflect.ValueOf(data)
+	if vof.Kind() != reflect.Ptr || vof.IsNil() {
+		return nil
+	}
+	if vof.Elem().Kind() != reflect.Slice {
+		if v, ok := data.(IAfterFind); ok {
+			if err := v.AfterFind(); err != nil {
+				return db.Error(err)
+			}
+		}
+		return nil
+	}
+	slice := vof.Elem()
+	for i := 0; i < slice.Len(); i++ {
+		elem := slice.Index(i)
+		if elem.Kind() != reflect.Ptr {
+			elem = elem.Addr()
+		} else if elem.IsNil() {
+			continue
+		}
+		if v, ok := elem.Interface().(IAfterFind); ok {
+			if err := v.AfterFind(); err != nil {
+				return db.Error(err)
+			}
+		}
+	}
+	return nil
+}
+
+// mongo钩子数据库参数,适配IDBase.InitConfig方法签名
+type mgoHookDB struct {
+	*MGOManager
+}
+
+func (self mgoHookDB) InitConfig(input interface{}) error {
+	if conf, ok := input.(MGOConfig); ok {
+		return self.MGOManager.InitConfig(conf)
+	}
+	return util.Error("mongo配置参数类型必须为MGOConfig")
+}
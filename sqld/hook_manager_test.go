@@ -0,0 +1,49 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/jorm/util"
+	"testing"
+)
+
+type hookWallet struct {
+	Id    int64  `json:"id" bson:"_id" tb:"hook_wallet"`
+	Alias string `json:"alias" bson:"alias"`
+	Label string `json:"label" bson:"label" ignore:"true"`
+}
+
+func (self *hookWallet) BeforeSave(db IDBase) error {
+	if len(self.Alias) == 0 {
+		return util.Error("钱包别名不能为空")
+	}
+	return nil
+}
+
+func (self *hookWallet) AfterFind() error {
+	self.Label = util.AddStr("[", self.Alias, "]")
+	return nil
+}
+
+func TestRunHooks(t *testing.T) {
+	db := &RDBManager{}
+	if err := runHooks(db, beforeSave, &hookWallet{Alias: "a"}, &hookWallet{}); err == nil {
+		t.Error("expected BeforeSave error")
+	}
+	if len(db.Errors) != 1 {
+		t.Errorf("expected hook error recorded, got: %v", db.Errors)
+	}
+	if err := db.Save(&hookWallet{}); err == nil || len(db.Errors) != 2 {
+		t.Errorf("expected Save aborted by BeforeSave, got: %v", err)
+	}
+	one := hookWallet{Alias: "one"}
+	if err := runAfterFind(db, &one); err != nil || one.Label != "[one]" {
+		t.Errorf("unexpected AfterFind result: %s %v", one.Label, err)
+	}
+	list := []hookWallet{{Alias: "a"}, {Alias: "b"}}
+	ptrs := []*hookWallet{{Alias: "c"}, nil}
+	if err := runAfterFind(db, &list); err != nil || list[0].Label != "[a]" || list[1].Label != "[b]" {
+		t.Errorf("unexpected AfterFind list result: %+v %v", list, err)
+	}
+	if err := runAfterFind(db, &ptrs); err != nil || ptrs[0].Label != "[c]" {
+		t.Errorf("unexpected AfterFind pointer list result: %+v %v", ptrs[0], err)
+	}
+}
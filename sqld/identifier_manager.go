@@ -0,0 +1,308 @@
+package sqld
+
+import (
+	"bytes"
+	"github.com/godaddy-x/jorm/sqlc"
+	"github.com/godaddy-x/jorm/util"
+	"regexp"
+	"strings"
+)
+
+/********************************** 标识符校验实现 **********************************/
+
+var (
+	identRegexp  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	joinOnRegexp = regexp.MustCompile(`^([A-Za-z0-9_.]+)\s*(=|<>|!=|<=|>=|<|>)\s*([A-Za-z0-9_.]+)$`)
+	andRegexp    = regexp.MustCompile(`(?i)\s+and\s+`)
+)
+
+// 标识符校验范围,字段仅允许模型列名,已声明的表别名及查询字段别名
+type identScope struct {
+	meta    *ModelMeta
+	aliases map[string]bool // 表名或别名(小写),值为是否模型主表
+	selects map[string]bool // 查询字段别名(小写)
+}
+
+func newIdentScope(meta *ModelMeta) *identScope {
+	scope := &identScope{meta: meta, aliases: make(map[string]bool), selects: make(map[string]bool)}
+	if len(meta.Table) > 0 {
+		scope.aliases[strings.ToLower(meta.Table)] = true
+	}
+	return scope
+}
+
+// 校验列引用col或alias.col,selectAlias为true时允许查询字段别名
+func (self *identScope) checkColumn(key string, selectAlias bool) error {
+	if _, ok := sqlc.IsRaw(key); ok {
+		return nil
+	}
+	parts := strings.Split(key, ".")
+	switch {
+	case len(parts) == 1 && identRegexp.MatchString(key):
+		if self.meta.hasColumn(key) || (selectAlias && self.selects[strings.ToLower(key)]) {
+			return nil
+		}
+		return util.Error("字段[", key, "]不存在")
+	case len(parts) == 2 && identRegexp.MatchString(parts[0]) && identRegexp.MatchString(parts[1]):
+		isModel, ok := self.aliases[strings.ToLower(parts[0])]
+		if !ok {
+			return util.Error("表别名[", parts[0], "]不存在")
+		}
+		if isModel && !self.meta.hasColumn(parts[1]) {
+			return util.Error("字段[", key, "]不存在")
+		}
+		return nil
+	}
+	return util.Error("非法字段[", key, "],表达式请使用sqlc.Raw")
+}
+
+// 校验条件,排序,分组及更新字段
+func (self *identScope) checkCnd(cnd *sqlc.Cnd) error {
+	if err := self.checkConditions(cnd.Conditions); err != nil {
+		return err
+	}
+	for _, orderby := range cnd.Orderbys {
+		if err := self.checkColumn(orderby.Key, true); err != nil {
+			return err
+		}
+	}
+	for _, groupby := range cnd.Groupbys {
+		if err := self.checkColumn(groupby, true); err != nil {
+			return err
+		}
+	}
+	for k := range cnd.UpdateKV {
+		if _, ok := sqlc.IsRaw(k); ok || !identRegexp.MatchString(k) || !self.meta.hasColumn(k) {
+			return util.Error("更新字段[", k, "]不存在")
+		}
+	}
+	return nil
+}
+
+func (self *identScope) checkConditions(conditions []sqlc.Condition) error {
+	for _, condit := range conditions {
+		if condit.Logic != sqlc.OR_ {
+			if err := self.checkColumn(condit.Key, false); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, v := range condit.Values {
+			if cnd, ok := v.(*sqlc.Cnd); ok {
+				if err := self.checkConditions(cnd.Conditions); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// 校验单表操作条件
+func (self *RDBManager) checkIdents(cnd *sqlc.Cnd) error {
+	meta, err := GetModelMeta(cnd.Model)
+	if err != nil {
+		return err
+	}
+	return newIdentScope(meta).checkCnd(cnd)
+}
+
+// 解析表名及别名,支持"table","table alias"及"table as alias"
+func parseTable(spec string) (string, string, error) {
+	if _, ok := sqlc.IsRaw(spec); ok {
+		return spec, "", nil
+	}
+	fields := strings.Fields(spec)
+	if len(fields) == 3 && strings.EqualFold(fields[1], "as") {
+		fields = []string{fields[0], fields[2]}
+	}
+	if len(fields) == 0 || len(fields) > 2 {
+		return "", "", util.Error("非法数据表[", spec, "],表达式请使用sqlc.Raw")
+	}
+	parts := strings.Split(fields[0], ".")
+	if len(parts) > 2 {
+		return "", "", util.Error("非法数据表[", spec, "],表达式请使用sqlc.Raw")
+	}
+	for _, part := range parts {
+		if !identRegexp.MatchString(part) {
+			return "", "", util.Error("非法数据表[", spec, "],表达式请使用sqlc.Raw")
+		}
+	}
+	if len(fields) == 2 {
+		if !identRegexp.MatchString(fields[1]) {
+			return "", "", util.Error("非法数据表别名[", spec, "]")
+		}
+		return fields[0], fields[1], nil
+	}
+	return fields[0], "", nil
+}
+
+// 登记表别名并返回加引号后的表名
+func (self *RDBManager) scopeTable(scope *identScope, spec string) (string, error) {
+	table, alias, err := parseTable(spec)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := sqlc.IsRaw(table); ok {
+		return self.quote(table), nil
+	}
+	parts := strings.Split(table, ".")
+	isModel := strings.EqualFold(parts[len(parts)-1], scope.meta.Table)
+	if len(alias) == 0 {
+		scope.aliases[strings.ToLower(parts[len(parts)-1])] = isModel
+		return self.quote(table), nil
+	}
+	scope.aliases[strings.ToLower(alias)] = isModel
+	return util.AddStr(self.quote(table), " ", self.quote(alias)), nil
+}
+
+// 构建复杂查询主表及连接表,连接条件仅支持列比较及and组合,其余使用sqlc.Raw
+func (self *RDBManager) buildComplexFrom(cnd *sqlc.Cnd, scope *identScope) (string, error) {
+	if len(cnd.FromCond.Table) == 0 {
+		return "", util.Error("主表不能为空,请通过From(...)方法设置")
+	}
+	from, err := self.scopeTable(scope, cnd.FromCond.Table)
+	if err != nil {
+		return "", err
+	}
+	// 先登记全部表别名,连接条件可引用后续连接表
+	tables := make([]string, len(cnd.JoinCond))
+	for i, cond := range cnd.JoinCond {
+		if len(cond.Table) == 0 || len(cond.On) == 0 {
+			continue
+		}
+		if cond.Type != sqlc.LEFT_ && cond.Type != sqlc.RIGHT_ && cond.Type != sqlc.INNER_ {
+			continue
+		}
+		if tables[i], err = self.scopeTable(scope, cond.Table); err != nil {
+			return "", err
+		}
+	}
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString(from)
+	sqlbuf.WriteString(" ")
+	for i, cond := range cnd.JoinCond {
+		if len(tables[i]) == 0 {
+			continue
+		}
+		if cond.Type == sqlc.LEFT_ {
+			sqlbuf.WriteString(" left join ")
+		} else if cond.Type == sqlc.RIGHT_ {
+			sqlbuf.WriteString(" right join ")
+		} else {
+			sqlbuf.WriteString(" inner join ")
+		}
+		on, err := self.buildJoinOn(scope, cond.On)
+		if err != nil {
+			return "", err
+		}
+		sqlbuf.WriteString(tables[i])
+		sqlbuf.WriteString(" on ")
+		sqlbuf.WriteString(on)
+		sqlbuf.WriteString(" ")
+	}
+	return sqlbuf.String(), nil
+}
+
+// 构建连接条件
+func (self *RDBManager) buildJoinOn(scope *identScope, on string) (string, error) {
+	if s, ok := sqlc.IsRaw(on); ok {
+		return s, nil
+	}
+	parts := andRegexp.Split(strings.TrimSpace(on), -1)
+	result := make([]string, 0, len(parts))
+	for _, part := range parts {
+		match := joinOnRegexp.FindStringSubmatch(strings.TrimSpace(part))
+		if match == nil {
+			return "", util.Error("非法连接条件[", on, "],表达式请使用sqlc.Raw")
+		}
+		if err := scope.checkColumn(match[1], false); err != nil {
+			return "", err
+		}
+		if err := scope.checkColumn(match[3], false); err != nil {
+			return "", err
+		}
+		result = append(result, util.AddStr(self.quote(match[1]), " ", match[2], " ", self.quote(match[3])))
+	}
+	return strings.Join(result, " and "), nil
+}
+
+// 构建复杂查询字段,支持"col","alias.col","alias.*"及"col [as] name",登记字段别名
+func (self *RDBManager) buildComplexFields(cnd *sqlc.Cnd, scope *identScope) (string, error) {
+	fields := make([]string, 0, len(cnd.AnyFields))
+	for _, field := range cnd.AnyFields {
+		if s, ok := sqlc.IsRaw(field); ok {
+			fields = append(fields, s)
+			continue
+		}
+		parts := strings.Fields(field)
+		if len(parts) == 3 && strings.EqualFold(parts[1], "as") {
+			parts = []string{parts[0], parts[2]}
+		}
+		if len(parts) == 0 || len(parts) > 2 {
+			return "", util.Error("非法查询字段[", field, "],表达式请使用sqlc.Raw")
+		}
+		expr := parts[0]
+		if expr == "*" || strings.HasSuffix(expr, ".*") {
+			if len(parts) > 1 {
+				return "", util.Error("非法查询字段[", field, "]")
+			}
+			if prefix := strings.TrimSuffix(expr, ".*"); prefix != "*" {
+				if _, ok := scope.aliases[strings.ToLower(prefix)]; !ok || !identRegexp.MatchString(prefix) {
+					return "", util.Error("表别名[", prefix, "]不存在")
+				}
+			}
+			fields = append(fields, self.quote(expr))
+			continue
+		}
+		if err := scope.checkColumn(expr, false); err != nil {
+			return "", err
+		}
+		if len(parts) == 1 {
+			fields = append(fields, self.quote(expr))
+			continue
+		}
+		if !identRegexp.MatchString(parts[1]) {
+			return "", util.Error("非法查询字段别名[", field, "]")
+		}
+		scope.selects[strings.ToLower(parts[1])] = true
+		fields = append(fields, util.AddStr(self.quote(expr), " as ", self.quote(parts[1])))
+	}
+	return strings.Join(fields, ", "), nil
+}
+
+// 按驱动为标识符加引号,保持各数据库未加引号时的大小写规则,sqlc.Raw片段原样输出
+func (self *RDBManager) quote(ident string) string {
+	if s, ok := sqlc.IsRaw(ident); ok {
+		return s
+	}
+	parts := strings.Split(ident, ".")
+	for i := range parts {
+		if parts[i] != "*" {
+			parts[i] = self.quotePart(parts[i])
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func (self *RDBManager) quotePart(name string) string {
+	switch self.Driver {
+	case MYSQL, "":
+		return util.AddStr("`", strings.Replace(name, "`", "``", -1), "`")
+	case POSTGRES:
+		// PostgreSQL未加引号的标识符按小写处理
+		return util.AddStr(`"`, strings.Replace(strings.ToLower(name), `"`, `""`, -1), `"`)
+	case SQLITE:
+		return util.AddStr(`"`, strings.Replace(name, `"`, `""`, -1), `"`)
+	}
+	return name
+}
+
+// 按驱动为列名加引号并以逗号拼接
+func (self *RDBManager) quoteColumns(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i := range columns {
+		quoted[i] = self.quote(columns[i])
+	}
+	return strings.Join(quoted, ",")
+}
@@ -0,0 +1,163 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/jorm/sqlc"
+	"strings"
+	"testing"
+)
+
+type joinUser struct {
+	Id       int64  `json:"id" bson:"_id" tb:"join_user"`
+	Name     string `json:"name" bson:"name"`
+	WalletID int64  `json:"walletID" bson:"walletID"`
+	Balance  int64  `json:"balance" bson:"balance"`
+}
+
+type joinWallet struct {
+	Id      int64 `json:"id" bson:"_id" tb:"join_wallet"`
+	Balance int64 `json:"balance" bson:"balance"`
+}
+
+func TestIdentifierWhitelist(t *testing.T) {
+	db := &RDBManager{Driver: MYSQL}
+	invalid := []*sqlc.Cnd{
+		sqlc.M(&joinUser{}).Orderby("id desc; drop table join_user", sqlc.ASC_),
+		sqlc.M(&joinUser{}).Eq("name = name or 1", 1),
+		sqlc.M(&joinUser{}).Orderby("password", sqlc.ASC_),
+		sqlc.M(&joinUser{}).Or(sqlc.M(nil).Eq("x.name", "a")),
+		sqlc.M(&joinUser{}).Groupby("name)"),
+	}
+	for _, cnd := range invalid {
+		if _, _, _, _, err := db.buildFindList(cnd); err == nil {
+			t.Errorf("expected identifier rejected: %+v", cnd)
+		}
+	}
+	if err := db.checkIdents(sqlc.M(&joinUser{}).UpdateKeyValue([]string{"name = 'x', balance"}, 1)); err == nil {
+		t.Error("expected update key rejected")
+	}
+	_, _, limitSql, _, err := db.buildFindList(sqlc.M(&joinUser{}).Eq("join_user.name", "a").Orderby(sqlc.Raw("field(id, 3, 1)"), sqlc.ASC_))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limitSql != "select  `id`, `name`, `walletID`, `balance` from `join_user` where `join_user`.`name` = ? order by field(id, 3, 1) asc" {
+		t.Errorf("unexpected raw order sql: %s", limitSql)
+	}
+	if s := db.quote("a`b.c"); s != "`a``b`.`c`" {
+		t.Errorf("unexpected mysql quote: %s", s)
+	}
+	if s := (&RDBManager{Driver: POSTGRES}).quote("u.walletID"); s != `"u"."walletid"` {
+		t.Errorf("unexpected postgres quote: %s", s)
+	}
+	if _, ok := sqlc.IsRaw("\x00raw:0000000000000000:drop table join_user"); ok {
+		t.Error("raw mark should not be forgeable")
+	}
+}
+
+func TestUpsertQuote(t *testing.T) {
+	upsql, err := (&RDBManager{Driver: MYSQL}).buildUpsertSql("t", "id,key", "?,?", []string{"id"}, []string{"key", "order"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upsql != "insert into `t` (id,key) values (?,?) on duplicate key update `id` = last_insert_id(`id`), `key` = values(`key`), `order` = values(`order`)" {
+		t.Errorf("unexpected mysql upsert sql: %s", upsql)
+	}
+	upsql, err = (&RDBManager{Driver: POSTGRES}).buildUpsertSql("t", "id,key", "?,?", []string{"id", "appID"}, []string{"order"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upsql != `insert into "t" (id,key) values (?,?) on conflict ("id","appid") do update set "order" = excluded."order"` {
+		t.Errorf("unexpected postgres upsert sql: %s", upsql)
+	}
+}
+
+func TestSqliteFindComplex(t *testing.T) {
+	db := newSqliteManager(t)
+	defer db.Close()
+	if err := db.AutoMigrate(&joinUser{}, &joinWallet{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Save(&joinWallet{Id: 1, Balance: 10}, &joinWallet{Id: 2, Balance: 3}, &joinWallet{Id: 3, Balance: 30}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Save(&joinUser{Name: "a", WalletID: 1}, &joinUser{Name: "b", WalletID: 2}, &joinUser{Name: "c", WalletID: 3}); err != nil {
+		t.Fatal(err)
+	}
+	cnd := func() *sqlc.Cnd {
+		return sqlc.M(&joinUser{}).Fields("u.id", "u.name", "w.balance as balance").From("join_user u").Join(sqlc.LEFT_, "join_wallet as w", "u.walletID = w.id")
+	}
+	result := make([]*joinUser, 0)
+	if err := db.FindComplex(cnd().Gt("w.balance", 5).Orderby("balance", sqlc.DESC_), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 2 || result[0].Name != "c" || result[0].Balance != 30 || result[1].Name != "a" {
+		t.Errorf("unexpected complex result: %+v %+v", result[0], result[1])
+	}
+	sum := make([]*joinUser, 0)
+	if err := db.FindComplex(sqlc.M(&joinUser{}).Fields(sqlc.Raw("sum(w.balance) as balance")).From("join_user u").Join(sqlc.INNER_, "join_wallet w", sqlc.Raw("u.walletID = w.id and w.balance > 5")), &sum); err != nil {
+		t.Fatal(err)
+	}
+	if len(sum) != 1 || sum[0].Balance != 40 {
+		t.Errorf("unexpected raw complex result: %+v", sum)
+	}
+	injections := []*sqlc.Cnd{
+		cnd().Join(sqlc.LEFT_, "join_wallet x", "1 = 1 or u.id = x.id"),
+		cnd().Fields("(select name from join_user) as name"),
+		sqlc.M(&joinUser{}).Fields("u.name").From("join_user u; drop table join_user"),
+		cnd().Eq("v.balance", 1),
+		cnd().Eq("u.password", 1),
+	}
+	for _, injection := range injections {
+		err := db.FindComplex(injection, &result)
+		if err == nil || !strings.Contains(err.Error(), "[") {
+			t.Errorf("expected complex identifier rejected: %v", err)
+		}
+	}
+}
+
+type keyWord struct {
+	Id      int64  `json:"id" bson:"_id" tb:"order"`
+	Key     string `json:"key" bson:"key"`
+	Order   int64  `json:"order" bson:"order" index:"idx_order"`
+	Version int64  `json:"version" bson:"version" version:"true"`
+	Deleted int64  `json:"deleted" bson:"deleted" softdelete:"true"`
+}
+
+func TestSqliteKeyword(t *testing.T) {
+	db := newSqliteManager(t)
+	defer db.Close()
+	if err := db.AutoMigrate(&keyWord{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&keyWord{}); err != nil {
+		t.Fatal(err)
+	}
+	data := &keyWord{Key: "a", Order: 1}
+	if err := db.Save(data, &keyWord{Key: "b", Order: 2}); err != nil {
+		t.Fatal(err)
+	}
+	data.Order = 3
+	if err := db.Update(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Upsert(&keyWord{Id: data.Id, Key: "c", Order: 4, Version: data.Version}); err != nil {
+		t.Fatal(err)
+	}
+	found := &keyWord{Id: data.Id}
+	if err := db.FindById(found); err != nil || found.Key != "c" || found.Order != 4 {
+		t.Errorf("unexpected find by id: %+v %v", found, err)
+	}
+	one := &keyWord{}
+	if err := db.FindOne(sqlc.M(&keyWord{}).Eq("key", "b"), one); err != nil || one.Order != 2 {
+		t.Errorf("unexpected find one: %+v %v", one, err)
+	}
+	if err := db.Delete(one); err != nil {
+		t.Fatal(err)
+	}
+	result := make([]*keyWord, 0)
+	if err := db.FindList(sqlc.M(&keyWord{}).Orderby("order", sqlc.DESC_), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[0].Key != "c" {
+		t.Errorf("unexpected keyword result: %+v", result)
+	}
+}
@@ -0,0 +1,199 @@
+package sqld
+
+import (
+	"database/sql"
+	"github.com/godaddy-x/jorm/log"
+	"github.com/godaddy-x/jorm/util"
+	"sync"
+)
+
+/********************************** 拦截器链实现 **********************************/
+
+// 拦截调用信息,拦截器可在调用next前改写SQL,Pipe和Args
+type Invocation struct {
+	Op      string        // 操作名称,如Save/FindList
+	DsName  string        // 数据源名称
+	Driver  string        // 数据库驱动 mysql/postgres/mongo
+	Table   string        // 数据表或集合名称
+	SQL     string        // SQL语句,关系数据库有效
+	Pipe    interface{}   // 查询管道或命令,mongo有效
+	Args    []interface{} // SQL参数
+	Result  interface{}   // 查询结果对象,查询操作有效
+	Start   int64         // 开始时间(毫秒)
+	Cost    int64         // 耗时(毫秒),执行完成后有效
+	Err     error         // 执行异常,执行完成后有效
+	manager *DBManager
+}
+
+// 执行函数
+type Invoker func(inv *Invocation) error
+
+// 拦截器接口,调用next继续执行,不调用时中止后续拦截器及数据库操作
+type IInterceptor interface {
+	Intercept(inv *Invocation, next Invoker) error
+}
+
+// 函数式拦截器
+type InterceptorFunc func(inv *Invocation, next Invoker) error
+
+func (self InterceptorFunc) Intercept(inv *Invocation, next Invoker) error {
+	return self(inv, next)
+}
+
+var (
+	interceptorMu sync.RWMutex
+	interceptors  = []IInterceptor{&slowLogInterceptor{}, &debugInterceptor{}}
+)
+
+// 注册拦截器,按注册顺序由外向内执行,内置慢查询和debug拦截器位于最外层
+func AddInterceptor(input ...IInterceptor) {
+	interceptorMu.Lock()
+	defer interceptorMu.Unlock()
+	chain := make([]IInterceptor, 0, len(interceptors)+len(input))
+	chain = append(chain, interceptors...)
+	for _, v := range input {
+		if v != nil {
+			chain = append(chain, v)
+		}
+	}
+	interceptors = chain
+}
+
+func getInterceptors() []IInterceptor {
+	interceptorMu.RLock()
+	defer interceptorMu.RUnlock()
+	return interceptors
+}
+
+// 获取调用所属数据库管理器的选项
+func (self *Invocation) Option() Option {
+	if self.manager == nil {
+		return Option{}
+	}
+	return self.manager.Option
+}
+
+// 执行拦截器链,fn为实际数据库操作,拦截器返回的异常记录至Errors
+func (self *DBManager) intercept(inv *Invocation, fn Invoker) error {
+	inv.manager = self
+	inv.DsName = self.DsName
+	if inv.Start == 0 {
+		inv.Start = util.Time()
+	}
+	chain := getInterceptors()
+	index := 0
+	var next Invoker
+	next = func(inv *Invocation) error {
+		if index < len(chain) {
+			interceptor := chain[index]
+			index++
+			return interceptor.Intercept(inv, next)
+		}
+		err := fn(inv)
+		inv.Cost = util.Time() - inv.Start
+		inv.Err = err
+		return err
+	}
+	err := next(inv)
+	inv.Cost = util.Time() - inv.Start
+	inv.Err = err
+	if err != nil && (len(self.Errors) == 0 || self.Errors[len(self.Errors)-1] != err) {
+		self.Error(err)
+	}
+	return err
+}
+
+// 慢查询日志拦截器,耗时超过SlowQuery毫秒时写入慢查询日志
+type slowLogInterceptor struct{}
+
+func (self *slowLogInterceptor) Intercept(inv *Invocation, next Invoker) error {
+	err := next(inv)
+	if inv.manager == nil || inv.manager.SlowQuery <= 0 {
+		return err
+	}
+	cost := util.Time() - inv.Start
+	if cost <= inv.manager.SlowQuery {
+		return err
+	}
+	if inv.Driver == MONGO {
+		if mgo_slowlog != nil {
+			mgo_slowlog.Warn(inv.Op, log.Int64("cost", cost), log.Any("pipe", inv.Pipe))
+		}
+	} else if sql_slowlog != nil {
+		sql_slowlog.Warn(inv.Op, log.Int64("cost", cost), log.String("sql", inv.SQL), log.Any("value", inv.Args))
+	}
+	return err
+}
+
+// debug日志拦截器,debug模式下输出执行语句,参数及耗时
+type debugInterceptor struct{}
+
+func (self *debugInterceptor) Intercept(inv *Invocation, next Invoker) error {
+	err := next(inv)
+	if inv.manager == nil || !inv.manager.Debug {
+		return err
+	}
+	cost := util.AnyToStr(util.Time() - inv.Start)
+	if inv.Driver == MONGO {
+		str, _ := util.ObjectToJson(inv.Pipe)
+		log.Println(util.AddStr("mongo debug -> ", inv.Op, ": ", str, " --- cost: ", cost))
+	} else {
+		str, _ := util.ObjectToJson(inv.Args)
+		log.Println(util.AddStr(inv.Driver, " debug -> ", inv.Op, ": ", inv.SQL, " --- ", str, " --- cost: ", cost))
+	}
+	return err
+}
+
+// 构建关系数据库拦截调用信息
+func (self *RDBManager) invocation(op string, model interface{}, query string, args []interface{}, start int64) *Invocation {
+	tb, _ := self.tableName(model)
+	return &Invocation{Op: op, Driver: self.Driver, Table: tb, SQL: query, Args: args, Start: start}
+}
+
+// 获取预编译语句,事务中使用事务连接,read为true时优先使用从库,占位符按数据源驱动转换
+// 使用完毕调用release并传入执行异常,缓存语句归还缓存,连接异常时失效
+func (self *RDBManager) prepare(query string, read bool) (*sql.Stmt, func(err error), error) {
+	query = self.rebind(query)
+	if self.AutoTx {
+		return self.prepareTx(query)
+	} else if read {
+		stmt, release, _, err := self.prepareRead(query)
+		return stmt, release, err
+	}
+	return self.prepareStmt(self.Db, query)
+}
+
+// 经拦截器链执行写操作,fail为执行失败提示,fn处理执行结果
+func (self *RDBManager) exec(inv *Invocation, fail string, fn func(ret sql.Result) error) error {
+	return self.intercept(inv, func(inv *Invocation) error {
+		stmt, release, err := self.prepare(inv.SQL, false)
+		if err != nil {
+			return self.ctxError(err, "预编译sql[", inv.SQL, "]失败: ")
+		}
+		ret, err := stmt.ExecContext(self.getContext(), inv.Args...)
+		release(err)
+		if err != nil {
+			return self.ctxError(err, fail)
+		}
+		if fn != nil {
+			return fn(ret)
+		}
+		return nil
+	})
+}
+
+// 经拦截器链执行查询,read为true时优先使用从库,fn读取查询结果
+func (self *RDBManager) query(inv *Invocation, read bool, fn func(rows *sql.Rows) error) error {
+	return self.intercept(inv, func(inv *Invocation) error {
+		rows, release, err := self.openRows(inv.SQL, read, inv.Args)
+		if err != nil {
+			return err
+		}
+		err = fn(rows)
+		// fn返回的异常已转换为文本,按结果集原始异常判断是否连接异常
+		rerr := rows.Err()
+		rows.Close()
+		release(rerr)
+		return err
+	})
+}
@@ -0,0 +1,56 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/jorm/util"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInterceptorChain(t *testing.T) {
+	trace := make([]string, 0)
+	AddInterceptor(InterceptorFunc(func(inv *Invocation, next Invoker) error {
+		if !strings.HasPrefix(inv.Op, "Test") {
+			return next(inv)
+		}
+		trace = append(trace, "outer")
+		inv.SQL = util.AddStr("/* tenant */ ", inv.SQL)
+		return next(inv)
+	}), InterceptorFunc(func(inv *Invocation, next Invoker) error {
+		if !strings.HasPrefix(inv.Op, "Test") {
+			return next(inv)
+		}
+		trace = append(trace, "inner")
+		if inv.Op == "TestDeny" {
+			return util.Error("拒绝执行")
+		}
+		return next(inv)
+	}))
+	db := &DBManager{Option: Option{DsName: MASTER}}
+	var executed string
+	err := db.intercept(&Invocation{Op: "TestFind", SQL: "select 1"}, func(inv *Invocation) error {
+		executed = inv.SQL
+		trace = append(trace, "exec")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if executed != "/* tenant */ select 1" {
+		t.Errorf("unexpected rewritten sql: %s", executed)
+	}
+	if !reflect.DeepEqual(trace, []string{"outer", "inner", "exec"}) {
+		t.Errorf("unexpected chain order: %v", trace)
+	}
+	inv := &Invocation{Op: "TestDeny", SQL: "delete from t"}
+	called := false
+	if err := db.intercept(inv, func(inv *Invocation) error {
+		called = true
+		return nil
+	}); err == nil || called {
+		t.Error("expected short-circuit without executing")
+	}
+	if inv.Err == nil || inv.DsName != MASTER || len(db.Errors) != 1 {
+		t.Errorf("unexpected invocation state: %+v %v", inv, db.Errors)
+	}
+}
@@ -0,0 +1,218 @@
+package sqld
+
+import (
+	"bytes"
+	"github.com/godaddy-x/jorm/sqlc"
+	"github.com/godaddy-x/jorm/util"
+	"reflect"
+)
+
+/********************************** 游标分页实现 **********************************/
+
+// 游标分页排序字段,向前翻页时排序方向取反
+type keysetOrder struct {
+	field *FieldMeta
+	key   string
+	desc  bool
+}
+
+// 解析游标分页排序字段
+func keysetOrders(meta *ModelMeta, cnd *sqlc.Cnd) ([]keysetOrder, error) {
+	if len(cnd.Orderbys) == 0 {
+		return nil, util.Error("游标分页必须指定排序字段")
+	}
+	orders := make([]keysetOrder, 0, len(cnd.Orderbys))
+	for _, orderby := range cnd.Orderbys {
+		field := meta.FieldByColumn(orderby.Key)
+		if field == nil {
+			field = meta.FieldByJson(orderby.Key)
+		}
+		if field == nil {
+			field = meta.foldField(orderby.Key)
+		}
+		if field == nil {
+			return nil, util.Error("游标分页排序字段[", orderby.Key, "]不存在")
+		}
+		desc := orderby.Value == sqlc.DESC_
+		if cnd.Keyset.Before {
+			desc = !desc
+		}
+		orders = append(orders, keysetOrder{field: field, key: orderby.Key, desc: desc})
+	}
+	return orders, nil
+}
+
+// 按查询方向重建排序条件,向前翻页时反向排序
+func keysetCnd(cnd *sqlc.Cnd, orders []keysetOrder) *sqlc.Cnd {
+	seek := *cnd
+	seek.Orderbys = make([]sqlc.Condition, 0, len(orders))
+	for _, order := range orders {
+		if order.desc {
+			seek.Orderbys = append(seek.Orderbys, sqlc.Condition{Logic: sqlc.ORDER_BY_, Key: order.key, Value: sqlc.DESC_})
+		} else {
+			seek.Orderbys = append(seek.Orderbys, sqlc.Condition{Logic: sqlc.ORDER_BY_, Key: order.key, Value: sqlc.ASC_})
+		}
+	}
+	return &seek
+}
+
+// 获取边界行排序字段值并转换为字段类型,encode为true时按字段写入转换为数据库参数
+func keysetValues(cnd *sqlc.Cnd, orders []keysetOrder, encode bool) ([]interface{}, error) {
+	keys, err := cnd.Keyset.Values()
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	if len(keys) != len(orders) {
+		return nil, util.Error("游标分页边界值数量[", len(keys), "]与排序字段数量[", len(orders), "]不一致")
+	}
+	values := make([]interface{}, len(keys))
+	for i := range keys {
+		field := orders[i].field
+		v := reflect.ValueOf(keys[i])
+		if !v.IsValid() {
+			return nil, util.Error("游标分页排序字段[", orders[i].key, "]边界值不能为空")
+		}
+		if v.Type() != field.Type {
+			if !keysetConvertible(v.Kind(), field.Kind) {
+				values[i] = keys[i]
+				continue
+			}
+			v = v.Convert(field.Type)
+		}
+		if !encode {
+			values[i] = v.Interface()
+			continue
+		}
+		arg, ok, err := field.encode(v)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			arg = v.Interface()
+		}
+		values[i] = arg
+	}
+	return values, nil
+}
+
+// 令牌解析后的数值和字符串仅在同类间转换
+func keysetConvertible(from, to reflect.Kind) bool {
+	isNumber := func(kind reflect.Kind) bool {
+		return isIntKind(kind) || isUintKind(kind) || kind == reflect.Float32 || kind == reflect.Float64
+	}
+	return (isNumber(from) && isNumber(to)) || (from == reflect.String && to == reflect.String)
+}
+
+// 构建游标分页条件,(k1 > ?) or (k1 = ? and k2 > ?) ...
+func (self *RDBManager) buildKeysetCase(cnd *sqlc.Cnd, orders []keysetOrder) (string, []interface{}, error) {
+	values, err := keysetValues(cnd, orders, true)
+	if err != nil || len(values) == 0 {
+		return "", nil, err
+	}
+	var part bytes.Buffer
+	args := make([]interface{}, 0)
+	part.WriteString(" (")
+	for i := range orders {
+		if i > 0 {
+			part.WriteString(" or ")
+		}
+		part.WriteString("(")
+		for j := 0; j < i; j++ {
+			part.WriteString(self.quote(orders[j].key))
+			part.WriteString(" = ? and ")
+			args = append(args, values[j])
+		}
+		part.WriteString(self.quote(orders[i].key))
+		if orders[i].desc {
+			part.WriteString(" < ?)")
+		} else {
+			part.WriteString(" > ?)")
+		}
+		args = append(args, values[i])
+	}
+	part.WriteString(") and")
+	return part.String(), args, nil
+}
+
+// 构建mongo游标分页条件
+func buildMongoKeyset(cnd *sqlc.Cnd, orders []keysetOrder) (map[string]interface{}, error) {
+	values, err := keysetValues(cnd, orders, false)
+	if err != nil || len(values) == 0 {
+		return nil, err
+	}
+	array := make([]interface{}, 0, len(orders))
+	for i := range orders {
+		tmp := make(map[string]interface{}, i+1)
+		for j := 0; j < i; j++ {
+			tmp[mongoKey(orders[j].key)] = values[j]
+		}
+		if orders[i].desc {
+			tmp[mongoKey(orders[i].key)] = map[string]interface{}{"$lt": values[i]}
+		} else {
+			tmp[mongoKey(orders[i].key)] = map[string]interface{}{"$gt": values[i]}
+		}
+		array = append(array, tmp)
+	}
+	return map[string]interface{}{"$or": array}, nil
+}
+
+func mongoKey(key string) string {
+	if key == JID {
+		return BID
+	}
+	return key
+}
+
+// 游标分页结果处理,向前翻页时恢复原排序顺序并回写Next/Prev令牌
+func finishKeyset(cnd *sqlc.Cnd, orders []keysetOrder, size int64, data interface{}) error {
+	resultv := reflect.ValueOf(data).Elem()
+	n := resultv.Len()
+	if cnd.Keyset.Before {
+		swap := reflect.Swapper(resultv.Interface())
+		for i, j := 0, n-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+	cnd.Keyset.Next, cnd.Keyset.Prev = "", ""
+	if n == 0 {
+		return nil
+	}
+	// 查询方向满页时视为仍有数据,反方向在指定边界时必有数据
+	bounded := len(cnd.Keyset.Keys) > 0 || len(cnd.Keyset.Token) > 0
+	hasNext, hasPrev := int64(n) >= size, bounded
+	if cnd.Keyset.Before {
+		hasNext, hasPrev = bounded, int64(n) >= size
+	}
+	var err error
+	if hasNext {
+		if cnd.Keyset.Next, err = rowToken(orders, resultv.Index(n-1)); err != nil {
+			return err
+		}
+	}
+	if hasPrev {
+		if cnd.Keyset.Prev, err = rowToken(orders, resultv.Index(0)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 按排序字段值生成行令牌
+func rowToken(orders []keysetOrder, row reflect.Value) (sqlc.Token, error) {
+	row = reflect.Indirect(row)
+	keys := make([]interface{}, len(orders))
+	for i := range orders {
+		keys[i] = row.FieldByIndex(orders[i].field.Index).Interface()
+	}
+	return sqlc.NewToken(keys)
+}
+
+// 游标分页每页条数,未指定时默认10条
+func keysetSize(cnd *sqlc.Cnd) int64 {
+	if cnd.Pagination.PageSize <= 0 {
+		return 10
+	}
+	return cnd.Pagination.PageSize
+}
@@ -0,0 +1,100 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/jorm/sqlc"
+	"gopkg.in/mgo.v2/bson"
+	"reflect"
+	"testing"
+)
+
+type seekWallet struct {
+	Id      int64  `json:"id" bson:"_id" tb:"seek_wallet"`
+	AppID   string `json:"appID" bson:"appID" size:"64"`
+	Balance int64  `json:"balance" bson:"balance"`
+}
+
+func TestKeysetCondition(t *testing.T) {
+	cnd := sqlc.M(&seekWallet{}).Eq("appID", "app").Orderby("balance", sqlc.DESC_).Orderby("id", sqlc.ASC_).After(int64(20), int64(7)).Limit(1, 5)
+	_, _, limitSql, args, err := (&RDBManager{Driver: MYSQL}).buildFindList(cnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limitSql != "select  `id`, `appID`, `balance` from `seek_wallet` where `appID` = ? and ((`balance` < ?) or (`balance` = ? and `id` > ?)) order by `balance` desc, `id` asc limit 0,5" {
+		t.Errorf("unexpected keyset sql: %s", limitSql)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"app", int64(20), int64(20), int64(7)}) {
+		t.Errorf("unexpected keyset args: %v", args)
+	}
+	token, err := sqlc.NewToken([]interface{}{int64(20), int64(7)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := sqlc.M(&seekWallet{}).Orderby("balance", sqlc.DESC_).Orderby("id", sqlc.ASC_).Before(token)
+	pipe, err := (&MGOManager{}).buildPipeCondition(before, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{
+		map[string]interface{}{"$match": map[string]interface{}{"$or": []interface{}{
+			map[string]interface{}{"balance": map[string]interface{}{"$gt": int64(20)}},
+			map[string]interface{}{"balance": int64(20), "_id": map[string]interface{}{"$lt": int64(7)}},
+		}}},
+		map[string]interface{}{"$sort": bson.D{{Name: "balance", Value: 1}, {Name: "_id", Value: -1}}},
+		map[string]interface{}{"$skip": int64(0)},
+		map[string]interface{}{"$limit": int64(10)},
+	}
+	if !reflect.DeepEqual(pipe, expected) {
+		t.Errorf("unexpected keyset pipe: %v", pipe)
+	}
+	if _, _, _, _, err := (&RDBManager{Driver: MYSQL}).buildFindList(sqlc.M(&seekWallet{}).After(int64(1))); err == nil {
+		t.Error("keyset without orderby should fail")
+	}
+}
+
+func TestSqliteKeyset(t *testing.T) {
+	db := newSqliteManager(t)
+	defer db.Close()
+	if err := db.AutoMigrate(&seekWallet{}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 7; i++ {
+		if err := db.Save(&seekWallet{AppID: "app", Balance: int64(i % 3)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids := func(list []*seekWallet) []int64 {
+		result := make([]int64, 0, len(list))
+		for _, v := range list {
+			result = append(result, v.Id)
+		}
+		return result
+	}
+	// balance desc, id asc: 2(2,5) 1(1,4,7) 0(3,6)
+	pages := [][]int64{{2, 5, 1}, {4, 7, 3}, {6}}
+	cnd := sqlc.M(&seekWallet{}).Orderby("balance", sqlc.DESC_).Orderby("id", sqlc.ASC_).After().Limit(1, 3)
+	var tokens []sqlc.Token
+	for i, page := range pages {
+		result := make([]*seekWallet, 0)
+		if err := db.FindList(cnd, &result); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ids(result), page) {
+			t.Fatalf("unexpected page %d: %v", i, ids(result))
+		}
+		if (i == 0) != (len(cnd.Keyset.Prev) == 0) {
+			t.Errorf("unexpected prev token on page %d: %s", i, cnd.Keyset.Prev)
+		}
+		tokens = append(tokens, cnd.Keyset.Prev)
+		cnd.After(cnd.Keyset.Next)
+	}
+	if len(cnd.Keyset.Token) != 0 {
+		t.Errorf("last page should not have next token: %s", cnd.Keyset.Token)
+	}
+	result := make([]*seekWallet, 0)
+	if err := db.FindList(cnd.Before(tokens[2]), &result); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids(result), pages[1]) || len(cnd.Keyset.Prev) == 0 || len(cnd.Keyset.Next) == 0 {
+		t.Errorf("unexpected before page: %v %+v", ids(result), cnd.Keyset)
+	}
+}
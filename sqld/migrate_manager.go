@@ -0,0 +1,565 @@
+package sqld
+
+import (
+	"bytes"
+	"database/sql"
+	"github.com/godaddy-x/jorm/util"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/********************************** 数据表结构迁移实现 **********************************/
+
+// 列逻辑类型,由各数据库方言转换为实际列类型
+const (
+	COL_TINYINT   = "tinyint"
+	COL_SMALLINT  = "smallint"
+	COL_INT       = "int"
+	COL_BIGINT    = "bigint"
+	COL_UTINYINT  = "utinyint"
+	COL_USMALLINT = "usmallint"
+	COL_UINT      = "uint"
+	COL_UBIGINT   = "ubigint"
+	COL_FLOAT     = "float"
+	COL_DOUBLE    = "double"
+	COL_BOOL      = "bool"
+	COL_STRING    = "string"
+	COL_TEXT      = "text"
+	COL_BYTES     = "bytes"
+	COL_DATETIME  = "datetime"
+)
+
+// 迁移记录表名称
+const MIGRATION_TABLE = "jorm_migration"
+
+// 数据库DDL方言
+type ddlDialect struct {
+	columnType  func(field *FieldMeta, logic string) string // 逻辑类型转换为列类型
+	tableSuffix string                                      // 建表语句后缀
+	identity    string                                      // 数据库生成ID时的ID列约束
+	addIndex    func(table string, index *IndexMeta) string // 添加索引语句
+	tableSql    string                                      // 查询数据表是否存在,参数为表名
+	columnsSql  string                                      // 查询数据表列名,参数为表名
+	indexesSql  string                                      // 查询数据表索引名,参数为表名
+}
+
+var ddlDialects = map[string]*ddlDialect{
+	MYSQL: {
+		columnType:  mysqlColumnType,
+		tableSuffix: " engine=InnoDB default charset=utf8mb4",
+		identity:    " not null auto_increment",
+		addIndex:    mysqlAddIndex,
+		tableSql:    "select count(1) from information_schema.tables where table_schema = database() and table_name = ?",
+		columnsSql:  "select column_name from information_schema.columns where table_schema = database() and table_name = ?",
+		indexesSql:  "select distinct index_name from information_schema.statistics where table_schema = database() and table_name = ?",
+	},
+	POSTGRES: {
+		columnType: postgresColumnType,
+		identity:   " generated by default as identity",
+		addIndex:   createIndex,
+		tableSql:   "select count(1) from information_schema.tables where table_schema = current_schema() and table_name = ?",
+		columnsSql: "select column_name from information_schema.columns where table_schema = current_schema() and table_name = ?",
+		indexesSql: "select indexname from pg_indexes where schemaname = current_schema() and tablename = ?",
+	},
+	SQLITE: {
+		columnType: sqliteColumnType,
+		identity:   " not null", // integer主键即为自增rowid
+		addIndex:   createIndex,
+		tableSql:   "select count(1) from sqlite_master where type = 'table' and name = ?",
+		columnsSql: "select name from pragma_table_info(?)",
+		indexesSql: "select name from sqlite_master where type = 'index' and tbl_name = ?",
+	},
+}
+
+var (
+	nullStringType  = reflect.TypeOf(sql.NullString{})
+	nullInt64Type   = reflect.TypeOf(sql.NullInt64{})
+	nullInt32Type   = reflect.TypeOf(sql.NullInt32{})
+	nullInt16Type   = reflect.TypeOf(sql.NullInt16{})
+	nullByteType    = reflect.TypeOf(sql.NullByte{})
+	nullFloat64Type = reflect.TypeOf(sql.NullFloat64{})
+	nullBoolType    = reflect.TypeOf(sql.NullBool{})
+)
+
+// 按字段类型推断列逻辑类型,指针类型按元素类型推断
+func columnLogic(typ reflect.Type, isDate bool) string {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ {
+	case timeType, nullTimeType:
+		return COL_DATETIME
+	case nullStringType:
+		return COL_STRING
+	case nullInt64Type:
+		return COL_BIGINT
+	case nullInt32Type:
+		return COL_INT
+	case nullInt16Type:
+		return COL_SMALLINT
+	case nullByteType:
+		return COL_UTINYINT
+	case nullFloat64Type:
+		return COL_DOUBLE
+	case nullBoolType:
+		return COL_BOOL
+	}
+	if typ.Implements(valuerType) || reflect.PtrTo(typ).Implements(valuerType) {
+		return COL_STRING
+	}
+	switch typ.Kind() {
+	case reflect.Int8:
+		return COL_TINYINT
+	case reflect.Int16:
+		return COL_SMALLINT
+	case reflect.Int32, reflect.Int:
+		return COL_INT
+	case reflect.Int64:
+		if isDate {
+			return COL_DATETIME
+		}
+		return COL_BIGINT
+	case reflect.Uint8:
+		return COL_UTINYINT
+	case reflect.Uint16:
+		return COL_USMALLINT
+	case reflect.Uint32, reflect.Uint:
+		return COL_UINT
+	case reflect.Uint64:
+		return COL_UBIGINT
+	case reflect.Float32:
+		return COL_FLOAT
+	case reflect.Float64:
+		return COL_DOUBLE
+	case reflect.Bool:
+		return COL_BOOL
+	case reflect.String:
+		return COL_STRING
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return COL_BYTES
+		}
+	}
+	return COL_TEXT
+}
+
+func mysqlColumnType(field *FieldMeta, logic string) string {
+	switch logic {
+	case COL_UTINYINT, COL_USMALLINT, COL_UINT, COL_UBIGINT:
+		return util.AddStr(logic[1:], " unsigned")
+	case COL_BOOL:
+		return "tinyint(1)"
+	case COL_STRING:
+		if field.Size > 16383 {
+			return "text"
+		} else if field.Size > 0 {
+			return util.AddStr("varchar(", field.Size, ")")
+		}
+		return "varchar(255)"
+	case COL_BYTES:
+		if field.Size > 0 && field.Size <= 65535 {
+			return util.AddStr("varbinary(", field.Size, ")")
+		}
+		return "blob"
+	}
+	return logic
+}
+
+func mysqlAddIndex(table string, index *IndexMeta) string {
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString("alter table ")
+	sqlbuf.WriteString(table)
+	if index.Unique {
+		sqlbuf.WriteString(" add unique index ")
+	} else {
+		sqlbuf.WriteString(" add index ")
+	}
+	sqlbuf.WriteString(index.Name)
+	sqlbuf.WriteString(" (")
+	sqlbuf.WriteString(strings.Join(index.Columns, ", "))
+	sqlbuf.WriteString(")")
+	return sqlbuf.String()
+}
+
+func postgresColumnType(field *FieldMeta, logic string) string {
+	switch logic {
+	case COL_TINYINT, COL_UTINYINT:
+		return "smallint"
+	case COL_INT, COL_USMALLINT:
+		return "integer"
+	case COL_UINT:
+		return "bigint"
+	case COL_UBIGINT:
+		return "numeric(20)"
+	case COL_FLOAT:
+		return "real"
+	case COL_DOUBLE:
+		return "double precision"
+	case COL_BOOL:
+		return "boolean"
+	case COL_STRING:
+		if field.Size > 10485760 {
+			return "text"
+		} else if field.Size > 0 {
+			return util.AddStr("varchar(", field.Size, ")")
+		}
+		return "varchar(255)"
+	case COL_BYTES:
+		return "bytea"
+	case COL_DATETIME:
+		return "timestamp"
+	}
+	return logic
+}
+
+// SQLite按类型亲和性声明列类型,整数主键声明为integer以作为rowid自增,时间按文本存储
+func sqliteColumnType(field *FieldMeta, logic string) string {
+	switch logic {
+	case COL_TINYINT, COL_SMALLINT, COL_INT, COL_BIGINT, COL_UTINYINT, COL_USMALLINT, COL_UINT, COL_UBIGINT:
+		return "integer"
+	case COL_FLOAT, COL_DOUBLE:
+		return "real"
+	case COL_BOOL:
+		return "boolean"
+	case COL_STRING:
+		if field.Size > 0 {
+			return util.AddStr("varchar(", field.Size, ")")
+		}
+		return "varchar(255)"
+	case COL_BYTES:
+		return "blob"
+	}
+	return "text"
+}
+
+// 通用创建索引语句
+func createIndex(table string, index *IndexMeta) string {
+	var sqlbuf bytes.Buffer
+	if index.Unique {
+		sqlbuf.WriteString("create unique index ")
+	} else {
+		sqlbuf.WriteString("create index ")
+	}
+	sqlbuf.WriteString(index.Name)
+	sqlbuf.WriteString(" on ")
+	sqlbuf.WriteString(table)
+	sqlbuf.WriteString(" (")
+	sqlbuf.WriteString(strings.Join(index.Columns, ", "))
+	sqlbuf.WriteString(")")
+	return sqlbuf.String()
+}
+
+// 获取当前驱动DDL方言
+func (self *RDBManager) getDDLDialect() (*ddlDialect, error) {
+	driver := self.Driver
+	if len(driver) == 0 {
+		driver = MYSQL
+	}
+	if v, b := ddlDialects[driver]; b {
+		return v, nil
+	}
+	return nil, util.Error("数据库驱动[", driver, "]不支持DDL生成")
+}
+
+// 构建列定义,ID字段为非空主键列,未启用自动ID时由数据库生成ID
+func (self *RDBManager) buildColumnDef(dialect *ddlDialect, field *FieldMeta) string {
+	ctype := field.DBType
+	if len(ctype) == 0 {
+		ctype = dialect.columnType(field, columnLogic(field.Type, field.IsDate))
+	}
+	column := self.quote(field.Column)
+	if field.IsId && !self.AutoID {
+		return util.AddStr(column, " ", ctype, dialect.identity)
+	} else if field.IsId {
+		return util.AddStr(column, " ", ctype, " not null")
+	}
+	return util.AddStr(column, " ", ctype, " null")
+}
+
+// 构建添加索引语句,表名,索引名及索引列按驱动加引号
+func (self *RDBManager) buildAddIndex(dialect *ddlDialect, table string, index *IndexMeta) string {
+	columns := make([]string, len(index.Columns))
+	for i := range index.Columns {
+		columns[i] = self.quote(index.Columns[i])
+	}
+	return dialect.addIndex(self.quote(table), &IndexMeta{Name: self.quote(index.Name), Unique: index.Unique, Columns: columns})
+}
+
+// 按模型标签生成建表及索引语句
+func (self *RDBManager) BuildCreateTable(model interface{}) ([]string, error) {
+	dialect, err := self.getDDLDialect()
+	if err != nil {
+		return nil, err
+	}
+	meta, err := GetModelMeta(model)
+	if err != nil {
+		return nil, err
+	}
+	table, err := meta.TableName()
+	if err != nil {
+		return nil, err
+	}
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString("create table if not exists ")
+	sqlbuf.WriteString(self.quote(table))
+	sqlbuf.WriteString(" (")
+	for _, field := range meta.Fields {
+		if len(field.Column) == 0 {
+			return nil, util.Error("字段[", field.Name, "]无效bson标签")
+		}
+		sqlbuf.WriteString("\n  ")
+		sqlbuf.WriteString(self.buildColumnDef(dialect, field))
+		sqlbuf.WriteString(",")
+	}
+	sqlbuf.WriteString("\n  primary key (")
+	sqlbuf.WriteString(self.quote(meta.Id.Column))
+	sqlbuf.WriteString(")\n)")
+	sqlbuf.WriteString(dialect.tableSuffix)
+	result := []string{sqlbuf.String()}
+	for _, index := range meta.Indexes {
+		result = append(result, self.buildAddIndex(dialect, table, index))
+	}
+	return result, nil
+}
+
+// 自动迁移数据表结构,表不存在时创建,存在时仅新增缺失列及索引,不修改或删除已有列
+func (self *RDBManager) AutoMigrate(models ...interface{}) error {
+	dialect, err := self.getDDLDialect()
+	if err != nil {
+		return self.Error(err)
+	}
+	for _, model := range models {
+		meta, err := GetModelMeta(model)
+		if err != nil {
+			return self.Error(err)
+		}
+		table, err := meta.TableName()
+		if err != nil {
+			return self.Error(err)
+		}
+		var count int64
+		if err := self.findBySQL("AutoMigrate", false, dialect.tableSql, []interface{}{table}, &count, nil); err != nil {
+			return err
+		}
+		if count == 0 {
+			stmts, err := self.BuildCreateTable(model)
+			if err != nil {
+				return self.Error(err)
+			}
+			if err := self.execMigrateSQL(model, stmts...); err != nil {
+				return err
+			}
+			continue
+		}
+		columns := make([]string, 0)
+		if err := self.findBySQL("AutoMigrate", false, dialect.columnsSql, []interface{}{table}, &columns, nil); err != nil {
+			return err
+		}
+		indexes := make([]string, 0)
+		if err := self.findBySQL("AutoMigrate", false, dialect.indexesSql, []interface{}{table}, &indexes, nil); err != nil {
+			return err
+		}
+		stmts := make([]string, 0)
+		for _, field := range meta.Fields {
+			if len(field.Column) == 0 || containsFold(columns, field.Column) {
+				continue
+			}
+			stmts = append(stmts, util.AddStr("alter table ", self.quote(table), " add column ", self.buildColumnDef(dialect, field)))
+		}
+		for _, index := range meta.Indexes {
+			if !containsFold(indexes, index.Name) {
+				stmts = append(stmts, self.buildAddIndex(dialect, table, index))
+			}
+		}
+		if err := self.execMigrateSQL(model, stmts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (self *RDBManager) execMigrateSQL(model interface{}, stmts ...string) error {
+	for _, stmt := range stmts {
+		if _, err := self.ExecSQL(stmt, nil, model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// 版本迁移脚本
+type Migration struct {
+	Version int64  // 版本号,按升序执行
+	Name    string // 迁移名称
+	Up      string // 升级SQL,多条语句以;分隔
+	Down    string // 回滚SQL,多条语句以;分隔
+}
+
+var (
+	migrationMu sync.RWMutex
+	migrations  = map[string][]Migration{}
+)
+
+// 注册数据源版本迁移脚本,ds为空时使用默认数据源
+func RegMigration(ds string, input ...Migration) error {
+	if len(ds) == 0 {
+		ds = MASTER
+	}
+	migrationMu.Lock()
+	defer migrationMu.Unlock()
+	list := append([]Migration{}, migrations[ds]...)
+	for _, v := range input {
+		if v.Version <= 0 {
+			return util.Error("迁移版本号必须大于0")
+		}
+		if len(strings.TrimSpace(v.Up)) == 0 {
+			return util.Error("迁移版本[", v.Version, "]升级SQL不能为空")
+		}
+		for _, m := range list {
+			if m.Version == v.Version {
+				return util.Error("迁移版本[", v.Version, "]已存在")
+			}
+		}
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	migrations[ds] = list
+	return nil
+}
+
+func getMigrations(ds string) []Migration {
+	if len(ds) == 0 {
+		ds = MASTER
+	}
+	migrationMu.RLock()
+	defer migrationMu.RUnlock()
+	return migrations[ds]
+}
+
+// 获取当前数据源已执行的迁移版本
+func (self *RDBManager) appliedVersions() ([]int64, error) {
+	if _, err := self.ExecSQL(util.AddStr("create table if not exists ", MIGRATION_TABLE, " (ds_name varchar(64) not null, version bigint not null, name varchar(255) null, ctime bigint not null, primary key (ds_name, version))"), nil); err != nil {
+		return nil, err
+	}
+	versions := make([]int64, 0)
+	if err := self.findBySQL("Migrate", false, util.AddStr("select version from ", MIGRATION_TABLE, " where ds_name = ? order by version"), []interface{}{self.dsName()}, &versions, nil); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+func (self *RDBManager) dsName() string {
+	if len(self.DsName) == 0 {
+		return MASTER
+	}
+	return self.DsName
+}
+
+// 执行当前数据源未执行的升级迁移,PostgreSQL及SQLite中每个迁移与其迁移记录在同一事务中执行,失败时整体回滚
+// MySQL的DDL语句隐式提交,迁移失败时已执行语句不回滚,迁移语句涉及的数据表无法确定,不使查询缓存失效,迁移修改数据时需自行清理查询缓存
+func (self *RDBManager) Migrate() error {
+	versions, err := self.appliedVersions()
+	if err != nil {
+		return err
+	}
+	for _, m := range getMigrations(self.DsName) {
+		if containsVersion(versions, m.Version) {
+			continue
+		}
+		if err := self.execMigration(m.Up, util.AddStr("insert into ", MIGRATION_TABLE, " (ds_name, version, name, ctime) values (?, ?, ?, ?)"), []interface{}{self.dsName(), m.Version, m.Name, util.Time()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 按版本倒序回滚最近steps个已执行迁移,与Migrate相同不使查询缓存失效
+func (self *RDBManager) MigrateDown(steps int) error {
+	versions, err := self.appliedVersions()
+	if err != nil {
+		return err
+	}
+	list := getMigrations(self.DsName)
+	for i := len(versions) - 1; i >= 0 && steps > 0; i-- {
+		var migration *Migration
+		for k := range list {
+			if list[k].Version == versions[i] {
+				migration = &list[k]
+				break
+			}
+		}
+		if migration == nil {
+			return self.Error(util.AddStr("迁移版本[", versions[i], "]未注册,无法回滚"))
+		}
+		if err := self.execMigration(migration.Down, util.AddStr("delete from ", MIGRATION_TABLE, " where ds_name = ? and version = ?"), []interface{}{self.dsName(), migration.Version}); err != nil {
+			return err
+		}
+		steps--
+	}
+	return nil
+}
+
+// 执行迁移语句及迁移记录语句,支持事务DDL的数据库在同一事务中执行
+func (self *RDBManager) execMigration(sqlstr, record string, args []interface{}) error {
+	run := func(db *RDBManager) error {
+		if err := db.execMigrateSQL(nil, splitSQL(sqlstr)...); err != nil {
+			return err
+		}
+		_, err := db.ExecSQL(record, args)
+		return err
+	}
+	if self.Driver == POSTGRES || self.Driver == SQLITE {
+		return self.WithTx(run)
+	}
+	return run(self)
+}
+
+func containsVersion(versions []int64, version int64) bool {
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// 按;拆分多条SQL语句,忽略引号内的分号及空语句
+func splitSQL(sqlstr string) []string {
+	result := make([]string, 0)
+	var quote byte
+	begin := 0
+	for i := 0; i <= len(sqlstr); i++ {
+		if i < len(sqlstr) {
+			c := sqlstr[i]
+			if quote != 0 {
+				if c == quote {
+					quote = 0
+				}
+				continue
+			}
+			if c == '\'' || c == '"' || c == '`' {
+				quote = c
+				continue
+			}
+			if c != ';' {
+				continue
+			}
+		}
+		if stmt := strings.TrimSpace(sqlstr[begin:i]); len(stmt) > 0 {
+			result = append(result, stmt)
+		}
+		begin = i + 1
+	}
+	return result
+}
@@ -0,0 +1,90 @@
+package sqld
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type ddlWallet struct {
+	Id       int64    `json:"id" bson:"_id" tb:"ddl_wallet"`
+	AppID    string   `json:"appID" bson:"appID" size:"64" index:"idx_app_wallet"`
+	WalletID string   `json:"walletID" bson:"walletID" size:"64" index:"idx_app_wallet" unique:"true"`
+	Balance  string   `json:"balance" bson:"balance" dbtype:"decimal(20,8)"`
+	Applied  int64    `json:"applied" bson:"applied" date:"true"`
+	Trust    bool     `json:"trust" bson:"trust"`
+	Tags     []string `json:"tags" bson:"tags"`
+	Remark   *string  `json:"remark" bson:"remark"`
+}
+
+func TestBuildCreateTable(t *testing.T) {
+	stmts, err := (&RDBManager{Driver: MYSQL}).BuildCreateTable(&ddlWallet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"create table if not exists `ddl_wallet` (\n" +
+			"  `id` bigint not null auto_increment,\n" +
+			"  `appID` varchar(64) null,\n" +
+			"  `walletID` varchar(64) null,\n" +
+			"  `balance` decimal(20,8) null,\n" +
+			"  `applied` datetime null,\n" +
+			"  `trust` tinyint(1) null,\n" +
+			"  `tags` text null,\n" +
+			"  `remark` varchar(255) null,\n" +
+			"  primary key (`id`)\n" +
+			") engine=InnoDB default charset=utf8mb4",
+		"alter table `ddl_wallet` add index `idx_app_wallet` (`appID`, `walletID`)",
+		"alter table `ddl_wallet` add unique index `uk_ddl_wallet_walletID` (`walletID`)",
+	}
+	if !reflect.DeepEqual(stmts, expected) {
+		t.Errorf("unexpected ddl:\n%v", stmts)
+	}
+	// 启用自动ID时由应用生成ID,不使用自增列
+	stmts, err = (&RDBManager{Driver: MYSQL, DBManager: DBManager{Option: Option{AutoID: true}}}).BuildCreateTable(&ddlWallet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stmts[0], "  `id` bigint not null,\n") {
+		t.Errorf("unexpected auto id ddl:\n%s", stmts[0])
+	}
+}
+
+func TestMigrationRegistry(t *testing.T) {
+	if err := RegMigration("DDL", Migration{Version: 2, Up: "select 2"}, Migration{Version: 1, Up: "select 1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegMigration("DDL", Migration{Version: 1, Up: "select 1"}); err == nil {
+		t.Error("expected duplicated version error")
+	}
+	list := getMigrations("DDL")
+	if len(list) != 2 || list[0].Version != 1 || list[1].Version != 2 {
+		t.Errorf("unexpected migrations: %+v", list)
+	}
+	stmts := splitSQL("create table a (id int);\n insert into a values (';');;")
+	if !reflect.DeepEqual(stmts, []string{"create table a (id int)", "insert into a values (';')"}) {
+		t.Errorf("unexpected split sql: %v", stmts)
+	}
+}
+
+func TestSqliteMigrateTx(t *testing.T) {
+	db := newSqliteManager(t)
+	defer db.Close()
+	if err := RegMigration(db.DsName, Migration{Version: 1, Name: "mig_tx", Up: "create table mig_tx (id integer);\ninsert into mig_missing values (1);", Down: "drop table mig_tx"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(); err == nil {
+		t.Fatal("expected migration error")
+	}
+	// 迁移失败时已执行语句及迁移记录整体回滚
+	var count int64
+	if err := db.findBySQL("Migrate", false, "select count(1) from sqlite_master where type = 'table' and name = ?", []interface{}{"mig_tx"}, &count, nil); err != nil || count != 0 {
+		t.Errorf("expected migration rolled back: %d %v", count, err)
+	}
+	if versions, err := db.appliedVersions(); err != nil || len(versions) != 0 {
+		t.Errorf("unexpected applied versions: %v %v", versions, err)
+	}
+	if db.Tx != nil {
+		t.Error("expected transaction closed")
+	}
+}
@@ -0,0 +1,740 @@
+package sqld
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"github.com/godaddy-x/jorm/sqlc"
+	"github.com/godaddy-x/jorm/util"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/********************************** 模型元数据注册表 **********************************/
+
+// 字段写入转换,返回数据库参数值,ok为false时忽略该字段
+type fieldEncoder func(field *FieldMeta, value reflect.Value) (interface{}, bool, error)
+
+// 字段读取转换,将查询结果原始数据写入字段
+type fieldDecoder func(field *FieldMeta, raw []byte, value reflect.Value) error
+
+// 模型字段元数据
+type FieldMeta struct {
+	Name         string       // 结构体字段名称
+	Column       string       // 数据库列名(bson标签,ID字段为id)
+	JsonName     string       // json标签名称
+	Index        []int        // 结构体字段索引
+	Type         reflect.Type // 字段类型
+	Kind         reflect.Kind // 字段类型种类
+	IsId         bool         // 是否ID字段
+	IsDate       bool         // 是否date:"true"时间字段
+	IsVersion    bool         // 是否乐观锁版本字段
+	IsSoftDelete bool         // 是否逻辑删除字段
+	IsCreateTime bool         // 是否自动创建时间字段
+	IsUpdateTime bool         // 是否自动更新时间字段
+	Shard        string       // 分片策略(shard标签) mod/range/hash/time
+	DBType       string       // 数据库列类型(dbtype标签),为空时按字段类型推断
+	Size         int          // 列长度(size标签),字符串默认255
+	encoder      fieldEncoder
+	decoder      fieldDecoder
+}
+
+// 模型元数据,每个结构体类型仅解析一次
+type ModelMeta struct {
+	Type        reflect.Type    // 结构体类型
+	Table       string          // 数据表名称(tb标签)
+	SyncMongo   bool            // 是否同步mongo(mg标签)
+	Id          *FieldMeta      // ID字段
+	Fields      []*FieldMeta    // 非忽略字段,按声明顺序
+	Columns     []string        // 非忽略字段列名,与Fields顺序一致
+	Version     *FieldMeta      // 乐观锁版本字段
+	SoftDelete  *FieldMeta      // 逻辑删除字段
+	CreateTimes []*FieldMeta    // 自动创建时间字段
+	UpdateTimes []*FieldMeta    // 自动更新时间字段
+	Shard       *FieldMeta      // 分片键字段
+	Indexes     []*IndexMeta    // 索引及唯一索引,同名索引按字段声明顺序组合
+	Relations   []*RelationMeta // 关联字段(rel标签),不作为数据列
+	columns     map[string]*FieldMeta
+	jsons       map[string]*FieldMeta
+	err         error
+}
+
+// 模型索引元数据
+type IndexMeta struct {
+	Name    string   // 索引名称
+	Unique  bool     // 是否唯一索引
+	Columns []string // 索引列名
+}
+
+var modelRegistry sync.Map
+
+// 获取模型元数据,首次访问时解析并缓存
+func GetModelMeta(model interface{}) (*ModelMeta, error) {
+	if model == nil {
+		return nil, util.Error("ORM对象类型不能为空")
+	}
+	return getModelMeta(reflect.TypeOf(model))
+}
+
+func getModelMeta(tof reflect.Type) (*ModelMeta, error) {
+	for tof.Kind() == reflect.Ptr {
+		tof = tof.Elem()
+	}
+	if v, ok := modelRegistry.Load(tof); ok {
+		return v.(*ModelMeta), nil
+	}
+	if tof.Kind() != reflect.Struct {
+		return nil, util.Error("ORM对象类型必须为struct或ptr")
+	}
+	v, _ := modelRegistry.LoadOrStore(tof, parseModelMeta(tof))
+	return v.(*ModelMeta), nil
+}
+
+// 解析结构体字段及标签
+func parseModelMeta(tof reflect.Type) *ModelMeta {
+	meta := &ModelMeta{
+		Type:    tof,
+		columns: make(map[string]*FieldMeta, tof.NumField()),
+		jsons:   make(map[string]*FieldMeta, tof.NumField()),
+	}
+	for i := 0; i < tof.NumField(); i++ {
+		field := tof.Field(i)
+		if util.ValidIgnore(field) {
+			continue
+		}
+		if rel := field.Tag.Get(sqlc.Rel); len(rel) > 0 {
+			meta.addRelation(field, rel)
+			continue
+		}
+		f := &FieldMeta{
+			Name:         field.Name,
+			Column:       field.Tag.Get(sqlc.Bson),
+			JsonName:     field.Tag.Get(sqlc.Json),
+			Index:        field.Index,
+			Type:         field.Type,
+			Kind:         field.Type.Kind(),
+			IsId:         field.Name == sqlc.Id,
+			IsDate:       util.ValidDate(field),
+			IsVersion:    util.ValidVersion(field),
+			IsSoftDelete: util.ValidSoftDelete(field),
+			IsCreateTime: util.ValidAutoCreateTime(field),
+			IsUpdateTime: util.ValidAutoUpdateTime(field),
+			Shard:        field.Tag.Get(sqlc.Shard),
+			DBType:       field.Tag.Get(sqlc.DBType),
+		}
+		if size := field.Tag.Get(sqlc.Size); len(size) > 0 {
+			if n, err := strconv.Atoi(size); err == nil && n > 0 {
+				f.Size = n
+			}
+		}
+		f.encoder, f.decoder = getConverter(f)
+		if f.IsId {
+			f.Column = sqlc.BsonId
+			meta.Id = f
+			meta.Table = field.Tag.Get("tb")
+			meta.SyncMongo = field.Tag.Get(sqlc.Mg) == sqlc.True
+		}
+		if f.IsVersion && meta.Version == nil {
+			meta.Version = f
+		}
+		if f.IsSoftDelete && !isIntKind(f.Kind) {
+			// 非整数类型无法标记删除,忽略时删除将变为物理删除
+			meta.err = util.Error("逻辑删除字段[", f.Name, "]仅支持整数类型")
+		} else if f.IsSoftDelete && meta.SoftDelete == nil {
+			meta.SoftDelete = f
+		}
+		if len(f.Shard) > 0 && meta.Shard == nil {
+			meta.Shard = f
+		}
+		if f.Kind == reflect.Int64 || f.Kind == reflect.String {
+			if f.IsCreateTime {
+				meta.CreateTimes = append(meta.CreateTimes, f)
+			}
+			if f.IsUpdateTime {
+				meta.UpdateTimes = append(meta.UpdateTimes, f)
+			}
+		}
+		meta.Fields = append(meta.Fields, f)
+		meta.Columns = append(meta.Columns, f.Column)
+		if _, b := meta.columns[f.Column]; !b && len(f.Column) > 0 {
+			meta.columns[f.Column] = f
+		}
+		if _, b := meta.jsons[f.JsonName]; !b && len(f.JsonName) > 0 {
+			meta.jsons[f.JsonName] = f
+		}
+		meta.addIndex(field.Tag.Get(sqlc.Index), false, f.Column)
+		meta.addIndex(field.Tag.Get(sqlc.Unique), true, f.Column)
+	}
+	for _, index := range meta.Indexes {
+		if len(index.Name) == 0 {
+			prefix := "idx_"
+			if index.Unique {
+				prefix = "uk_"
+			}
+			index.Name = util.AddStr(prefix, meta.Table, "_", index.Columns[0])
+		}
+	}
+	if meta.err != nil {
+		return meta
+	}
+	if meta.Id == nil {
+		meta.err = util.Error("实体Id字段不能为空")
+	} else if len(meta.Table) == 0 {
+		meta.err = util.Error("实体数据库表名称标签不能为空")
+	}
+	return meta
+}
+
+// 添加索引列,name为true时自动命名,同名索引合并为组合索引
+func (self *ModelMeta) addIndex(name string, unique bool, column string) {
+	if len(name) == 0 || len(column) == 0 {
+		return
+	}
+	if name == sqlc.True {
+		self.Indexes = append(self.Indexes, &IndexMeta{Unique: unique, Columns: []string{column}})
+		return
+	}
+	for _, index := range self.Indexes {
+		if index.Name == name {
+			index.Columns = append(index.Columns, column)
+			return
+		}
+	}
+	self.Indexes = append(self.Indexes, &IndexMeta{Name: name, Unique: unique, Columns: []string{column}})
+}
+
+// 获取数据表名称
+func (self *ModelMeta) TableName() (string, error) {
+	if self.err != nil {
+		return "", self.err
+	}
+	return self.Table, nil
+}
+
+// 获取对象数据表名称
+func getTableName(model interface{}) (string, error) {
+	meta, err := GetModelMeta(model)
+	if err != nil {
+		return "", err
+	}
+	return meta.TableName()
+}
+
+// 检测是否同步mongo
+func validSyncMongo(model interface{}) (bool, error) {
+	meta, err := GetModelMeta(model)
+	if err != nil {
+		return false, util.Error("实体类型异常")
+	}
+	if meta.Id == nil {
+		return false, util.Error("实体Id字段不能为空")
+	}
+	return meta.SyncMongo, nil
+}
+
+// 按数据库列名获取字段
+func (self *ModelMeta) FieldByColumn(column string) *FieldMeta {
+	return self.columns[column]
+}
+
+// 是否包含列名,忽略大小写
+func (self *ModelMeta) hasColumn(column string) bool {
+	if self.columns[column] != nil {
+		return true
+	}
+	for _, field := range self.Fields {
+		if strings.EqualFold(field.Column, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// 按json标签获取字段
+func (self *ModelMeta) FieldByJson(name string) *FieldMeta {
+	return self.jsons[name]
+}
+
+// 查询字段列表,指定查询字段时按声明顺序筛选
+func (self *ModelMeta) selectFields(anyFields []string) ([]*FieldMeta, error) {
+	fields := make([]*FieldMeta, 0, len(self.Fields))
+	for _, field := range self.Fields {
+		if len(field.Column) == 0 {
+			return nil, util.Error("字段[", field.Name, "]无效bson标签")
+		}
+		if len(anyFields) > 0 && !util.CheckStr(field.Column, anyFields...) {
+			continue
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// 按json标签匹配查询结果列,未匹配的列为nil
+func (self *ModelMeta) columnFields(columns []string) []*FieldMeta {
+	fields := make([]*FieldMeta, len(columns))
+	for i := range columns {
+		if fields[i] = self.jsons[columns[i]]; fields[i] == nil {
+			fields[i] = self.foldField(columns[i])
+		}
+	}
+	return fields
+}
+
+// 忽略大小写匹配列名或json标签,PostgreSQL未加引号的列名返回小写
+func (self *ModelMeta) foldField(column string) *FieldMeta {
+	for _, field := range self.Fields {
+		if strings.EqualFold(field.JsonName, column) || strings.EqualFold(field.Column, column) {
+			return field
+		}
+	}
+	return nil
+}
+
+// 绑定查询字段到目标模型,类型一致时直接使用,否则按列名匹配目标json标签
+func (self *ModelMeta) bindFields(fields []*FieldMeta, target *ModelMeta) []*FieldMeta {
+	if self == target {
+		return fields
+	}
+	result := make([]*FieldMeta, len(fields))
+	for i := range fields {
+		if fields[i] != nil {
+			result[i] = target.jsons[fields[i].Column]
+		}
+	}
+	return result
+}
+
+// 获取对象ID值
+func (self *ModelMeta) getId(vof reflect.Value) int64 {
+	if self.Id == nil || !isIntKind(self.Id.Kind) {
+		return 0
+	}
+	return vof.FieldByIndex(self.Id.Index).Int()
+}
+
+// 获取对象ID值,对象无ID字段时返回0
+func getDataID(data interface{}) int64 {
+	meta, err := GetModelMeta(data)
+	if err != nil {
+		return 0
+	}
+	return meta.getId(reflect.Indirect(reflect.ValueOf(data)))
+}
+
+// 字段写入转换
+func (self *FieldMeta) encode(value reflect.Value) (interface{}, bool, error) {
+	return self.encoder(self, value)
+}
+
+// 字段读取转换,NULL值保持字段零值,指针类型为nil
+func (self *FieldMeta) decode(raw []byte, value reflect.Value) error {
+	return self.decoder(self, raw, value)
+}
+
+// 解析查询结果行到对象,字段为nil的列忽略
+func decodeRow(fields []*FieldMeta, raw [][]byte, vof reflect.Value) error {
+	for i := range fields {
+		if fields[i] == nil || i >= len(raw) {
+			continue
+		}
+		if err := fields[i].decode(raw[i], vof.FieldByIndex(fields[i].Index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 解析查询结果到单个对象
+func decodeOne(model *ModelMeta, fields []*FieldMeta, raw [][]byte, data interface{}) error {
+	vof := reflect.ValueOf(data)
+	if vof.Kind() != reflect.Ptr || vof.IsNil() {
+		return util.Error("返回值必须为指针类型")
+	}
+	target, err := getModelMeta(vof.Type())
+	if err != nil {
+		return err
+	}
+	return decodeRow(model.bindFields(fields, target), raw, vof.Elem())
+}
+
+// 解析查询结果集到切片,切片元素可为结构体或结构体指针
+func decodeList(model *ModelMeta, fields []*FieldMeta, raws [][][]byte, data interface{}) error {
+	resultv := reflect.ValueOf(data)
+	if resultv.Kind() != reflect.Ptr || resultv.Elem().Kind() != reflect.Slice {
+		return util.Error("列表结果参数必须是指针类型")
+	}
+	slicet := resultv.Elem().Type()
+	elemt := slicet.Elem()
+	isPtr := elemt.Kind() == reflect.Ptr
+	if isPtr {
+		elemt = elemt.Elem()
+	}
+	target, err := getModelMeta(elemt)
+	if err != nil {
+		return err
+	}
+	bind := model.bindFields(fields, target)
+	slicev := reflect.MakeSlice(slicet, 0, len(raws))
+	for i := range raws {
+		v := reflect.New(elemt)
+		if err := decodeRow(bind, raws[i], v.Elem()); err != nil {
+			return err
+		}
+		if isPtr {
+			slicev = reflect.Append(slicev, v)
+		} else {
+			slicev = reflect.Append(slicev, v.Elem())
+		}
+	}
+	resultv.Elem().Set(slicev)
+	return nil
+}
+
+func isIntKind(kind reflect.Kind) bool {
+	return kind == reflect.Int || kind == reflect.Int8 || kind == reflect.Int16 || kind == reflect.Int32 || kind == reflect.Int64
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	nullTimeType = reflect.TypeOf(sql.NullTime{})
+	valuerType   = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	scannerType  = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
+
+// 按字段类型获取读写转换器
+func getConverter(field *FieldMeta) (fieldEncoder, fieldDecoder) {
+	return getTypeConverter(field.Type, field.IsDate)
+}
+
+// 按类型获取读写转换器,优先使用driver.Valuer/sql.Scanner实现
+func getTypeConverter(typ reflect.Type, isDate bool) (fieldEncoder, fieldDecoder) {
+	var encoder fieldEncoder
+	var decoder fieldDecoder
+	if typ.Implements(valuerType) || reflect.PtrTo(typ).Implements(valuerType) {
+		encoder = encodeValuer
+	}
+	if typ == nullTimeType {
+		decoder = decodeNullTime
+	} else if reflect.PtrTo(typ).Implements(scannerType) {
+		decoder = decodeScanner
+	}
+	if encoder != nil && decoder != nil {
+		return encoder, decoder
+	}
+	enc, dec := getKindConverter(typ, isDate)
+	if encoder == nil {
+		encoder = enc
+	}
+	if decoder == nil {
+		decoder = dec
+	}
+	return encoder, decoder
+}
+
+// 按类型种类获取读写转换器,指针类型按元素类型转换并以nil表示NULL
+func getKindConverter(typ reflect.Type, isDate bool) (fieldEncoder, fieldDecoder) {
+	kind := typ.Kind()
+	switch {
+	case typ == timeType:
+		return encodeTime, decodeTime
+	case kind == reflect.String:
+		return encodeString, decodeString
+	case kind == reflect.Int64 && isDate:
+		return encodeDate, decodeDate
+	case isIntKind(kind):
+		return encodeInt, decodeInt
+	case isUintKind(kind):
+		return encodeUint, decodeUint
+	case kind == reflect.Float32 || kind == reflect.Float64:
+		return encodeFloat, decodeFloat
+	case kind == reflect.Bool:
+		return encodeBool, decodeBool
+	case kind == reflect.Slice && typ.Elem().Kind() == reflect.Uint8:
+		return encodeBytes, decodeBytes
+	case kind == reflect.Slice || kind == reflect.Map || kind == reflect.Struct || kind == reflect.Interface:
+		return encodeJson, decodeJson
+	case kind == reflect.Ptr:
+		encoder, decoder := getTypeConverter(typ.Elem(), isDate)
+		return encodePtr(encoder), decodePtr(decoder)
+	}
+	return encodeUnsupported, decodeUnsupported
+}
+
+func isUintKind(kind reflect.Kind) bool {
+	return kind == reflect.Uint || kind == reflect.Uint8 || kind == reflect.Uint16 || kind == reflect.Uint32 || kind == reflect.Uint64
+}
+
+// 转换条件参数,time.Time按写入时的时间格式字符串传入
+func encodeArg(arg interface{}) interface{} {
+	switch t := arg.(type) {
+	case time.Time:
+		return util.Date2Str(t)
+	case *time.Time:
+		if t == nil {
+			return nil
+		}
+		return util.Date2Str(*t)
+	}
+	return arg
+}
+
+func encodeString(field *FieldMeta, value reflect.Value) (interface{}, bool, error) {
+	return value.String(), true, nil
+}
+
+func decodeString(field *FieldMeta, raw []byte, value reflect.Value) error {
+	if raw == nil {
+		return nil
+	}
+	value.SetString(string(raw))
+	return nil
+}
+
+func encodeInt(field *FieldMeta, value reflect.Value) (interface{}, bool, error) {
+	return value.Int(), true, nil
+}
+
+func decodeInt(field *FieldMeta, raw []byte, value reflect.Value) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	i, err := strconv.ParseInt(string(raw), 10, value.Type().Bits())
+	if err != nil {
+		return util.Error("对象字段[", field.Column, "]转换", value.Kind().String(), "失败")
+	}
+	value.SetInt(i)
+	return nil
+}
+
+func encodeUint(field *FieldMeta, value reflect.Value) (interface{}, bool, error) {
+	return value.Uint(), true, nil
+}
+
+func decodeUint(field *FieldMeta, raw []byte, value reflect.Value) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	i, err := strconv.ParseUint(string(raw), 10, value.Type().Bits())
+	if err != nil {
+		return util.Error("对象字段[", field.Column, "]转换", value.Kind().String(), "失败")
+	}
+	value.SetUint(i)
+	return nil
+}
+
+func encodeFloat(field *FieldMeta, value reflect.Value) (interface{}, bool, error) {
+	return value.Float(), true, nil
+}
+
+func decodeFloat(field *FieldMeta, raw []byte, value reflect.Value) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	f, err := strconv.ParseFloat(string(raw), value.Type().Bits())
+	if err != nil {
+		return util.Error("对象字段[", field.Column, "]转换", value.Kind().String(), "失败")
+	}
+	value.SetFloat(f)
+	return nil
+}
+
+func encodeBool(field *FieldMeta, value reflect.Value) (interface{}, bool, error) {
+	return value.Bool(), true, nil
+}
+
+func decodeBool(field *FieldMeta, raw []byte, value reflect.Value) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	b, err := strconv.ParseBool(string(raw))
+	if err != nil {
+		return util.Error("对象字段[", field.Column, "]转换bool失败")
+	}
+	value.SetBool(b)
+	return nil
+}
+
+func encodeDate(field *FieldMeta, value reflect.Value) (interface{}, bool, error) {
+	rt := value.Int()
+	if rt < 0 {
+		rt = 0
+	}
+	return util.Time2Str(rt), true, nil
+}
+
+func decodeDate(field *FieldMeta, raw []byte, value reflect.Value) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	vs := string(raw)
+	if vs == "0000-00-00 00:00:00" {
+		value.SetInt(0)
+		return nil
+	}
+	i64, err := util.Str2Time(vs)
+	if err != nil {
+		// PostgreSQL等驱动时间类型按RFC3339格式返回
+		t, e := util.Str2Date(vs)
+		if e != nil {
+			return util.Error("对象字段[", field.Column, "]转换int64失败: ", err.Error())
+		}
+		i64 = util.Time(t)
+	}
+	value.SetInt(i64)
+	return nil
+}
+
+// time.Time零值不写入,与nil切片一致
+func encodeTime(field *FieldMeta, value reflect.Value) (interface{}, bool, error) {
+	t := value.Interface().(time.Time)
+	if t.IsZero() {
+		return nil, false, nil
+	}
+	return util.Date2Str(t), true, nil
+}
+
+func decodeTime(field *FieldMeta, raw []byte, value reflect.Value) error {
+	t, err := parseTime(field, raw)
+	if err != nil {
+		return err
+	}
+	value.Set(reflect.ValueOf(t))
+	return nil
+}
+
+func parseTime(field *FieldMeta, raw []byte) (time.Time, error) {
+	vs := string(raw)
+	if len(vs) == 0 || strings.HasPrefix(vs, "0000-00-00") {
+		return time.Time{}, nil
+	}
+	t, err := util.Str2Date(vs)
+	if err != nil {
+		return time.Time{}, util.Error("对象字段[", field.Column, "]转换time失败: ", err.Error())
+	}
+	return t, nil
+}
+
+func encodeBytes(field *FieldMeta, value reflect.Value) (interface{}, bool, error) {
+	if value.IsNil() {
+		return nil, false, nil
+	}
+	return value.Bytes(), true, nil
+}
+
+func decodeBytes(field *FieldMeta, raw []byte, value reflect.Value) error {
+	if raw == nil {
+		return nil
+	}
+	value.SetBytes(append([]byte{}, raw...))
+	return nil
+}
+
+func encodeJson(field *FieldMeta, value reflect.Value) (interface{}, bool, error) {
+	if value.Kind() != reflect.Struct && value.IsNil() {
+		return nil, false, nil
+	}
+	str, err := util.ObjectToJson(value.Interface())
+	if err != nil {
+		return nil, false, util.Error("字段[", field.Name, "]转换失败: ", err.Error())
+	}
+	return str, true, nil
+}
+
+func decodeJson(field *FieldMeta, raw []byte, value reflect.Value) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	return util.JsonToObject(string(raw), value.Addr().Interface())
+}
+
+// 指针类型nil写入NULL
+func encodePtr(encoder fieldEncoder) fieldEncoder {
+	return func(field *FieldMeta, value reflect.Value) (interface{}, bool, error) {
+		if value.IsNil() {
+			return nil, true, nil
+		}
+		v, ok, err := encoder(field, value.Elem())
+		if err != nil {
+			return nil, false, err
+		} else if !ok {
+			return nil, true, nil
+		}
+		return v, true, nil
+	}
+}
+
+// 指针类型NULL读取为nil
+func decodePtr(decoder fieldDecoder) fieldDecoder {
+	return func(field *FieldMeta, raw []byte, value reflect.Value) error {
+		if raw == nil {
+			value.Set(reflect.Zero(value.Type()))
+			return nil
+		}
+		elem := reflect.New(value.Type().Elem())
+		if err := decoder(field, raw, elem.Elem()); err != nil {
+			return err
+		}
+		value.Set(elem)
+		return nil
+	}
+}
+
+// driver.Valuer类型由数据库驱动调用Value()转换
+func encodeValuer(field *FieldMeta, value reflect.Value) (interface{}, bool, error) {
+	if value.Kind() == reflect.Ptr && value.IsNil() {
+		return nil, true, nil
+	}
+	if v, ok := value.Interface().(driver.Valuer); ok {
+		return v, true, nil
+	}
+	if value.CanAddr() {
+		if v, ok := value.Addr().Interface().(driver.Valuer); ok {
+			return v, true, nil
+		}
+	}
+	return nil, false, util.Error("字段[", field.Name, "]转换driver.Valuer失败")
+}
+
+// sql.Scanner类型由Scan读取原始数据,NULL时传入nil
+func decodeScanner(field *FieldMeta, raw []byte, value reflect.Value) error {
+	var src interface{}
+	if raw != nil {
+		src = raw
+	}
+	if err := value.Addr().Interface().(sql.Scanner).Scan(src); err != nil {
+		return util.Error("对象字段[", field.Column, "]转换失败: ", err.Error())
+	}
+	return nil
+}
+
+func decodeNullTime(field *FieldMeta, raw []byte, value reflect.Value) error {
+	nt := value.Addr().Interface().(*sql.NullTime)
+	if raw == nil {
+		return nt.Scan(nil)
+	}
+	t, err := parseTime(field, raw)
+	if err != nil {
+		return err
+	}
+	return nt.Scan(t)
+}
+
+func encodeUnsupported(field *FieldMeta, value reflect.Value) (interface{}, bool, error) {
+	str, err := util.ObjectToJson(value.Interface())
+	if err != nil {
+		fmt.Println("字段输出json失败: " + value.String())
+	}
+	fmt.Println(util.AddStr("警告: 不支持的字段[", field.Name, "]类型[", value.Kind().String(), "] --- ", str))
+	return nil, false, nil
+}
+
+func decodeUnsupported(field *FieldMeta, raw []byte, value reflect.Value) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	return util.Error("对象字段[", field.Column, "]转换失败([", value.Type().String(), "]类型不支持)")
+}
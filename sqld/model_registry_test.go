@@ -0,0 +1,257 @@
+package sqld
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"github.com/godaddy-x/jorm/sqlc"
+	"github.com/godaddy-x/jorm/util"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type benchWallet struct {
+	Id        int64             `json:"id" bson:"_id" tb:"ow_wallet" mg:"true"`
+	AppID     string            `json:"appID" bson:"appID"`
+	WalletID  string            `json:"walletID" bson:"walletID"`
+	Alias     string            `json:"alias" bson:"alias"`
+	IsTrust   int64             `json:"isTrust" bson:"isTrust"`
+	Keystore  string            `json:"keystore" bson:"keystore"`
+	Applytime int64             `json:"applytime" bson:"applytime" date:"true"`
+	Tags      []string          `json:"tags" bson:"tags"`
+	Extra     map[string]string `json:"extra" bson:"extra"`
+	Ctime     int64             `json:"ctime" bson:"ctime"`
+	State     int64             `json:"state" bson:"state"`
+}
+
+var benchRaw = [][]byte{
+	[]byte("1184287781917032448"), []byte("app"), []byte("wallet"), []byte("alias"), []byte("1"),
+	[]byte("keystore"), []byte("2019-10-16 10:20:30"), []byte(`["a","b"]`), []byte(`{"k":"v"}`),
+	[]byte("1571192430000"), []byte("1"),
+}
+
+func TestModelMetaDecode(t *testing.T) {
+	meta, err := GetModelMeta(&benchWallet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tb, err := meta.TableName(); err != nil || tb != "ow_wallet" {
+		t.Errorf("expected table ow_wallet, got: %s %v", tb, err)
+	}
+	if !meta.SyncMongo || meta.Id == nil || meta.Id.Column != sqlc.BsonId {
+		t.Errorf("unexpected id metadata: %+v", meta.Id)
+	}
+	fields, err := meta.selectFields(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet := benchWallet{}
+	if err := decodeOne(meta, fields, benchRaw, &wallet); err != nil {
+		t.Fatal(err)
+	}
+	expected := benchWallet{}
+	if str, err := DataToMap(benchFields(), benchRaw); err != nil {
+		t.Fatal(err)
+	} else if err := util.JsonToObject(str, &expected); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(wallet, expected) {
+		t.Errorf("registry decode mismatch: %+v != %+v", wallet, expected)
+	}
+}
+
+type upperString string
+
+func (self upperString) Value() (driver.Value, error) {
+	return strings.ToUpper(string(self)), nil
+}
+
+func (self *upperString) Scan(src interface{}) error {
+	if b, ok := src.([]byte); ok {
+		*self = upperString(strings.ToLower(string(b)))
+	}
+	return nil
+}
+
+type nativeModel struct {
+	Id       int64           `json:"id" bson:"_id" tb:"native_model"`
+	Price    float64         `json:"price" bson:"price"`
+	Rate     float32         `json:"rate" bson:"rate"`
+	Count    uint32          `json:"count" bson:"count"`
+	Enabled  bool            `json:"enabled" bson:"enabled"`
+	Birthday time.Time       `json:"birthday" bson:"birthday"`
+	Payload  []byte          `json:"payload" bson:"payload"`
+	Nick     *string         `json:"nick" bson:"nick"`
+	Score    *int64          `json:"score" bson:"score"`
+	Remark   sql.NullString  `json:"remark" bson:"remark"`
+	Amount   sql.NullInt64   `json:"amount" bson:"amount"`
+	Paytime  sql.NullTime    `json:"paytime" bson:"paytime"`
+	Code     upperString     `json:"code" bson:"code"`
+	Extra    struct{ A int } `json:"extra" bson:"extra"`
+}
+
+func TestModelMetaNativeTypes(t *testing.T) {
+	birthday := time.Date(2019, 10, 16, 10, 20, 30, 123000000, time.Local)
+	score := int64(99)
+	src := nativeModel{Price: 1.25, Rate: 0.5, Count: 7, Enabled: true, Birthday: birthday, Payload: []byte{0, 1, 2},
+		Score: &score, Remark: sql.NullString{String: "ok", Valid: true}, Code: "abc"}
+	src.Extra.A = 3
+	columns, _, values, _, err := new(RDBManager).buildInsertPart(&src, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := make([][]byte, len(columns))
+	for i := range values {
+		switch v := values[i].(type) {
+		case nil:
+		case []byte:
+			raw[i] = v
+		case driver.Valuer:
+			dv, err := v.Value()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dv != nil {
+				raw[i] = []byte(fmt.Sprint(dv))
+			}
+		case bool:
+			if v {
+				raw[i] = []byte("1")
+			} else {
+				raw[i] = []byte("0")
+			}
+		default:
+			raw[i] = []byte(fmt.Sprint(v))
+		}
+	}
+	meta, _ := GetModelMeta(&src)
+	fields := make([]*FieldMeta, len(columns))
+	for i := range columns {
+		fields[i] = meta.FieldByColumn(columns[i])
+	}
+	dst := nativeModel{}
+	if err := decodeRow(fields, raw, reflect.ValueOf(&dst).Elem()); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Price != src.Price || dst.Rate != src.Rate || dst.Count != src.Count || !dst.Enabled {
+		t.Errorf("numeric/bool mismatch: %+v", dst)
+	}
+	if !dst.Birthday.Equal(birthday) {
+		t.Errorf("time mismatch: %v != %v", dst.Birthday, birthday)
+	}
+	if string(dst.Payload) != string(src.Payload) {
+		t.Errorf("bytes mismatch: %v", dst.Payload)
+	}
+	if dst.Nick != nil || dst.Score == nil || *dst.Score != score {
+		t.Errorf("pointer mismatch: %v %v", dst.Nick, dst.Score)
+	}
+	if dst.Remark != src.Remark || dst.Amount.Valid || dst.Paytime.Valid {
+		t.Errorf("sql.Null* mismatch: %+v %+v %+v", dst.Remark, dst.Amount, dst.Paytime)
+	}
+	if dst.Code != "abc" || dst.Extra.A != 3 {
+		t.Errorf("valuer/struct mismatch: %v %+v", dst.Code, dst.Extra)
+	}
+}
+
+// 逐次反射解析字段(原实现)
+func benchFields() []reflect.StructField {
+	tof := reflect.TypeOf(benchWallet{})
+	fields := make([]reflect.StructField, 0, tof.NumField())
+	for i := 0; i < tof.NumField(); i++ {
+		field := tof.Field(i)
+		if util.ValidIgnore(field) {
+			continue
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func BenchmarkModelMetaReflect(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchFields()
+		if _, err := util.GetDbAndTb(&benchWallet{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkModelMetaRegistry(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		meta, err := GetModelMeta(&benchWallet{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := meta.TableName(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeJson(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		wallet := benchWallet{}
+		str, err := DataToMap(benchFields(), benchRaw)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := util.JsonToObject(str, &wallet); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeRegistry(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		wallet := benchWallet{}
+		meta, err := GetModelMeta(&wallet)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := decodeRow(meta.Fields, benchRaw, reflect.ValueOf(&wallet).Elem()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBuildInsertPart(b *testing.B) {
+	b.ReportAllocs()
+	db := &RDBManager{}
+	wallet := benchWallet{AppID: "app", WalletID: "wallet", Tags: []string{"a"}, Extra: map[string]string{"k": "v"}, Ctime: util.Time()}
+	for i := 0; i < b.N; i++ {
+		if _, _, _, _, err := db.buildInsertPart(&wallet, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type timeSoftDelete struct {
+	Id        int64     `json:"id" bson:"_id" tb:"time_soft_delete"`
+	DeletedAt time.Time `json:"deletedAt" bson:"deletedAt" softdelete:"true"`
+}
+
+type strSoftDelete struct {
+	Id        int64  `json:"id" bson:"_id" tb:"str_soft_delete"`
+	DeletedAt string `json:"deletedAt" bson:"deletedAt" softdelete:"true"`
+}
+
+func TestModelMetaSoftDeleteKind(t *testing.T) {
+	for _, model := range []interface{}{&timeSoftDelete{}, &strSoftDelete{}} {
+		meta, err := GetModelMeta(model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := meta.TableName(); err == nil {
+			t.Errorf("expected unsupported soft delete field rejected: %T", model)
+		}
+	}
+	if err := (&RDBManager{Driver: SQLITE}).Delete(&strSoftDelete{Id: 1}); err == nil {
+		t.Error("expected delete rejected instead of hard delete")
+	}
+}
@@ -1,6 +1,7 @@
 package sqld
 
 import (
+	"context"
 	"github.com/godaddy-x/jorm/cache"
 	"github.com/godaddy-x/jorm/log"
 	"github.com/godaddy-x/jorm/sqlc"
@@ -63,9 +64,46 @@ func (self *MGOManager) Get(option ...Option) (*MGOManager, error) {
 	}
 }
 
+// 设置上下文,后续数据库操作将在上下文超时或取消时中止
+func (self *MGOManager) WithContext(ctx context.Context) *MGOManager {
+	self.Context = ctx
+	return self
+}
+
+// 复制mongo会话,上下文存在截止时间时设置会话超时,上下文取消时关闭会话中止操作
+func (self *MGOManager) copySession() (*mgo.Session, func(), error) {
+	if err := self.contextError(); err != nil {
+		return nil, nil, self.Error(err)
+	}
+	session := self.Session.Copy()
+	if self.ForceMaster {
+		session.SetMode(mgo.Strong, false)
+	}
+	if self.Context == nil {
+		return session, session.Close, nil
+	}
+	if deadline, ok := self.Context.Deadline(); ok {
+		timeout := deadline.Sub(time.Now())
+		session.SetSocketTimeout(timeout)
+		session.SetSyncTimeout(timeout)
+	}
+	done := make(chan struct{})
+	go func(ctx context.Context) {
+		select {
+		case <-ctx.Done():
+			session.Close()
+		case <-done:
+		}
+	}(self.Context)
+	return session, func() {
+		close(done)
+		session.Close()
+	}, nil
+}
+
 // 获取mongo的数据库连接
 func (self *MGOManager) GetDatabase(copySession *mgo.Session, data interface{}) (*mgo.Collection, error) {
-	tb, err := util.GetDbAndTb(data)
+	tb, err := getTableName(data)
 	if err != nil {
 		return nil, err
 	}
@@ -194,102 +232,325 @@ func (self *MGOManager) getSlowLog() *zap.Logger {
 
 // 保存或更新数据到mongo集合
 func (self *MGOManager) Save(datas ...interface{}) error {
+	if err := runHooks(mgoHookDB{self}, beforeSave, datas...); err != nil {
+		return err
+	}
+	if err := self.save(datas...); err != nil {
+		return err
+	}
+	return runHooks(mgoHookDB{self}, afterSave, datas...)
+}
+
+func (self *MGOManager) save(datas ...interface{}) error {
 	if datas == nil || len(datas) == 0 {
 		return self.Error("参数列表不能为空")
 	}
 	start := util.Time()
-	defer self.debug("Save/Update", &datas, start)
-	copySession := self.Session.Copy()
-	defer copySession.Close()
-	var db *mgo.Collection
-	var err error
-	saveObjs := make([]interface{}, 0, len(datas))
-	for _, data := range datas {
-		if data == nil {
-			return self.Error("参数元素不能为空")
-		}
-		if reflect.ValueOf(data).Kind() != reflect.Ptr {
-			return self.Error("参数值必须为指针类型")
-		}
-		if db == nil {
-			db, err = self.GetDatabase(copySession, data)
+	return self.intercept(self.invocation("Save/Update", datas[0], &datas, start), func(inv *Invocation) error {
+		copySession, release, err := self.copySession()
+		if err != nil {
+			return err
+		}
+		defer release()
+		var db *mgo.Collection
+		saveObjs := make([]interface{}, 0, len(datas))
+		for _, data := range datas {
+			if data == nil {
+				return self.Error("参数元素不能为空")
+			}
+			if reflect.ValueOf(data).Kind() != reflect.Ptr {
+				return self.Error("参数值必须为指针类型")
+			}
+			if db == nil {
+				db, err = self.GetDatabase(copySession, data)
+				if err != nil {
+					return self.Error(err)
+				}
+			}
+			objectId := getDataID(data)
+			if objectId == 0 {
+				objectId = util.GetUUIDInt64()
+				v := reflect.ValueOf(data).Elem()
+				v.FieldByName("Id").Set(reflect.ValueOf(objectId))
+			}
+			setAutoTime(data, true)
+			pipe, err := self.buildPipeCondition(sqlc.M(nil).Eq("_id", objectId), true)
 			if err != nil {
-				return self.Error(err)
+				return self.Error(util.AddStr("mongo构建查询命令失败: ", err.Error()))
+			}
+			result := CountResult{}
+			if err := db.Pipe(pipe).One(&result); err != nil {
+				if err != mgo.ErrNotFound {
+					return self.ctxError(err, "[Mongo.Count]查询数据失败: ")
+				}
+			}
+			if result.Total == 0 {
+				saveObjs = append(saveObjs, data)
+				continue
+			}
+			setAutoTime(data, false)
+			if err := db.UpdateId(objectId, data); err != nil {
+				return self.ctxError(err, "mongo更新数据失败: ")
 			}
 		}
-		objectId := util.GetDataID(data)
-		if objectId == 0 {
-			objectId = util.GetUUIDInt64()
-			v := reflect.ValueOf(data).Elem()
-			v.FieldByName("Id").Set(reflect.ValueOf(objectId))
+		if len(saveObjs) > 0 {
+			if err := db.Insert(saveObjs...); err != nil {
+				return self.ctxError(err, "mongo保存数据失败: ")
+			}
 		}
-		pipe, err := self.buildPipeCondition(sqlc.M(nil).Eq("_id", objectId), true)
+		return nil
+	})
+}
+
+// 保存或更新数据到mongo集合,存在版本字段时按版本号乐观锁更新
+func (self *MGOManager) Update(datas ...interface{}) error {
+	if err := runHooks(mgoHookDB{self}, beforeUpdate, datas...); err != nil {
+		return err
+	}
+	if err := self.update(datas...); err != nil {
+		return err
+	}
+	return runHooks(mgoHookDB{self}, afterUpdate, datas...)
+}
+
+func (self *MGOManager) update(datas ...interface{}) error {
+	if datas == nil || len(datas) == 0 {
+		return self.Error("参数列表不能为空")
+	}
+	if datas[0] == nil {
+		return self.Error("参数元素不能为空")
+	}
+	if _, ok := getVersionField(datas[0]); !ok {
+		return self.save(datas...)
+	}
+	start := util.Time()
+	return self.intercept(self.invocation("Update", datas[0], &datas, start), func(inv *Invocation) error {
+		copySession, release, err := self.copySession()
 		if err != nil {
-			return self.Error(util.AddStr("mongo构建查询命令失败: ", err.Error()))
+			return err
 		}
-		result := CountResult{}
-		if err := db.Pipe(pipe).One(&result); err != nil {
-			if err != mgo.ErrNotFound {
-				return self.Error(util.Error("[Mongo.Count]查询数据失败: ", err))
+		defer release()
+		var db *mgo.Collection
+		for _, data := range datas {
+			if data == nil {
+				return self.Error("参数元素不能为空")
+			}
+			if reflect.ValueOf(data).Kind() != reflect.Ptr {
+				return self.Error("参数值必须为指针类型")
+			}
+			if db == nil {
+				db, err = self.GetDatabase(copySession, data)
+				if err != nil {
+					return self.Error(err)
+				}
+			}
+			objectId := getDataID(data)
+			if objectId == 0 {
+				return self.Error("对象ID值不能为空")
+			}
+			field, _ := getVersionField(data)
+			if field.Kind != reflect.Int64 {
+				return self.Error("版本字段必须为int64类型")
+			}
+			setAutoTime(data, false)
+			value := reflect.ValueOf(data).Elem().FieldByIndex(field.Index)
+			version := value.Int()
+			value.SetInt(version + 1)
+			if err := db.Update(bson.M{BID: objectId, field.Column: version}, data); err != nil {
+				value.SetInt(version)
+				if err == mgo.ErrNotFound {
+					return self.Error(ErrStaleObject)
+				}
+				return self.ctxError(err, "mongo更新数据失败: ")
 			}
 		}
-		if result.Total == 0 {
-			saveObjs = append(saveObjs, data)
-			continue
+		return nil
+	})
+}
+
+// 新增或更新数据,冲突时更新UpsertFields指定字段,为空时更新全部非ID字段
+func (self *MGOManager) Upsert(datas ...interface{}) error {
+	if datas == nil || len(datas) == 0 {
+		return self.Error("参数列表不能为空")
+	}
+	start := util.Time()
+	return self.intercept(self.invocation("Upsert", datas[0], &datas, start), func(inv *Invocation) error {
+		copySession, release, err := self.copySession()
+		if err != nil {
+			return err
 		}
-		if err := db.UpdateId(objectId, data); err != nil {
-			return self.Error(util.AddStr("mongo更新数据失败: ", err))
+		defer release()
+		var db *mgo.Collection
+		for _, data := range datas {
+			if data == nil {
+				return self.Error("参数元素不能为空")
+			}
+			if reflect.ValueOf(data).Kind() != reflect.Ptr {
+				return self.Error("参数值必须为指针类型")
+			}
+			if db == nil {
+				db, err = self.GetDatabase(copySession, data)
+				if err != nil {
+					return self.Error(err)
+				}
+			}
+			objectId := getDataID(data)
+			if objectId == 0 {
+				objectId = util.GetUUIDInt64()
+				v := reflect.ValueOf(data).Elem()
+				v.FieldByName("Id").Set(reflect.ValueOf(objectId))
+			}
+			setAutoTime(data, false)
+			setAutoTime(data, true)
+			doc := bson.M{}
+			if b, err := bson.Marshal(data); err != nil {
+				return self.Error(util.AddStr("mongo对象转换失败: ", err.Error()))
+			} else if err := bson.Unmarshal(b, doc); err != nil {
+				return self.Error(util.AddStr("mongo对象转换失败: ", err.Error()))
+			}
+			delete(doc, BID)
+			cnd := sqlc.M(data)
+			insert := bson.M{}
+			// 创建时间字段仅在新增时写入
+			for _, field := range getAutoTimeFields(data, true) {
+				name := field.Column
+				if v, b := doc[name]; b {
+					insert[name] = v
+					delete(doc, name)
+				}
+			}
+			for k, v := range doc {
+				if len(self.UpsertFields) > 0 && !util.CheckStr(k, self.UpsertFields...) {
+					insert[k] = v
+				} else {
+					cnd.UpdateKV[k] = v
+				}
+			}
+			upset := buildMongoUpset(cnd)
+			if len(insert) > 0 {
+				upset["$setOnInsert"] = insert
+			}
+			if _, err := db.UpsertId(objectId, upset); err != nil {
+				return self.ctxError(err, "mongo新增或更新数据失败: ")
+			}
 		}
+		return nil
+	})
+}
+
+// 按条件新增或更新数据,筛选条件为冲突键,UpdateKV为新增或更新字段
+func (self *MGOManager) UpsertByCnd(cnd *sqlc.Cnd) error {
+	start := util.Time()
+	if cnd.Model == nil {
+		return self.Error("ORM对象类型不能为空,请通过M(...)方法设置对象类型")
+	}
+	copySession, release, err := self.copySession()
+	if err != nil {
+		return err
 	}
-	if len(saveObjs) > 0 {
-		if err := db.Insert(saveObjs ...); err != nil {
-			return self.Error(util.AddStr("mongo保存数据失败: ", err))
+	defer release()
+	db, err := self.GetDatabase(copySession, cnd.Model)
+	if err != nil {
+		return self.Error(err)
+	}
+	// 冲突键匹配包含已逻辑删除数据,与关系数据库唯一键冲突行为一致
+	unscoped := *cnd
+	unscoped.IsUnscoped = true
+	match := buildMongoMatch(&unscoped)
+	unscoped.UpdateKV = autoUpdateKV(cnd.Model, cnd.UpdateKV, false)
+	upset := buildMongoUpset(&unscoped)
+	if len(match) == 0 {
+		return self.Error("筛选条件不能为空")
+	}
+	if len(upset) == 0 {
+		return self.Error("更新条件不能为空")
+	}
+	insert := map[string]interface{}{}
+	if _, b := cnd.UpdateKV[JID]; !b {
+		if _, b := match[BID]; !b {
+			insert[BID] = util.GetUUIDInt64()
 		}
 	}
-	return nil
+	// 创建时间字段仅在新增时写入
+	now := util.Time()
+	for _, field := range getAutoTimeFields(cnd.Model, true) {
+		name := field.Column
+		if _, b := unscoped.UpdateKV[name]; b {
+			continue
+		}
+		if _, b := match[name]; !b {
+			insert[name] = autoTimeValue(field, now, false)
+		}
+	}
+	if len(insert) > 0 {
+		upset["$setOnInsert"] = insert
+	}
+	return self.intercept(self.invocation("UpsertByCnd", cnd.Model, map[string]interface{}{"match": match, "upset": upset}, start), func(inv *Invocation) error {
+		if _, err := db.Upsert(match, upset); err != nil {
+			return self.ctxError(err, "mongo按条件新增或更新数据失败: ")
+		}
+		return nil
+	})
 }
 
-// 保存或更新数据到mongo集合
-func (self *MGOManager) Update(datas ...interface{}) error {
-	return self.Save(datas...)
+func (self *MGOManager) Delete(datas ...interface{}) error {
+	return self.deleteWithHooks("Delete", false, datas...)
 }
 
-func (self *MGOManager) Delete(datas ...interface{}) error {
+// 物理删除数据,忽略逻辑删除字段
+func (self *MGOManager) ForceDelete(datas ...interface{}) error {
+	return self.deleteWithHooks("ForceDelete", true, datas...)
+}
+
+func (self *MGOManager) deleteWithHooks(title string, force bool, datas ...interface{}) error {
+	if err := runHooks(mgoHookDB{self}, beforeDelete, datas...); err != nil {
+		return err
+	}
+	if err := self.delete(title, force, datas...); err != nil {
+		return err
+	}
+	return runHooks(mgoHookDB{self}, afterDelete, datas...)
+}
+
+func (self *MGOManager) delete(title string, force bool, datas ...interface{}) error {
 	if datas == nil || len(datas) == 0 {
 		return self.Error("参数列表不能为空")
 	}
 	start := util.Time()
-	defer self.debug("Delete", &datas, start)
-	copySession := self.Session.Copy()
-	defer copySession.Close()
-	var db *mgo.Collection
-	var err error
-	delIds := make([]interface{}, 0, len(datas))
-	for _, data := range datas {
-		if data == nil {
-			return self.Error("参数元素不能为空")
-		}
-		if reflect.ValueOf(data).Kind() != reflect.Ptr {
-			return self.Error("参数值必须为指针类型")
-		}
-		if db == nil {
-			db, err = self.GetDatabase(copySession, data)
-			if err != nil {
-				return self.Error(err)
-			}
+	return self.intercept(self.invocation(title, datas[0], &datas, start), func(inv *Invocation) error {
+		copySession, release, err := self.copySession()
+		if err != nil {
+			return err
 		}
-		objectId := util.GetDataID(data)
-		if objectId == 0 {
-			continue
+		defer release()
+		var db *mgo.Collection
+		delIds := make([]interface{}, 0, len(datas))
+		for _, data := range datas {
+			if data == nil {
+				return self.Error("参数元素不能为空")
+			}
+			if reflect.ValueOf(data).Kind() != reflect.Ptr {
+				return self.Error("参数值必须为指针类型")
+			}
+			if db == nil {
+				db, err = self.GetDatabase(copySession, data)
+				if err != nil {
+					return self.Error(err)
+				}
+			}
+			objectId := getDataID(data)
+			if objectId == 0 {
+				continue
+			}
+			delIds = append(delIds, objectId)
 		}
-		delIds = append(delIds, objectId)
-	}
-	if len(delIds) > 0 {
-		if _, err := db.RemoveAll(bson.M{"_id": bson.M{"$in": delIds}}); err != nil {
-			return self.Error(util.AddStr("删除数据ID失败", err))
+		if len(delIds) > 0 {
+			if err := removeAll(db, datas[0], bson.M{"_id": bson.M{"$in": delIds}}, force); err != nil {
+				return self.ctxError(err, "删除数据ID失败")
+			}
 		}
-	}
-	return nil
+		return nil
+	})
 }
 
 func (self *MGOManager) DeleteByIDs(data interface{}, ids ...interface{}) error {
@@ -297,22 +558,54 @@ func (self *MGOManager) DeleteByIDs(data interface{}, ids ...interface{}) error
 		return self.Error("参数列表不能为空")
 	}
 	//start := util.Time()
-	//defer self.debug("DeleteByIDs", &ids, start)
 	if reflect.ValueOf(data).Kind() != reflect.Ptr {
 		return self.Error("参数值必须为指针类型")
 	}
-	copySession := self.Session.Copy()
-	defer copySession.Close()
+	copySession, release, err := self.copySession()
+	if err != nil {
+		return err
+	}
+	defer release()
 	db, err := self.GetDatabase(copySession, data)
 	if err != nil {
 		return self.Error(err)
 	}
-	if _, err := db.RemoveAll(bson.M{"_id": bson.M{"$in": ids}}); err != nil {
-		return self.Error(util.AddStr("删除数据ID失败", err))
+	if err := removeAll(db, data, bson.M{"_id": bson.M{"$in": ids}}, false); err != nil {
+		return self.ctxError(err, "删除数据ID失败")
 	}
 	return nil
 }
 
+// 按条件删除数据
+func (self *MGOManager) DeleteByCnd(cnd *sqlc.Cnd) error {
+	start := util.Time()
+	if cnd.Model == nil {
+		return self.Error("ORM对象类型不能为空,请通过M(...)方法设置对象类型")
+	}
+	if len(cnd.Conditions) == 0 {
+		return self.Error("删除条件不能为空")
+	}
+	copySession, release, err := self.copySession()
+	if err != nil {
+		return err
+	}
+	defer release()
+	db, err := self.GetDatabase(copySession, cnd.Model)
+	if err != nil {
+		return self.Error(err)
+	}
+	match := buildMongoMatch(cnd)
+	if len(match) == 0 {
+		return self.Error("删除条件不能为空")
+	}
+	return self.intercept(self.invocation("DeleteByCnd", cnd.Model, match, start), func(inv *Invocation) error {
+		if err := removeAll(db, cnd.Model, match, cnd.IsUnscoped); err != nil {
+			return self.ctxError(err, "mongo按条件删除数据失败: ")
+		}
+		return nil
+	})
+}
+
 // 统计数据
 func (self *MGOManager) Count(cnd *sqlc.Cnd) (int64, error) {
 	start := util.Time()
@@ -325,13 +618,18 @@ func (self *MGOManager) Count(cnd *sqlc.Cnd) (int64, error) {
 		return 0, err
 	} else if isc && hasv {
 		ok = isc
-		defer self.debug("Count by Cache", make([]interface{}, 0), start)
+		self.intercept(self.invocation("Count by Cache", cnd.Model, make([]interface{}, 0), start), func(inv *Invocation) error {
+			return nil
+		})
 	} else if isc && !hasv {
 		defer self.putByCache(cnd, &pageTotal)
 	}
 	if !ok {
-		copySession := self.Session.Copy()
-		defer copySession.Close()
+		copySession, release, err := self.copySession()
+		if err != nil {
+			return 0, err
+		}
+		defer release()
 		db, err := self.GetDatabase(copySession, cnd.Model)
 		if err != nil {
 			return 0, self.Error(err)
@@ -340,16 +638,19 @@ func (self *MGOManager) Count(cnd *sqlc.Cnd) (int64, error) {
 		if err != nil {
 			return 0, self.Error(util.AddStr("mongo构建查询命令失败: ", err.Error()))
 		}
-		defer self.debug("Count", pipe, start)
-		result := CountResult{}
-		err = db.Pipe(pipe).One(&result)
-		if err != nil {
-			if err == mgo.ErrNotFound {
-				return 0, nil
+		if err := self.intercept(self.invocation("Count", cnd.Model, pipe, start), func(inv *Invocation) error {
+			result := CountResult{}
+			if err := db.Pipe(inv.Pipe).One(&result); err != nil {
+				if err == mgo.ErrNotFound {
+					return nil
+				}
+				return self.ctxError(err, "mongo查询数据失败: ")
 			}
-			return 0, self.Error(util.AddStr("mongo查询数据失败: ", err.Error()))
+			pageTotal = result.Total
+			return nil
+		}); err != nil {
+			return 0, err
 		}
-		pageTotal = result.Total
 	}
 	if pageTotal > 0 && cnd.Pagination.PageSize > 0 {
 		var pageCount int64
@@ -389,13 +690,19 @@ func (self *MGOManager) FindOne(cnd *sqlc.Cnd, data interface{}) error {
 	if isc, hasv, err := self.getByCache(cnd, data); err != nil {
 		return err
 	} else if isc && hasv {
-		defer self.debug("FindOne by Cache", make([]interface{}, 0), start)
-		return nil
+		inv := self.invocation("FindOne by Cache", elem, make([]interface{}, 0), start)
+		inv.Result = data
+		return self.intercept(inv, func(inv *Invocation) error {
+			return runAfterFind(mgoHookDB{self}, data)
+		})
 	} else if isc && !hasv {
 		defer self.putByCache(cnd, data)
 	}
-	copySession := self.Session.Copy()
-	defer copySession.Close()
+	copySession, release, err := self.copySession()
+	if err != nil {
+		return err
+	}
+	defer release()
 	db, err := self.GetDatabase(copySession, elem)
 	if err != nil {
 		return self.Error(err)
@@ -405,38 +712,45 @@ func (self *MGOManager) FindOne(cnd *sqlc.Cnd, data interface{}) error {
 	if err != nil {
 		return self.Error(util.AddStr("mongo构建查询命令失败: ", err.Error()))
 	}
-	defer self.debug("FindOne", pipe, start)
-	if len(cnd.Summaries) > 0 {
-		hasId := false
-		for k, _ := range cnd.Summaries {
-			if k == "_id" {
-				hasId = true
-				break
+	inv := self.invocation("FindOne", elem, pipe, start)
+	inv.Result = data
+	return self.intercept(inv, func(inv *Invocation) error {
+		if len(cnd.Summaries) > 0 {
+			hasId := false
+			for k, _ := range cnd.Summaries {
+				if k == "_id" {
+					hasId = true
+					break
+				}
 			}
-		}
-		if hasId {
-			result := map[string]interface{}{}
-			err = db.Pipe(pipe).One(&result)
-			if err != nil {
-				if err != mgo.ErrNotFound {
-					return self.Error(util.AddStr("mongo查询数据失败: ", err.Error()))
+			if hasId {
+				result := map[string]interface{}{}
+				err = db.Pipe(inv.Pipe).One(&result)
+				if err != nil {
+					if err != mgo.ErrNotFound {
+						return self.ctxError(err, "mongo查询数据失败: ")
+					}
 				}
+				idv, _ := result["id"]
+				result["_id"] = idv
+				if err := util.JsonToAny(&result, data); err != nil {
+					return self.Error(util.AddStr("mongo查询数据转换失败: ", err.Error()))
+				}
+				return nil
 			}
-			idv, _ := result["id"]
-			result["_id"] = idv
-			if err := util.JsonToAny(&result, data); err != nil {
-				return self.Error(util.AddStr("mongo查询数据转换失败: ", err.Error()))
+		}
+		err = db.Pipe(inv.Pipe).One(data)
+		if err != nil {
+			if err != mgo.ErrNotFound {
+				return self.ctxError(err, "mongo查询数据失败: ")
 			}
 			return nil
 		}
-	}
-	err = db.Pipe(pipe).One(data)
-	if err != nil {
-		if err != mgo.ErrNotFound {
-			return self.Error(util.AddStr("mongo查询数据失败: ", err.Error()))
+		if err := preload(mgoHookDB{self}, cnd, data); err != nil {
+			return self.Error(err)
 		}
-	}
-	return nil
+		return runAfterFind(mgoHookDB{self}, data)
+	})
 }
 
 // 查询多条数据
@@ -462,13 +776,19 @@ func (self *MGOManager) FindList(cnd *sqlc.Cnd, data interface{}) error {
 	if isc, hasv, err := self.getByCache(cnd, data); err != nil {
 		return err
 	} else if isc && hasv {
-		defer self.debug("FindList by Cache", make([]interface{}, 0), start)
-		return nil
+		inv := self.invocation("FindList by Cache", elem, make([]interface{}, 0), start)
+		inv.Result = data
+		return self.intercept(inv, func(inv *Invocation) error {
+			return runAfterFind(mgoHookDB{self}, data)
+		})
 	} else if isc && !hasv {
 		defer self.putByCache(cnd, data)
 	}
-	copySession := self.Session.Copy()
-	defer copySession.Close()
+	copySession, release, err := self.copySession()
+	if err != nil {
+		return err
+	}
+	defer release()
 	db, err := self.GetDatabase(copySession, elem)
 	if err != nil {
 		return self.Error(err)
@@ -477,14 +797,33 @@ func (self *MGOManager) FindList(cnd *sqlc.Cnd, data interface{}) error {
 	if err != nil {
 		return self.Error(util.AddStr("mongo构建查询命令失败: ", err.Error()))
 	}
-	defer self.debug("FindList", pipe, start)
-	err = db.Pipe(pipe).All(data)
-	if err != nil {
-		if err != mgo.ErrNotFound {
-			return self.Error(util.AddStr("mongo查询数据失败: ", err.Error()))
+	inv := self.invocation("FindList", elem, pipe, start)
+	inv.Result = data
+	return self.intercept(inv, func(inv *Invocation) error {
+		err = db.Pipe(inv.Pipe).All(data)
+		if err != nil {
+			if err != mgo.ErrNotFound {
+				return self.ctxError(err, "mongo查询数据失败: ")
+			}
 		}
-	}
-	return nil
+		if cnd.Keyset.Open {
+			meta, err := GetModelMeta(elem)
+			if err != nil {
+				return self.Error(err)
+			}
+			orders, err := keysetOrders(meta, cnd)
+			if err != nil {
+				return self.Error(err)
+			}
+			if err := finishKeyset(cnd, orders, keysetSize(cnd), data); err != nil {
+				return self.Error(err)
+			}
+		}
+		if err := preload(mgoHookDB{self}, cnd, data); err != nil {
+			return self.Error(err)
+		}
+		return runAfterFind(mgoHookDB{self}, data)
+	})
 }
 
 // 根据条件更新数据
@@ -493,26 +832,32 @@ func (self *MGOManager) UpdateByCnd(cnd *sqlc.Cnd) error {
 	if cnd.Model == nil {
 		return self.Error("ORM对象类型不能为空,请通过M(...)方法设置对象类型")
 	}
-	copySession := self.Session.Copy()
-	defer copySession.Close()
+	copySession, release, err := self.copySession()
+	if err != nil {
+		return err
+	}
+	defer release()
 	db, err := self.GetDatabase(copySession, cnd.Model)
 	if err != nil {
 		return self.Error(err)
 	}
 	match := buildMongoMatch(cnd)
-	upset := buildMongoUpset(cnd)
+	update := *cnd
+	update.UpdateKV = autoUpdateKV(cnd.Model, cnd.UpdateKV, false)
+	upset := buildMongoUpset(&update)
 	if len(match) == 0 {
 		return util.Error("筛选条件不能为空")
 	}
 	if len(upset) == 0 {
 		return util.Error("更新条件不能为空")
 	}
-	defer self.debug("UpdateByCnd", map[string]interface{}{"match": match, "upset": upset}, start)
-	_, err = db.UpdateAll(match, upset)
-	if err != nil {
-		return self.Error(util.AddStr("mongo按条件数据失败: ", err.Error()))
-	}
-	return nil
+	return self.intercept(self.invocation("UpdateByCnd", cnd.Model, map[string]interface{}{"match": match, "upset": upset}, start), func(inv *Invocation) error {
+		_, err = db.UpdateAll(match, upset)
+		if err != nil {
+			return self.ctxError(err, "mongo按条件数据失败: ")
+		}
+		return nil
+	})
 }
 
 func (self *MGOManager) Close() error {
@@ -527,7 +872,7 @@ func (self *MGOManager) getByCache(cnd *sqlc.Cnd, data interface{}) (bool, bool,
 		if self.CacheManager == nil {
 			return true, false, self.Error("缓存管理器尚未初始化")
 		}
-		b, err := self.CacheManager.Get(config.Prefix+config.Key, data);
+		b, err := self.CacheManager.Get(config.Prefix+config.Key, data)
 		return true, b, self.Error(err)
 	}
 	return false, false, nil
@@ -549,6 +894,27 @@ func (self *MGOManager) buildPipeCondition(cnd *sqlc.Cnd, iscount bool) ([]inter
 	match := buildMongoMatch(cnd)
 	project := buildMongoProject(cnd)
 	sortby := buildMongoSortBy(cnd)
+	// 游标分页追加边界条件,向前翻页时反向排序
+	if cnd.Keyset.Open && !iscount {
+		meta, err := GetModelMeta(cnd.Model)
+		if err != nil {
+			return nil, err
+		}
+		orders, err := keysetOrders(meta, cnd)
+		if err != nil {
+			return nil, err
+		}
+		seek, err := buildMongoKeyset(cnd, orders)
+		if err != nil {
+			return nil, err
+		}
+		if len(seek) > 0 && len(match) > 0 {
+			match = map[string]interface{}{"$and": []interface{}{match, seek}}
+		} else if len(seek) > 0 {
+			match = seek
+		}
+		sortby = buildMongoSortBy(keysetCnd(cnd, orders))
+	}
 	aggregate := buildSummary(cnd)
 	aggregate1 := buildMongoAggregate(cnd)
 	pageinfo := buildMongoLimit(cnd)
@@ -588,7 +954,7 @@ func (self *MGOManager) buildPipeCondition(cnd *sqlc.Cnd, iscount bool) ([]inter
 		tmp = make(map[string]interface{})
 		tmp["$limit"] = pageinfo[1]
 		pipe = append(pipe, tmp)
-		if !cnd.CacheConfig.Open && !cnd.Pagination.IsOffset {
+		if !cnd.CacheConfig.Open && !cnd.Pagination.IsOffset && !cnd.Keyset.Open {
 			pageTotal, err := self.Count(cnd)
 			if err != nil {
 				return nil, err
@@ -611,6 +977,25 @@ func (self *MGOManager) buildPipeCondition(cnd *sqlc.Cnd, iscount bool) ([]inter
 	return pipe, nil
 }
 
+// 获取对象乐观锁版本字段
+func getVersionField(model interface{}) (*FieldMeta, bool) {
+	meta, err := GetModelMeta(model)
+	if err != nil || meta.Version == nil {
+		return nil, false
+	}
+	return meta.Version, true
+}
+
+// 删除匹配数据,存在逻辑删除字段且非强制删除时更新删除标记
+func removeAll(db *mgo.Collection, model interface{}, match interface{}, force bool) error {
+	if field, ok := getSoftDeleteField(model); ok && !force {
+		_, err := db.UpdateAll(match, bson.M{"$set": bson.M{field.Column: softDeleteValue(field)}})
+		return err
+	}
+	_, err := db.RemoveAll(match)
+	return err
+}
+
 // 构建mongo逻辑条件命令
 func buildMongoMatch(cnd *sqlc.Cnd) map[string]interface{} {
 	var query = make(map[string]interface{})
@@ -687,6 +1072,15 @@ func buildMongoMatch(cnd *sqlc.Cnd) map[string]interface{} {
 			query["$or"] = array
 		}
 	}
+	// 存在逻辑删除字段时仅匹配未删除数据,已指定该字段条件时以$and合并
+	if field, ok := getSoftDeleteField(cnd.Model); ok && !cnd.IsUnscoped {
+		key := field.Column
+		if _, b := query[key]; b {
+			query["$and"] = []interface{}{map[string]interface{}{key: 0}}
+		} else {
+			query[key] = 0
+		}
+	}
 	return query
 }
 
@@ -721,22 +1115,15 @@ func buildMongoProject(cnd *sqlc.Cnd) map[string]int {
 }
 
 // 构建mongo排序命令
-func buildMongoSortBy(cnd *sqlc.Cnd) map[string]int {
-	var sortby = make(map[string]int)
+// 按声明顺序构建,多字段排序依赖字段顺序
+func buildMongoSortBy(cnd *sqlc.Cnd) bson.D {
+	var sortby = bson.D{}
 	orderbys := cnd.Orderbys
 	for _, orderby := range orderbys {
 		if orderby.Value == sqlc.DESC_ {
-			if orderby.Key == JID {
-				sortby[BID] = -1
-			} else {
-				sortby[orderby.Key] = -1
-			}
+			sortby = append(sortby, bson.DocElem{Name: mongoKey(orderby.Key), Value: -1})
 		} else if orderby.Value == sqlc.ASC_ {
-			if orderby.Key == JID {
-				sortby[BID] = 1
-			} else {
-				sortby[orderby.Key] = 1
-			}
+			sortby = append(sortby, bson.DocElem{Name: mongoKey(orderby.Key), Value: 1})
 		}
 	}
 	return sortby
@@ -850,6 +1237,9 @@ func buildMongoAggregate(cnd *sqlc.Cnd) []map[string]interface{} {
 
 // 构建mongo分页命令
 func buildMongoLimit(cnd *sqlc.Cnd) []int64 {
+	if cnd.Keyset.Open {
+		return []int64{0, keysetSize(cnd)}
+	}
 	pg := cnd.Pagination
 	if pg.PageNo == 0 && pg.PageSize == 0 {
 		return nil
@@ -867,18 +1257,8 @@ func buildMongoLimit(cnd *sqlc.Cnd) []int64 {
 	return nil
 }
 
-func (self *MGOManager) debug(title string, pipe interface{}, start int64) {
-	cost := util.Time() - start
-	if self.SlowQuery > 0 && cost > self.SlowQuery {
-		if title == "Count" || title == "FindOne" || title == "FindList" {
-			l := self.getSlowLog()
-			if l != nil {
-				l.Warn(title, log.Int64("cost", cost), log.Any("pipe", pipe))
-			}
-		}
-	}
-	if self.Debug {
-		str, _ := util.ObjectToJson(pipe)
-		log.Println(util.AddStr("mongo debug -> ", title, ": ", str, " --- cost: ", util.AnyToStr(util.Time()-start)))
-	}
+// 构建mongo拦截调用信息
+func (self *MGOManager) invocation(op string, model interface{}, pipe interface{}, start int64) *Invocation {
+	tb, _ := getTableName(model)
+	return &Invocation{Op: op, Driver: MONGO, Table: tb, Pipe: pipe, Start: start}
 }
@@ -45,31 +45,23 @@ func (self *MysqlManager) InitConfigAndCache(manager cache.ICache, input ...Mysq
 
 func (self *MysqlManager) buildByConfig(manager cache.ICache, input ...MysqlConfig) error {
 	for _, conf := range input {
-		link := util.AddStr(conf.Username, ":", conf.Password, "@tcp(", conf.Host, ":", util.AnyToStr(conf.Port), ")/"+conf.Database, "?charset=utf8")
-		db, err := sql.Open("mysql", link)
-		if err != nil {
-			panic(util.AddStr("mysql初始化失败: ", err.Error()))
-		}
-		db.SetMaxIdleConns(conf.MaxIdleConns)
-		db.SetMaxOpenConns(conf.MaxOpenConns)
-		db.SetConnMaxLifetime(time.Second * time.Duration(conf.ConnMaxLifetime))
-		rdb := &RDBManager{}
-		rdb.Db = db
-		rdb.SlowQuery = conf.SlowQuery
-		rdb.SlowLogPath = conf.SlowLogPath
-		rdb.Debug = conf.Debug
-		rdb.CacheSync = conf.CacheSync
-		rdb.CacheManager = manager
-		if len(conf.DsName) == 0 {
-			rdb.DsName = MASTER
-		} else {
-			rdb.DsName = conf.DsName
-		}
-		rdb.initSlowLog()
-		rdbs[rdb.DsName] = rdb
+		buildRDB(MYSQL, conf.DBConfig, manager, conf.open)
 	}
 	if len(rdbs) == 0 {
 		panic("mysql连接初始化失败: 数据源为0")
 	}
 	return nil
 }
+
+// 按配置创建mysql连接池
+func (self *MysqlConfig) open(host string, port int, username, password string) *sql.DB {
+	link := util.AddStr(username, ":", password, "@tcp(", host, ":", util.AnyToStr(port), ")/"+self.Database, "?charset=utf8")
+	db, err := sql.Open("mysql", link)
+	if err != nil {
+		panic(util.AddStr("mysql初始化失败: ", err.Error()))
+	}
+	db.SetMaxIdleConns(self.MaxIdleConns)
+	db.SetMaxOpenConns(self.MaxOpenConns)
+	db.SetConnMaxLifetime(time.Second * time.Duration(self.ConnMaxLifetime))
+	return db
+}
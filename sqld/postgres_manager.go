@@ -0,0 +1,103 @@
+package sqld
+
+import (
+	"database/sql"
+	"github.com/godaddy-x/jorm/cache"
+	"github.com/godaddy-x/jorm/util"
+	_ "github.com/lib/pq"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// postgres配置参数
+type PostgresConfig struct {
+	DBConfig
+	SSLMode         string // SSL模式 disable/require/verify-full,默认disable
+	MaxIdleConns    int
+	MaxOpenConns    int
+	ConnMaxLifetime int
+}
+
+// postgres连接管理器
+type PostgresManager struct {
+	RDBManager
+}
+
+func (self *PostgresManager) Get(option ...Option) (*PostgresManager, error) {
+	if option != nil && len(option) > 0 {
+		if err := self.GetDB(option[0]); err != nil {
+			return nil, err
+		}
+		return self, nil
+	} else {
+		if err := self.GetDB(); err != nil {
+			return nil, err
+		}
+		return self, nil
+	}
+}
+
+func (self *PostgresManager) InitConfig(input ...PostgresConfig) error {
+	return self.buildByConfig(nil, input...)
+}
+
+func (self *PostgresManager) InitConfigAndCache(manager cache.ICache, input ...PostgresConfig) error {
+	return self.buildByConfig(manager, input...)
+}
+
+func (self *PostgresManager) buildByConfig(manager cache.ICache, input ...PostgresConfig) error {
+	for _, conf := range input {
+		buildRDB(POSTGRES, conf.DBConfig, manager, conf.open)
+	}
+	if len(rdbs) == 0 {
+		panic("postgres连接初始化失败: 数据源为0")
+	}
+	return nil
+}
+
+// 构建postgres连接串,参数值按lib/pq规则加单引号并转义
+func (self *PostgresConfig) dsn(host string, port int, username, password string) string {
+	sslmode := self.SSLMode
+	if len(sslmode) == 0 {
+		sslmode = "disable"
+	}
+	return util.AddStr("host=", dsnValue(host), " port=", util.AnyToStr(port), " user=", dsnValue(username), " password=", dsnValue(password), " dbname=", dsnValue(self.Database), " sslmode=", dsnValue(sslmode))
+}
+
+func dsnValue(value string) string {
+	return util.AddStr("'", strings.Replace(strings.Replace(value, `\`, `\\`, -1), "'", `\'`, -1), "'")
+}
+
+// 按配置创建postgres连接池
+func (self *PostgresConfig) open(host string, port int, username, password string) *sql.DB {
+	db, err := sql.Open("postgres", self.dsn(host, port, username, password))
+	if err != nil {
+		panic(util.AddStr("postgres初始化失败: ", err.Error()))
+	}
+	db.SetMaxIdleConns(self.MaxIdleConns)
+	db.SetMaxOpenConns(self.MaxOpenConns)
+	db.SetConnMaxLifetime(time.Second * time.Duration(self.ConnMaxLifetime))
+	return db
+}
+
+// 是否通过returning子句回填数据库生成的ID
+func (self *RDBManager) returningId() bool {
+	return self.Driver == POSTGRES && !self.AutoID
+}
+
+// 读取returning子句返回的ID并按顺序回填,返回读取行数
+func scanReturning(rows *sql.Rows, idValues []reflect.Value) (int64, error) {
+	var count int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return count, err
+		}
+		if int(count) < len(idValues) && idValues[count].IsValid() {
+			idValues[count].SetInt(id)
+		}
+		count++
+	}
+	return count, rows.Err()
+}
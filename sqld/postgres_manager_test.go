@@ -0,0 +1,58 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/jorm/sqlc"
+	"reflect"
+	"testing"
+)
+
+func TestPostgresRebind(t *testing.T) {
+	db := &RDBManager{Driver: POSTGRES}
+	if s := db.rebind("select * from t where a = ? and b = '?' and c in (?,?)"); s != "select * from t where a = $1 and b = '?' and c in ($2,$3)" {
+		t.Errorf("unexpected rebind sql: %s", s)
+	}
+	if s := (&RDBManager{Driver: MYSQL}).rebind("select ?"); s != "select ?" {
+		t.Errorf("mysql placeholder should be kept: %s", s)
+	}
+	part, _ := db.BuildWhereCase(sqlc.M(&rawWallet{}).Like("app_id", "x"))
+	if part.String() != ` "app_id" like '%' || ? || '%' and` {
+		t.Errorf("unexpected like sql: %s", part.String())
+	}
+	limitSql, err := db.BuildPagination(sqlc.M(&rawWallet{}).Offset(20, 10), "select id from raw_wallet", nil)
+	if err != nil || limitSql != "select id from raw_wallet limit 10 offset 20" {
+		t.Errorf("unexpected limit sql: %s %v", limitSql, err)
+	}
+}
+
+func TestPostgresDsn(t *testing.T) {
+	conf := &PostgresConfig{DBConfig: DBConfig{Database: "my db"}}
+	dsn := conf.dsn("127.0.0.1", 5432, "root", `p w'd\`)
+	if dsn != `host='127.0.0.1' port=5432 user='root' password='p w\'d\\' dbname='my db' sslmode='disable'` {
+		t.Errorf("unexpected dsn: %s", dsn)
+	}
+}
+
+func TestPostgresCreateTable(t *testing.T) {
+	stmts, err := (&RDBManager{Driver: POSTGRES}).BuildCreateTable(&ddlWallet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"create table if not exists \"ddl_wallet\" (\n" +
+			"  \"id\" bigint generated by default as identity,\n" +
+			"  \"appid\" varchar(64) null,\n" +
+			"  \"walletid\" varchar(64) null,\n" +
+			"  \"balance\" decimal(20,8) null,\n" +
+			"  \"applied\" timestamp null,\n" +
+			"  \"trust\" boolean null,\n" +
+			"  \"tags\" text null,\n" +
+			"  \"remark\" varchar(255) null,\n" +
+			"  primary key (\"id\")\n" +
+			")",
+		"create index \"idx_app_wallet\" on \"ddl_wallet\" (\"appid\", \"walletid\")",
+		"create unique index \"uk_ddl_wallet_walletid\" on \"ddl_wallet\" (\"walletid\")",
+	}
+	if !reflect.DeepEqual(stmts, expected) {
+		t.Errorf("unexpected ddl:\n%v", stmts)
+	}
+}
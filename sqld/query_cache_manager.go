@@ -0,0 +1,201 @@
+package sqld
+
+import (
+	"bytes"
+	"database/sql"
+	"github.com/godaddy-x/jorm/sqlc"
+	"github.com/godaddy-x/jorm/util"
+	"log"
+	"strings"
+)
+
+/********************************** 查询结果缓存实现 **********************************/
+
+// 数据表缓存版本键前缀,写操作更新版本号,旧版本缓存不再命中并随过期时间淘汰
+const cacheGenPrefix = "jorm:gen:"
+
+// 缓存查询结果,保存原始行数据,命中后按当前字段规则解析
+type cacheRows struct {
+	Columns []string   `json:"columns"`
+	Raws    [][][]byte `json:"raws"`
+}
+
+// 是否启用查询缓存,事务中可能读取未提交数据,不读写缓存
+func (self *RDBManager) cacheable(cnd *sqlc.Cnd) bool {
+	return cnd != nil && cnd.CacheConfig.Open && !self.AutoTx && len(self.shardTable) == 0
+}
+
+// 获取查询涉及的数据表,复杂查询包含主表及连接表,存在原生表达式时无法失效,不使用缓存
+func cacheTables(cnd *sqlc.Cnd) []string {
+	tables := make([]string, 0, len(cnd.JoinCond)+1)
+	if cnd.Model != nil {
+		table, err := getTableName(cnd.Model)
+		if err != nil {
+			return nil
+		}
+		tables = append(tables, table)
+	}
+	if len(cnd.FromCond.Table) == 0 {
+		return tables
+	}
+	specs := []string{cnd.FromCond.Table}
+	for _, cond := range cnd.JoinCond {
+		specs = append(specs, cond.Table)
+	}
+	for _, spec := range specs {
+		table, _, err := parseTable(spec)
+		if err != nil {
+			return nil
+		}
+		if _, ok := sqlc.IsRaw(table); ok {
+			return nil
+		}
+		parts := strings.Split(table, ".")
+		if table = parts[len(parts)-1]; !containsFold(tables, table) {
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+func (self *RDBManager) cacheGenKey(table string) string {
+	ds := self.DsName
+	if len(ds) == 0 {
+		ds = MASTER
+	}
+	return util.AddStr(cacheGenPrefix, ds, ":", strings.ToLower(table))
+}
+
+// 获取数据表当前缓存版本号,未写入时为空
+func (self *RDBManager) cacheGen(table string) (string, error) {
+	var gen string
+	if _, err := self.CacheManager.Get(self.cacheGenKey(table), &gen); err != nil {
+		return "", err
+	}
+	return gen, nil
+}
+
+// 构建缓存键,包含涉及数据表的版本号,未指定Key时按规范化SQL及参数摘要生成,统计结果追加:count区分
+func (self *RDBManager) cacheKey(cnd *sqlc.Cnd, query string, args []interface{}, count bool) (string, error) {
+	tables := cacheTables(cnd)
+	if len(tables) == 0 {
+		return "", nil
+	}
+	var key bytes.Buffer
+	key.WriteString(cnd.CacheConfig.Prefix)
+	for _, table := range tables {
+		gen, err := self.cacheGen(table)
+		if err != nil {
+			return "", err
+		}
+		key.WriteString(strings.ToLower(table))
+		key.WriteString(":")
+		key.WriteString(gen)
+		key.WriteString(":")
+	}
+	if len(cnd.CacheConfig.Key) > 0 {
+		key.WriteString(cnd.CacheConfig.Key)
+	} else {
+		s, err := util.ObjectToJson(args)
+		if err != nil {
+			return "", err
+		}
+		key.WriteString(util.MD5(util.AddStr(strings.Join(strings.Fields(query), " "), "|", s)))
+	}
+	if count {
+		key.WriteString(":count")
+	}
+	return key.String(), nil
+}
+
+// 获取缓存结果,返回缓存键及是否命中,未启用缓存时返回空键,count为true时获取统计结果
+func (self *RDBManager) getByCache(cnd *sqlc.Cnd, query string, args []interface{}, count bool, data interface{}) (string, bool, error) {
+	if !self.cacheable(cnd) {
+		return "", false, nil
+	}
+	if self.CacheManager == nil {
+		return "", false, self.Error("缓存管理器尚未初始化")
+	}
+	key, err := self.cacheKey(cnd, query, args, count)
+	if err != nil {
+		return "", false, self.Error(err)
+	}
+	if len(key) == 0 {
+		return "", false, nil
+	}
+	hit, err := self.CacheManager.Get(key, data)
+	if err != nil {
+		return "", false, self.Error(err)
+	}
+	return key, hit, nil
+}
+
+// 缓存结果,写入失败不影响查询结果
+func (self *RDBManager) putByCache(cnd *sqlc.Cnd, key string, data interface{}) {
+	if len(key) == 0 {
+		return
+	}
+	if err := self.CacheManager.Put(key, data, cnd.CacheConfig.Expire); err != nil {
+		log.Print(util.AddStr("查询结果缓存失败: ", err.Error()))
+	}
+}
+
+// 经查询缓存执行查询,命中时跳过数据库查询,返回结果列及原始行数据
+func (self *RDBManager) queryRows(cnd *sqlc.Cnd, inv *Invocation) ([]string, [][][]byte, error) {
+	var result cacheRows
+	key, hit, err := self.getByCache(cnd, inv.SQL, inv.Args, false, &result)
+	if err != nil {
+		return nil, nil, err
+	} else if hit {
+		inv.Op = util.AddStr(inv.Op, " by Cache")
+		err := self.intercept(inv, func(inv *Invocation) error {
+			return nil
+		})
+		return result.Columns, result.Raws, err
+	}
+	err = self.query(inv, true, func(rows *sql.Rows) error {
+		var err error
+		if result.Columns, err = rows.Columns(); err != nil {
+			return self.ctxError(err, "读取查询结果列长度失败: ")
+		}
+		if result.Raws, err = EchoResultRows(rows, len(result.Columns)); err != nil {
+			return self.ctxError(err, "读取查询结果失败: ")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	self.putByCache(cnd, key, &result)
+	return result.Columns, result.Raws, nil
+}
+
+// 使模型数据表查询缓存失效,同一数据表仅更新一次版本号,事务中延迟至提交后执行
+func (self *RDBManager) expireCache(models ...interface{}) {
+	if self.CacheManager == nil {
+		return
+	}
+	tables := make([]string, 0, 1)
+	for _, model := range models {
+		if model == nil {
+			continue
+		}
+		if table, err := getTableName(model); err == nil && !containsFold(tables, table) {
+			tables = append(tables, table)
+		}
+	}
+	for _, table := range tables {
+		if !self.AutoTx {
+			self.expireTable(table)
+		} else if !containsFold(self.cacheTables, table) {
+			self.cacheTables = append(self.cacheTables, table)
+		}
+	}
+}
+
+// 写入新的数据表缓存版本号,缓存管理器无原子递增,使用唯一ID代替读取后递增,并发写入时各自写入的版本号均不同于旧版本
+func (self *RDBManager) expireTable(table string) {
+	if err := self.CacheManager.Put(self.cacheGenKey(table), util.GetUUID(int64(self.Node))); err != nil {
+		log.Print(util.AddStr("数据表[", table, "]查询缓存失效失败: ", err.Error()))
+	}
+}
@@ -0,0 +1,144 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/jorm/cache"
+	"github.com/godaddy-x/jorm/sqlc"
+	"github.com/godaddy-x/jorm/util"
+	"sync"
+	"testing"
+)
+
+// 按JSON序列化保存的内存缓存,与redis缓存行为一致
+type jsonCache struct {
+	cache.CacheManager
+	mu   sync.Mutex
+	data map[string]string
+	hits int
+}
+
+func (self *jsonCache) Get(key string, input interface{}) (bool, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	value, ok := self.data[key]
+	if !ok {
+		return false, nil
+	}
+	self.hits++
+	return true, util.JsonToObject(value, input)
+}
+
+func (self *jsonCache) Put(key string, input interface{}, expire ...int) error {
+	value, err := util.ObjectToJson(input)
+	if err != nil {
+		return err
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.data[key] = value
+	return nil
+}
+
+type cacheWallet struct {
+	Id      int64  `json:"id" bson:"_id" tb:"cache_wallet"`
+	AppID   string `json:"-" bson:"appID"`
+	Balance int64  `json:"balance" bson:"balance"`
+}
+
+func TestCacheTables(t *testing.T) {
+	cnd := sqlc.M(&joinUser{}).From("join_user u").Join(sqlc.LEFT_, "test.join_wallet w", "u.walletID = w.id")
+	if tables := cacheTables(cnd); len(tables) != 2 || tables[0] != "join_user" || tables[1] != "join_wallet" {
+		t.Errorf("unexpected cache tables: %v", tables)
+	}
+	if tables := cacheTables(sqlc.M(&joinUser{}).From(sqlc.Raw("(select 1) t"))); tables != nil {
+		t.Errorf("expected raw table not cacheable: %v", tables)
+	}
+}
+
+func TestSqliteQueryCache(t *testing.T) {
+	db := newSqliteManager(t)
+	defer db.Close()
+	store := &jsonCache{data: make(map[string]string)}
+	db.CacheManager = store
+	if err := db.AutoMigrate(&cacheWallet{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Save(&cacheWallet{Id: 1, AppID: "a", Balance: 10}, &cacheWallet{Id: 2, AppID: "a", Balance: 20}); err != nil {
+		t.Fatal(err)
+	}
+	cnd := func() *sqlc.Cnd {
+		return sqlc.M(&cacheWallet{}).Eq("appID", "a").Orderby("id", sqlc.ASC_).Cache(sqlc.CacheConfig{Expire: 60})
+	}
+	named := make([]*cacheWallet, 0)
+	if err := db.FindList(sqlc.M(&cacheWallet{}).Limit(1, 10).Cache(sqlc.CacheConfig{Key: "wallets"}), &named); err != nil || len(named) != 2 {
+		t.Fatal(named, err)
+	}
+	if err := db.FindList(sqlc.M(&cacheWallet{}).Limit(1, 10).Cache(sqlc.CacheConfig{Key: "wallets"}), &named); err != nil || len(named) != 2 {
+		t.Fatal(named, err)
+	}
+	list := func() []*cacheWallet {
+		result := make([]*cacheWallet, 0)
+		if err := db.FindList(cnd().Limit(1, 10), &result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	first := list()
+	if len(first) != 2 || first[0].AppID != "a" {
+		t.Fatalf("unexpected result: %+v", first)
+	}
+	// 绕过ORM修改数据,缓存命中时仍返回旧结果
+	if _, err := db.ExecSQL("update cache_wallet set balance = 99 where id = 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	hits := store.hits
+	if cached := list(); len(cached) != 2 || cached[0].Balance != 10 || cached[0].AppID != "a" || store.hits <= hits {
+		t.Errorf("expected cached result: %+v", cached[0])
+	}
+	if total, err := db.Count(cnd()); err != nil || total != 2 {
+		t.Fatal(total, err)
+	}
+	one := cacheWallet{}
+	if err := db.FindOne(cnd().Eq("id", 2), &one); err != nil || one.Balance != 20 {
+		t.Fatal(one, err)
+	}
+	// 写操作更新数据表版本,旧缓存不再命中
+	if err := db.Save(&cacheWallet{Id: 3, AppID: "a", Balance: 30}); err != nil {
+		t.Fatal(err)
+	}
+	if fresh := list(); len(fresh) != 3 || fresh[0].Balance != 99 {
+		t.Errorf("expected invalidated result: %+v", fresh)
+	}
+	if total, err := db.Count(cnd()); err != nil || total != 3 {
+		t.Fatal(total, err)
+	}
+	// 原生SQL指定模型时使查询缓存失效
+	if _, err := db.ExecSQL("update cache_wallet set balance = 98 where id = 1", nil, &cacheWallet{}); err != nil {
+		t.Fatal(err)
+	}
+	if fresh := list(); len(fresh) != 3 || fresh[0].Balance != 98 {
+		t.Errorf("expected invalidated raw sql result: %+v", fresh[0])
+	}
+	// 事务中不读写缓存,提交后失效
+	gen, err := db.cacheGen("cache_wallet")
+	if err != nil || len(gen) == 0 {
+		t.Fatal(gen, err)
+	}
+	err = db.WithTx(func(tx *RDBManager) error {
+		if err := tx.DeleteByIDs(&cacheWallet{}, 3); err != nil {
+			return err
+		}
+		if total, err := tx.Count(cnd()); err != nil || total != 2 {
+			t.Errorf("unexpected count in tx: %d %v", total, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total, err := db.Count(cnd()); err != nil || total != 2 {
+		t.Fatal(total, err)
+	}
+	if fresh, err := db.cacheGen("cache_wallet"); err != nil || len(fresh) == 0 || fresh == gen {
+		t.Errorf("unexpected generation: %s -> %s %v", gen, fresh, err)
+	}
+}
@@ -0,0 +1,304 @@
+package sqld
+
+import (
+	"bytes"
+	"database/sql"
+	"github.com/godaddy-x/jorm/dialect"
+	"github.com/godaddy-x/jorm/sqlc"
+	"github.com/godaddy-x/jorm/util"
+	"reflect"
+)
+
+/********************************** 原生SQL查询实现 **********************************/
+
+// 按原生SQL查询数据
+// args为nil,切片(按?位置参数),map[string]interface{}或结构体(按:name命名参数)
+// result可为结构体,结构体切片,map[string]interface{}及其切片,基础类型及其切片
+// page不为空时按方言分页,非下标分页时回写PageTotal和PageCount
+func (self *RDBManager) FindBySQL(sqlstr string, args interface{}, result interface{}, page ...*dialect.Dialect) error {
+	if len(page) > 0 {
+		return self.findBySQL("FindBySQL", true, sqlstr, args, result, page[0])
+	}
+	return self.findBySQL("FindBySQL", true, sqlstr, args, result, nil)
+}
+
+// 按原生SQL查询数据,read为true时优先使用从库
+func (self *RDBManager) findBySQL(title string, read bool, sqlstr string, args interface{}, result interface{}, page *dialect.Dialect) error {
+	start := util.Time()
+	if len(sqlstr) == 0 {
+		return self.Error("SQL语句不能为空")
+	}
+	if result == nil {
+		return self.Error("返回值不能为空")
+	}
+	if reflect.TypeOf(result).Kind() != reflect.Ptr {
+		return self.Error("返回值必须为指针类型")
+	}
+	query, values, err := bindSQLArgs(sqlstr, args)
+	if err != nil {
+		return self.Error(err)
+	}
+	if page != nil {
+		cnd := &sqlc.Cnd{Pagination: *page}
+		if query, err = self.BuildPagination(cnd, query, values); err != nil {
+			return self.Error(err)
+		}
+		page.PageTotal = cnd.Pagination.PageTotal
+		page.PageCount = cnd.Pagination.PageCount
+	}
+	var raws [][][]byte
+	var columns []string
+	inv := self.invocation(title, nil, query, values, start)
+	inv.Result = result
+	err = self.query(inv, read, func(rows *sql.Rows) error {
+		var err error
+		if columns, err = rows.Columns(); err != nil {
+			return self.ctxError(err, "读取查询结果列失败: ")
+		}
+		if raws, err = EchoResultRows(rows, len(columns)); err != nil {
+			return self.ctxError(err, "读取查询结果失败: ")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := decodeRaws(columns, raws, result); err != nil {
+		return self.Error(err)
+	}
+	return runAfterFind(self, result)
+}
+
+// 按原生SQL执行写操作,返回影响行数,参数规则与FindBySQL一致
+// models为SQL写入的数据表模型,执行成功后使其查询缓存失效,未指定时不使查询缓存失效
+func (self *RDBManager) ExecSQL(sqlstr string, args interface{}, models ...interface{}) (int64, error) {
+	start := util.Time()
+	if len(sqlstr) == 0 {
+		return 0, self.Error("SQL语句不能为空")
+	}
+	query, values, err := bindSQLArgs(sqlstr, args)
+	if err != nil {
+		return 0, self.Error(err)
+	}
+	var rowsAffected int64
+	err = self.exec(self.invocation("ExecSQL", nil, query, values, start), "执行SQL失败: ", func(ret sql.Result) error {
+		rowsAffected, err = ret.RowsAffected()
+		if err != nil {
+			return self.ctxError(err, "获取影响行数失败: ")
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	self.expireCache(models...)
+	return rowsAffected, nil
+}
+
+// 绑定SQL参数,命名参数:name转换为?,切片类型命名参数展开为?,?,?
+func bindSQLArgs(sqlstr string, args interface{}) (string, []interface{}, error) {
+	if args == nil {
+		return sqlstr, nil, nil
+	}
+	if values, ok := args.([]interface{}); ok {
+		result := make([]interface{}, 0, len(values))
+		for _, v := range values {
+			result = append(result, encodeArg(v))
+		}
+		return sqlstr, result, nil
+	}
+	vof := reflect.ValueOf(args)
+	for vof.Kind() == reflect.Ptr {
+		if vof.IsNil() {
+			return sqlstr, nil, nil
+		}
+		vof = vof.Elem()
+	}
+	var lookup func(name string) (interface{}, bool, error)
+	switch {
+	case vof.Kind() == reflect.Map && vof.Type().Key().Kind() == reflect.String:
+		lookup = func(name string) (interface{}, bool, error) {
+			v := vof.MapIndex(reflect.ValueOf(name).Convert(vof.Type().Key()))
+			if !v.IsValid() {
+				return nil, false, nil
+			}
+			return v.Interface(), true, nil
+		}
+	case vof.Kind() == reflect.Struct && vof.Type() != timeType && !vof.Type().Implements(valuerType):
+		meta, err := getModelMeta(vof.Type())
+		if err != nil {
+			return "", nil, err
+		}
+		lookup = func(name string) (interface{}, bool, error) {
+			field := meta.FieldByJson(name)
+			if field == nil {
+				field = meta.FieldByColumn(name)
+			}
+			if field == nil {
+				return nil, false, nil
+			}
+			v, ok, err := field.encode(vof.FieldByIndex(field.Index))
+			if err != nil || !ok {
+				return nil, true, err
+			}
+			return v, true, nil
+		}
+	case vof.Kind() == reflect.Slice && vof.Type().Elem().Kind() != reflect.Uint8:
+		result := make([]interface{}, 0, vof.Len())
+		for i := 0; i < vof.Len(); i++ {
+			result = append(result, encodeArg(vof.Index(i).Interface()))
+		}
+		return sqlstr, result, nil
+	default:
+		return sqlstr, []interface{}{encodeArg(args)}, nil
+	}
+	return bindNamedSQL(sqlstr, lookup)
+}
+
+// 解析命名参数,忽略引号内容及::类型转换
+func bindNamedSQL(sqlstr string, lookup func(name string) (interface{}, bool, error)) (string, []interface{}, error) {
+	var sqlbuf bytes.Buffer
+	values := make([]interface{}, 0)
+	var quote byte
+	for i := 0; i < len(sqlstr); i++ {
+		c := sqlstr[i]
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+			sqlbuf.WriteByte(c)
+			continue
+		}
+		if c == '\'' || c == '"' || c == '`' {
+			quote = c
+			sqlbuf.WriteByte(c)
+			continue
+		}
+		if c != ':' || i+1 >= len(sqlstr) || !isNameStart(sqlstr[i+1]) || (i > 0 && sqlstr[i-1] == ':') {
+			sqlbuf.WriteByte(c)
+			continue
+		}
+		j := i + 1
+		for j < len(sqlstr) && isNamePart(sqlstr[j]) {
+			j++
+		}
+		name := sqlstr[i+1 : j]
+		value, ok, err := lookup(name)
+		if err != nil {
+			return "", nil, err
+		} else if !ok {
+			return "", nil, util.Error("命名参数[", name, "]不存在")
+		}
+		vof := reflect.ValueOf(value)
+		if vof.Kind() == reflect.Slice && vof.Type().Elem().Kind() != reflect.Uint8 {
+			if vof.Len() == 0 {
+				return "", nil, util.Error("命名参数[", name, "]列表不能为空")
+			}
+			for k := 0; k < vof.Len(); k++ {
+				if k > 0 {
+					sqlbuf.WriteString(",")
+				}
+				sqlbuf.WriteString("?")
+				values = append(values, encodeArg(vof.Index(k).Interface()))
+			}
+		} else {
+			sqlbuf.WriteString("?")
+			values = append(values, encodeArg(value))
+		}
+		i = j - 1
+	}
+	return sqlbuf.String(), values, nil
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNamePart(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+// 解析原生查询结果,结构体按列名或json标签匹配字段
+func decodeRaws(columns []string, raws [][][]byte, result interface{}) error {
+	resultv := reflect.ValueOf(result).Elem()
+	typ := resultv.Type()
+	if typ.Kind() == reflect.Slice && typ.Elem().Kind() != reflect.Uint8 {
+		elemt := typ.Elem()
+		isPtr := elemt.Kind() == reflect.Ptr
+		if isPtr {
+			elemt = elemt.Elem()
+		}
+		if elemt.Kind() == reflect.Struct && elemt != timeType && !reflect.PtrTo(elemt).Implements(scannerType) {
+			meta, err := getModelMeta(elemt)
+			if err != nil {
+				return err
+			}
+			return decodeList(meta, rawFields(meta, columns), raws, result)
+		}
+		slicev := reflect.MakeSlice(typ, 0, len(raws))
+		for i := range raws {
+			v := reflect.New(elemt)
+			if err := decodeRaw(columns, raws[i], v.Elem()); err != nil {
+				return err
+			}
+			if isPtr {
+				slicev = reflect.Append(slicev, v)
+			} else {
+				slicev = reflect.Append(slicev, v.Elem())
+			}
+		}
+		resultv.Set(slicev)
+		return nil
+	}
+	if len(raws) == 0 {
+		return nil
+	}
+	if typ.Kind() == reflect.Struct && typ != timeType && !reflect.PtrTo(typ).Implements(scannerType) {
+		meta, err := getModelMeta(typ)
+		if err != nil {
+			return err
+		}
+		return decodeOne(meta, rawFields(meta, columns), raws[0], result)
+	}
+	return decodeRaw(columns, raws[0], resultv)
+}
+
+// 解析单行结果到map或基础类型,基础类型取首列
+func decodeRaw(columns []string, raw [][]byte, value reflect.Value) error {
+	if value.Kind() == reflect.Map {
+		if value.Type().Key().Kind() != reflect.String || value.Type().Elem().Kind() != reflect.Interface {
+			return util.Error("返回结果map类型必须为map[string]interface{}")
+		}
+		mmp := make(map[string]interface{}, len(columns))
+		for i := range columns {
+			if raw[i] == nil {
+				mmp[columns[i]] = nil
+			} else {
+				mmp[columns[i]] = string(raw[i])
+			}
+		}
+		value.Set(reflect.ValueOf(mmp))
+		return nil
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	field := &FieldMeta{Name: columns[0], Column: columns[0], Type: value.Type(), Kind: value.Kind()}
+	_, decoder := getTypeConverter(value.Type(), false)
+	return decoder(field, raw[0], value)
+}
+
+// 按列名匹配字段,未匹配时按json标签匹配,均未匹配时忽略大小写匹配
+func rawFields(meta *ModelMeta, columns []string) []*FieldMeta {
+	fields := make([]*FieldMeta, len(columns))
+	for i := range columns {
+		if field := meta.FieldByColumn(columns[i]); field != nil {
+			fields[i] = field
+		} else if field := meta.FieldByJson(columns[i]); field != nil {
+			fields[i] = field
+		} else {
+			fields[i] = meta.foldField(columns[i])
+		}
+	}
+	return fields
+}
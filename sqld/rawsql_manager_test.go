@@ -0,0 +1,60 @@
+package sqld
+
+import (
+	"reflect"
+	"testing"
+)
+
+type rawWallet struct {
+	Id      int64   `json:"id" bson:"_id" tb:"raw_wallet"`
+	AppID   string  `json:"appID" bson:"app_id"`
+	Balance float64 `json:"balance" bson:"balance"`
+	Remark  *string `json:"remark" bson:"remark"`
+}
+
+func TestBindSQLArgs(t *testing.T) {
+	query, args, err := bindSQLArgs("select * from t where a = :a and b in (:b) and c = ':a' and d::text = :a", map[string]interface{}{"a": 1, "b": []string{"x", "y"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != "select * from t where a = ? and b in (?,?) and c = ':a' and d::text = ?" {
+		t.Errorf("unexpected named sql: %s", query)
+	}
+	if !reflect.DeepEqual(args, []interface{}{1, "x", "y", 1}) {
+		t.Errorf("unexpected named args: %v", args)
+	}
+	query, args, err = bindSQLArgs("update t set app_id = :appID where id = :id", &rawWallet{Id: 7, AppID: "app"})
+	if err != nil || query != "update t set app_id = ? where id = ?" || !reflect.DeepEqual(args, []interface{}{"app", int64(7)}) {
+		t.Errorf("unexpected struct args: %s %v %v", query, args, err)
+	}
+	if _, _, err := bindSQLArgs("select :missing", map[string]interface{}{}); err == nil {
+		t.Error("expected missing named parameter error")
+	}
+	if _, args, _ := bindSQLArgs("select ?", int64(3)); !reflect.DeepEqual(args, []interface{}{int64(3)}) {
+		t.Errorf("unexpected positional args: %v", args)
+	}
+}
+
+func TestDecodeRaws(t *testing.T) {
+	columns := []string{"id", "app_id", "balance", "remark"}
+	raws := [][][]byte{{[]byte("1"), []byte("a"), []byte("1.5"), nil}, {[]byte("2"), []byte("b"), []byte("2"), []byte("r")}}
+	list := []*rawWallet{}
+	if err := decodeRaws(columns, raws, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].AppID != "a" || list[0].Remark != nil || *list[1].Remark != "r" {
+		t.Errorf("unexpected struct list: %+v", list)
+	}
+	maps := []map[string]interface{}{}
+	if err := decodeRaws(columns, raws, &maps); err != nil || maps[1]["app_id"] != "b" || maps[0]["remark"] != nil {
+		t.Errorf("unexpected map list: %v %v", maps, err)
+	}
+	var id int64
+	if err := decodeRaws(columns, raws, &id); err != nil || id != 1 {
+		t.Errorf("unexpected scalar: %d %v", id, err)
+	}
+	ids := []string{}
+	if err := decodeRaws(columns, raws, &ids); err != nil || !reflect.DeepEqual(ids, []string{"1", "2"}) {
+		t.Errorf("unexpected scalar list: %v %v", ids, err)
+	}
+}
@@ -0,0 +1,234 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/jorm/sqlc"
+	"github.com/godaddy-x/jorm/util"
+	"reflect"
+	"strings"
+)
+
+/********************************** 关联预加载实现 **********************************/
+
+// 关联类型
+const (
+	HAS_ONE    = "hasOne"
+	HAS_MANY   = "hasMany"
+	BELONGS_TO = "belongsTo"
+)
+
+// 模型关联元数据
+type RelationMeta struct {
+	Name       string       // 结构体字段名称
+	JsonName   string       // json标签名称
+	Kind       string       // 关联类型 hasOne/hasMany/belongsTo
+	Index      []int        // 结构体字段索引
+	Type       reflect.Type // 字段类型
+	Target     reflect.Type // 关联模型结构体类型
+	ForeignKey string       // 外键列名(fk标签),hasOne/hasMany为关联模型列,belongsTo为当前模型列
+	RefKey     string       // 引用列名(ref标签),默认id,hasOne/hasMany为当前模型列,belongsTo为关联模型列
+}
+
+// 解析关联字段,hasMany字段必须为结构体切片,hasOne/belongsTo字段必须为结构体或结构体指针
+func (self *ModelMeta) addRelation(field reflect.StructField, kind string) {
+	rel := &RelationMeta{
+		Name:       field.Name,
+		JsonName:   field.Tag.Get(sqlc.Json),
+		Kind:       kind,
+		Index:      field.Index,
+		Type:       field.Type,
+		ForeignKey: field.Tag.Get(sqlc.Fk),
+		RefKey:     field.Tag.Get(sqlc.Ref),
+	}
+	if len(rel.RefKey) == 0 {
+		rel.RefKey = sqlc.BsonId
+	}
+	target := field.Type
+	switch kind {
+	case HAS_MANY:
+		if target.Kind() != reflect.Slice {
+			self.err = util.Error("关联字段[", field.Name, "]类型必须为切片")
+			return
+		}
+		target = target.Elem()
+	case HAS_ONE, BELONGS_TO:
+	default:
+		self.err = util.Error("关联字段[", field.Name, "]关联类型[", kind, "]无效")
+		return
+	}
+	if target.Kind() == reflect.Ptr {
+		target = target.Elem()
+	}
+	if target.Kind() != reflect.Struct {
+		self.err = util.Error("关联字段[", field.Name, "]关联类型必须为结构体")
+		return
+	}
+	if len(rel.ForeignKey) == 0 {
+		self.err = util.Error("关联字段[", field.Name, "]外键(fk标签)不能为空")
+		return
+	}
+	rel.Target = target
+	self.Relations = append(self.Relations, rel)
+}
+
+// 按字段名称或json标签获取关联字段
+func (self *ModelMeta) RelationByName(name string) *RelationMeta {
+	for _, rel := range self.Relations {
+		if rel.Name == name || (len(rel.JsonName) > 0 && rel.JsonName == name) {
+			return rel
+		}
+	}
+	return nil
+}
+
+// 按列名,json标签或忽略大小写获取字段
+func (self *ModelMeta) fieldByKey(key string) *FieldMeta {
+	if field := self.FieldByColumn(key); field != nil {
+		return field
+	}
+	if field := self.FieldByJson(key); field != nil {
+		return field
+	}
+	return self.foldField(key)
+}
+
+// 预加载关联数据,每个关联按IN条件批量查询一次并回填到结果对象
+func preload(db IDBase, cnd *sqlc.Cnd, data interface{}) error {
+	if len(cnd.Preloads) == 0 || cnd.Model == nil {
+		return nil
+	}
+	meta, err := GetModelMeta(cnd.Model)
+	if err != nil {
+		return err
+	}
+	rows := preloadRows(meta, data)
+	if len(rows) == 0 {
+		return nil
+	}
+	// 多级关联按首级字段分组,剩余路径传递给关联查询
+	names := make([]string, 0, len(cnd.Preloads))
+	nested := make(map[string][]string, len(cnd.Preloads))
+	for _, preload := range cnd.Preloads {
+		name, rest := preload, ""
+		if i := strings.Index(preload, "."); i > 0 {
+			name, rest = preload[:i], preload[i+1:]
+		}
+		if _, ok := nested[name]; !ok {
+			names = append(names, name)
+			nested[name] = make([]string, 0)
+		}
+		if len(rest) > 0 {
+			nested[name] = append(nested[name], rest)
+		}
+	}
+	for _, name := range names {
+		rel := meta.RelationByName(name)
+		if rel == nil {
+			return util.Error("关联字段[", name, "]不存在")
+		}
+		if err := preloadRelation(db, meta, rel, rows, nested[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 获取结果对象,仅处理与模型类型一致的结构体或结构体切片
+func preloadRows(meta *ModelMeta, data interface{}) []reflect.Value {
+	vof := reflect.Indirect(reflect.ValueOf(data))
+	if vof.Kind() == reflect.Struct {
+		if vof.Type() != meta.Type {
+			return nil
+		}
+		return []reflect.Value{vof}
+	}
+	if vof.Kind() != reflect.Slice {
+		return nil
+	}
+	rows := make([]reflect.Value, 0, vof.Len())
+	for i := 0; i < vof.Len(); i++ {
+		row := reflect.Indirect(vof.Index(i))
+		if row.IsValid() && row.Type() == meta.Type {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// 按关联键批量查询关联数据并按键值分组回填
+func preloadRelation(db IDBase, meta *ModelMeta, rel *RelationMeta, rows []reflect.Value, nested []string) error {
+	target, err := getModelMeta(rel.Target)
+	if err != nil {
+		return err
+	}
+	ownerKey, targetKey := rel.RefKey, rel.ForeignKey
+	if rel.Kind == BELONGS_TO {
+		ownerKey, targetKey = rel.ForeignKey, rel.RefKey
+	}
+	ownerField := meta.fieldByKey(ownerKey)
+	if ownerField == nil {
+		return util.Error("关联字段[", rel.Name, "]关联键[", ownerKey, "]不存在")
+	}
+	targetField := target.fieldByKey(targetKey)
+	if targetField == nil {
+		return util.Error("关联字段[", rel.Name, "]关联键[", targetKey, "]不存在")
+	}
+	keys := make([]interface{}, 0, len(rows))
+	exists := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		v := row.FieldByIndex(ownerField.Index)
+		if v.IsZero() {
+			continue
+		}
+		if k := util.AnyToStr(v.Interface()); !exists[k] {
+			exists[k] = true
+			keys = append(keys, v.Interface())
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	list := reflect.New(reflect.SliceOf(reflect.PtrTo(rel.Target)))
+	sub := sqlc.M(reflect.New(rel.Target).Interface()).In(targetField.Column, keys...).Preload(nested...)
+	if err := db.FindList(sub, list.Interface()); err != nil {
+		return err
+	}
+	groups := make(map[string][]reflect.Value, len(keys))
+	for i := 0; i < list.Elem().Len(); i++ {
+		elem := list.Elem().Index(i)
+		k := util.AnyToStr(elem.Elem().FieldByIndex(targetField.Index).Interface())
+		groups[k] = append(groups[k], elem)
+	}
+	for _, row := range rows {
+		v := row.FieldByIndex(ownerField.Index)
+		if v.IsZero() {
+			continue
+		}
+		attachRelation(rel, row.FieldByIndex(rel.Index), groups[util.AnyToStr(v.Interface())])
+	}
+	return nil
+}
+
+// 回填关联数据,hasMany按切片元素类型回填,hasOne/belongsTo取首条
+func attachRelation(rel *RelationMeta, field reflect.Value, elems []reflect.Value) {
+	if rel.Kind == HAS_MANY {
+		isPtr := rel.Type.Elem().Kind() == reflect.Ptr
+		slice := reflect.MakeSlice(rel.Type, 0, len(elems))
+		for _, elem := range elems {
+			if isPtr {
+				slice = reflect.Append(slice, elem)
+			} else {
+				slice = reflect.Append(slice, elem.Elem())
+			}
+		}
+		field.Set(slice)
+		return
+	}
+	if len(elems) == 0 {
+		return
+	}
+	if rel.Type.Kind() == reflect.Ptr {
+		field.Set(elems[0])
+	} else {
+		field.Set(elems[0].Elem())
+	}
+}
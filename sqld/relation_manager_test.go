@@ -0,0 +1,118 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/jorm/sqlc"
+	"testing"
+)
+
+type relUser struct {
+	Id      int64       `json:"id" bson:"_id" tb:"rel_user"`
+	Name    string      `json:"name" bson:"name"`
+	GroupID int64       `json:"groupID" bson:"groupID"`
+	Roles   []*relRole  `json:"roles" bson:"-" rel:"hasMany" fk:"userID"`
+	Profile *relProfile `json:"profile" bson:"-" rel:"hasOne" fk:"userID"`
+	Group   relGroup    `json:"group" bson:"-" rel:"belongsTo" fk:"groupID"`
+	Tags    []relRole   `json:"tags" bson:"-" rel:"hasMany" fk:"userID"`
+}
+
+type relRole struct {
+	Id          int64      `json:"id" bson:"_id" tb:"rel_role"`
+	UserID      int64      `json:"userID" bson:"userID"`
+	Name        string     `json:"name" bson:"name"`
+	Permissions []*relPerm `json:"permissions" bson:"-" rel:"hasMany" fk:"roleID"`
+}
+
+type relPerm struct {
+	Id     int64  `json:"id" bson:"_id" tb:"rel_perm"`
+	RoleID int64  `json:"roleID" bson:"roleID"`
+	Code   string `json:"code" bson:"code"`
+}
+
+type relProfile struct {
+	Id     int64  `json:"id" bson:"_id" tb:"rel_profile"`
+	UserID int64  `json:"userID" bson:"userID"`
+	Email  string `json:"email" bson:"email"`
+}
+
+type relGroup struct {
+	Id   int64  `json:"id" bson:"_id" tb:"rel_group"`
+	Name string `json:"name" bson:"name"`
+}
+
+type relInvalid struct {
+	Id    int64    `json:"id" bson:"_id" tb:"rel_invalid"`
+	Roles *relRole `json:"roles" bson:"-" rel:"hasMany" fk:"userID"`
+}
+
+func TestRelationMeta(t *testing.T) {
+	meta, err := GetModelMeta(&relUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.Relations) != 4 || meta.FieldByColumn("roles") != nil {
+		t.Fatalf("unexpected relations: %+v", meta.Relations)
+	}
+	if rel := meta.RelationByName("roles"); rel == nil || rel.Kind != HAS_MANY || rel.Target.Name() != "relRole" || rel.RefKey != "id" {
+		t.Errorf("unexpected relation: %+v", rel)
+	}
+	invalid, err := GetModelMeta(&relInvalid{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := invalid.TableName(); err == nil {
+		t.Error("expected hasMany non-slice field rejected")
+	}
+}
+
+func TestSqlitePreload(t *testing.T) {
+	db := newSqliteManager(t)
+	defer db.Close()
+	if err := db.AutoMigrate(&relUser{}, &relRole{}, &relPerm{}, &relProfile{}, &relGroup{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Save(&relGroup{Id: 1, Name: "admin"}, &relGroup{Id: 2, Name: "guest"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Save(&relUser{Id: 1, Name: "a", GroupID: 1}, &relUser{Id: 2, Name: "b", GroupID: 2}, &relUser{Id: 3, Name: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Save(&relRole{Id: 1, UserID: 1, Name: "r1"}, &relRole{Id: 2, UserID: 1, Name: "r2"}, &relRole{Id: 3, UserID: 2, Name: "r3"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Save(&relPerm{Id: 1, RoleID: 1, Code: "p1"}, &relPerm{Id: 2, RoleID: 1, Code: "p2"}, &relPerm{Id: 3, RoleID: 3, Code: "p3"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Save(&relProfile{Id: 1, UserID: 2, Email: "b@x"}); err != nil {
+		t.Fatal(err)
+	}
+	users := make([]*relUser, 0)
+	if err := db.FindList(sqlc.M(&relUser{}).Orderby("id", sqlc.ASC_).Preload("Roles.Permissions", "profile", "Group", "Tags"), &users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 {
+		t.Fatalf("unexpected users: %d", len(users))
+	}
+	a, b, c := users[0], users[1], users[2]
+	if len(a.Roles) != 2 || a.Roles[0].Name != "r1" || len(a.Roles[0].Permissions) != 2 || len(a.Roles[1].Permissions) != 0 || len(a.Tags) != 2 {
+		t.Errorf("unexpected hasMany: %+v", a.Roles)
+	}
+	if len(b.Roles) != 1 || len(b.Roles[0].Permissions) != 1 || b.Roles[0].Permissions[0].Code != "p3" {
+		t.Errorf("unexpected nested hasMany: %+v", b.Roles)
+	}
+	if a.Profile != nil || b.Profile == nil || b.Profile.Email != "b@x" {
+		t.Errorf("unexpected hasOne: %+v %+v", a.Profile, b.Profile)
+	}
+	if a.Group.Name != "admin" || b.Group.Name != "guest" || c.Group.Id != 0 || len(c.Roles) != 0 {
+		t.Errorf("unexpected belongsTo: %+v %+v %+v", a.Group, b.Group, c.Group)
+	}
+	one := relUser{}
+	if err := db.FindOne(sqlc.M(&relUser{}).Eq("id", 2).Preload("roles"), &one); err != nil {
+		t.Fatal(err)
+	}
+	if len(one.Roles) != 1 || one.Roles[0].Name != "r3" || one.Roles[0].Permissions != nil || one.Profile != nil {
+		t.Errorf("unexpected FindOne preload: %+v", one)
+	}
+	if err := db.FindOne(sqlc.M(&relUser{}).Eq("id", 2).Preload("unknown"), &one); err == nil {
+		t.Error("expected unknown relation rejected")
+	}
+}
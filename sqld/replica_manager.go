@@ -0,0 +1,217 @@
+package sqld
+
+import (
+	"context"
+	"database/sql"
+	"github.com/godaddy-x/jorm/log"
+	"github.com/godaddy-x/jorm/util"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/********************************** 读写分离实现 **********************************/
+
+const (
+	RANDOM     = "random"     // 随机
+	ROUNDROBIN = "roundRobin" // 轮询
+	WEIGHTED   = "weighted"   // 权重
+)
+
+// 从库配置,账号密码为空时使用主库配置
+type ReplicaConfig struct {
+	Host     string // 地址IP
+	Port     int    // 数据库端口
+	Username string // 账号
+	Password string // 密码
+	Weight   int    // 权重,weighted策略有效,<=0时为1
+}
+
+// 从库连接
+type replica struct {
+	db      *sql.DB
+	addr    string
+	weight  int
+	healthy int32 // 1.正常 0.已剔除
+}
+
+func (self *replica) isHealthy() bool {
+	return atomic.LoadInt32(&self.healthy) == 1
+}
+
+// 检测从库连接,失败时剔除,恢复时重新加入轮换
+func (self *replica) ping(timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := self.db.PingContext(ctx); err != nil {
+		if atomic.CompareAndSwapInt32(&self.healthy, 1, 0) {
+			log.Println(util.AddStr("从库[", self.addr, "]不可用,已剔除: ", err.Error()))
+		}
+		return false
+	}
+	if atomic.CompareAndSwapInt32(&self.healthy, 0, 1) {
+		log.Println(util.AddStr("从库[", self.addr, "]已恢复"))
+	}
+	return true
+}
+
+// 查询连接异常时剔除,由健康检查恢复
+func (self *replica) fail(err error) {
+	if atomic.CompareAndSwapInt32(&self.healthy, 1, 0) {
+		log.Println(util.AddStr("从库[", self.addr, "]查询失败,已剔除: ", err.Error()))
+	}
+}
+
+// 从库连接池
+type replicaPool struct {
+	balance  string
+	replicas []*replica
+	counter  uint64
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// 创建从库连接池,并按间隔(秒)启动健康检查
+func newReplicaPool(balance string, period int, replicas []*replica) *replicaPool {
+	if len(replicas) == 0 {
+		return nil
+	}
+	for _, r := range replicas {
+		if r.weight <= 0 {
+			r.weight = 1
+		}
+		r.healthy = 1
+	}
+	pool := &replicaPool{balance: balance, replicas: replicas, stop: make(chan struct{})}
+	if period <= 0 {
+		period = 10
+	}
+	go pool.check(time.Second * time.Duration(period))
+	return pool
+}
+
+// 定时检测全部从库
+func (self *replicaPool) check(period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-self.stop:
+			return
+		case <-ticker.C:
+			for _, r := range self.replicas {
+				r.ping(period)
+			}
+		}
+	}
+}
+
+// 停止健康检查,数据源重新初始化时调用
+func (self *replicaPool) Close() {
+	self.once.Do(func() {
+		if self.stop != nil {
+			close(self.stop)
+		}
+	})
+}
+
+// 按负载策略选择可用从库,无可用从库时返回nil
+func (self *replicaPool) next() *replica {
+	healthy := make([]*replica, 0, len(self.replicas))
+	total := 0
+	for _, r := range self.replicas {
+		if r.isHealthy() {
+			healthy = append(healthy, r)
+			total += r.weight
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+	switch self.balance {
+	case ROUNDROBIN:
+		return healthy[(atomic.AddUint64(&self.counter, 1)-1)%uint64(len(healthy))]
+	case WEIGHTED:
+		n := rand.Intn(total)
+		for _, r := range healthy {
+			if n < r.weight {
+				return r
+			}
+			n -= r.weight
+		}
+	}
+	return healthy[rand.Intn(len(healthy))]
+}
+
+// 获取查询从库,事务中或强制主库时返回nil
+func (self *RDBManager) getReplica() *replica {
+	if self.replicas == nil || self.AutoTx || self.ForceMaster {
+		return nil
+	}
+	return self.replicas.next()
+}
+
+// 从库操作失败时检测连接,不可用则剔除并返回true,由调用方回退至主库
+func (self *RDBManager) replicaFailed(r *replica, err error) bool {
+	if self.contextError(err) != nil {
+		return false
+	}
+	return !r.ping(time.Second * 3)
+}
+
+// 预编译查询语句,优先使用从库,返回使用的从库,使用主库时为nil
+func (self *RDBManager) prepareRead(query string) (*sql.Stmt, func(err error), *replica, error) {
+	if r := self.getReplica(); r != nil {
+		stmt, release, err := self.prepareStmt(r.db, query)
+		if err == nil {
+			return stmt, release, r, nil
+		} else if !self.replicaFailed(r, err) {
+			return nil, nil, nil, err
+		}
+	}
+	stmt, release, err := self.prepareStmt(self.Db, query)
+	return stmt, release, nil, err
+}
+
+// 预编译并执行查询,read为true时优先使用从库,预编译语句命中缓存时从库异常在执行时返回,
+// 查询连接异常时剔除从库并回退至主库重试一次
+func (self *RDBManager) openRows(query string, read bool, args []interface{}) (*sql.Rows, func(err error), error) {
+	var stmt *sql.Stmt
+	var release func(err error)
+	var r *replica
+	var err error
+	if read && !self.AutoTx {
+		stmt, release, r, err = self.prepareRead(self.rebind(query))
+	} else {
+		stmt, release, err = self.prepare(query, read)
+	}
+	if err != nil {
+		return nil, nil, self.ctxError(err, "预编译sql[", query, "]失败: ")
+	}
+	rows, err := stmt.QueryContext(self.getContext(), args...)
+	if err != nil && r != nil && isConnError(err) && self.contextError(err) == nil {
+		release(err)
+		r.fail(err)
+		if stmt, release, err = self.prepareStmt(self.Db, self.rebind(query)); err != nil {
+			return nil, nil, self.ctxError(err, "预编译sql[", query, "]失败: ")
+		}
+		rows, err = stmt.QueryContext(self.getContext(), args...)
+	}
+	if err != nil {
+		release(err)
+		return nil, nil, self.ctxError(err, "查询失败: ")
+	}
+	return rows, release, nil
+}
+
+// 执行查询语句,优先使用从库
+func (self *RDBManager) queryRead(query string, args ...interface{}) (*sql.Rows, error) {
+	if r := self.getReplica(); r != nil {
+		rows, err := r.db.QueryContext(self.getContext(), query, args...)
+		if err == nil || !self.replicaFailed(r, err) {
+			return rows, err
+		}
+	}
+	return self.Db.QueryContext(self.getContext(), query, args...)
+}
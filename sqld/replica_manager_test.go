@@ -0,0 +1,94 @@
+package sqld
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"github.com/godaddy-x/jorm/sqlc"
+	"testing"
+)
+
+func TestReplicaPoolBalance(t *testing.T) {
+	r1 := &replica{addr: "r1", weight: 1, healthy: 1}
+	r2 := &replica{addr: "r2", weight: 3, healthy: 1}
+	pool := &replicaPool{balance: ROUNDROBIN, replicas: []*replica{r1, r2}}
+	for i := 0; i < 4; i++ {
+		if r := pool.next(); r != pool.replicas[i%2] {
+			t.Errorf("round robin %d expected %s, got %s", i, pool.replicas[i%2].addr, r.addr)
+		}
+	}
+	pool.balance = WEIGHTED
+	hits := map[*replica]int{}
+	for i := 0; i < 4000; i++ {
+		hits[pool.next()]++
+	}
+	if hits[r2] < hits[r1]*2 {
+		t.Errorf("weighted choice mismatch: r1=%d r2=%d", hits[r1], hits[r2])
+	}
+	r2.healthy = 0
+	pool.balance = RANDOM
+	for i := 0; i < 10; i++ {
+		if r := pool.next(); r != r1 {
+			t.Errorf("ejected replica selected: %s", r.addr)
+		}
+	}
+	r1.healthy = 0
+	if r := pool.next(); r != nil {
+		t.Errorf("expected master fallback, got %s", r.addr)
+	}
+	db := &RDBManager{replicas: &replicaPool{replicas: []*replica{{addr: "r3", weight: 1, healthy: 1}}}}
+	if db.getReplica() == nil {
+		t.Error("expected replica for read")
+	}
+	db.ForceMaster = true
+	if db.getReplica() != nil {
+		t.Error("ForceMaster should read from master")
+	}
+	db.ForceMaster, db.AutoTx = false, true
+	if db.getReplica() != nil {
+		t.Error("AutoTx should read from master")
+	}
+}
+
+// 预编译成功但查询返回连接异常的测试驱动
+type deadDriver struct{}
+type deadConn struct{}
+type deadStmt struct{}
+
+func (deadDriver) Open(name string) (driver.Conn, error)         { return deadConn{}, nil }
+func (deadConn) Prepare(query string) (driver.Stmt, error)       { return deadStmt{}, nil }
+func (deadConn) Close() error                                    { return nil }
+func (deadConn) Begin() (driver.Tx, error)                       { return nil, driver.ErrSkip }
+func (deadStmt) Close() error                                    { return nil }
+func (deadStmt) NumInput() int                                   { return -1 }
+func (deadStmt) Exec(args []driver.Value) (driver.Result, error) { return nil, driver.ErrBadConn }
+func (deadStmt) Query(args []driver.Value) (driver.Rows, error)  { return nil, driver.ErrBadConn }
+
+func TestReplicaQueryFallback(t *testing.T) {
+	sql.Register("jorm_dead", deadDriver{})
+	dead, err := sql.Open("jorm_dead", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dead.Close()
+	db := newSqliteManager(t)
+	defer db.Close()
+	if err := db.AutoMigrate(&cacheWallet{}); err != nil {
+		t.Fatal(err)
+	}
+	r := &replica{db: dead, addr: "dead", weight: 1, healthy: 1}
+	db.replicas = &replicaPool{replicas: []*replica{r}}
+	if _, err := db.Count(sqlc.M(&cacheWallet{})); err != nil {
+		t.Fatal("expected master fallback: ", err)
+	}
+	if r.isHealthy() {
+		t.Error("expected failed replica ejected")
+	}
+	pool := newReplicaPool(RANDOM, 1, []*replica{{db: dead, addr: "dead"}})
+	pool.Close()
+	pool.Close()
+	select {
+	case <-pool.stop:
+	default:
+		t.Error("expected health check stopped")
+	}
+}
@@ -0,0 +1,678 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/jorm/dialect"
+	"github.com/godaddy-x/jorm/sqlc"
+	"github.com/godaddy-x/jorm/util"
+	"hash/crc32"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/********************************** 分库分表实现 **********************************/
+
+// 分片策略,通过分片键字段shard标签声明,如 shard:"mod"
+const (
+	SHARD_MOD   = "mod"   // 取模
+	SHARD_RANGE = "range" // 范围
+	SHARD_HASH  = "hash"  // 哈希取模
+	SHARD_TIME  = "time"  // 时间表后缀
+)
+
+// 分片规则
+type ShardRule struct {
+	DsNames []string // 分片数据源列表,为空时使用当前数据源
+	Tables  int      // 每个数据源分表数量(mod/hash),>1时表名追加_下标后缀
+	Ranges  []int64  // 分片键上界(不含),按顺序对应DsNames(range)
+	Format  string   // 表后缀时间格式(time),默认200601
+	Since   int64    // 首张分表时间(毫秒),无分片键查询时扫描Since至今的分表(time)
+}
+
+// 分片路由结果
+type shardRoute struct {
+	DsName string
+	Table  string
+}
+
+// 模型分片路由
+type shardRouter struct {
+	rule  ShardRule
+	meta  *ModelMeta
+	field *FieldMeta
+}
+
+var shardRules sync.Map
+
+// 注册模型分片规则,模型需通过shard标签声明分片键和策略,注册后Save/Update/FindById/FindList等操作自动路由
+// 查询条件未包含分片键等值(Eq/In)条件时扫描全部分片,合并结果后排序分页
+// 分片位于当前数据源时加入当前事务,事务中不支持写入其他数据源分片,事务外其他数据源分片按语句自动提交
+func RegShardRule(model interface{}, rule ShardRule) error {
+	meta, err := GetModelMeta(model)
+	if err != nil {
+		return err
+	}
+	if _, err := meta.TableName(); err != nil {
+		return err
+	}
+	if meta.Shard == nil {
+		return util.Error("实体[", meta.Type.Name(), "]未设置分片键(shard标签)")
+	}
+	switch meta.Shard.Shard {
+	case SHARD_MOD, SHARD_HASH:
+		if len(rule.DsNames) == 0 && rule.Tables <= 1 {
+			return util.Error("分片数据源和分表数量不能同时为空")
+		}
+	case SHARD_RANGE:
+		if len(rule.Ranges) == 0 || len(rule.Ranges) != len(rule.DsNames) {
+			return util.Error("范围分片上界数量必须与数据源数量一致")
+		}
+	case SHARD_TIME:
+		if len(rule.Format) == 0 {
+			rule.Format = "200601"
+		}
+	default:
+		return util.Error("无效的分片策略: ", meta.Shard.Shard)
+	}
+	shardRules.Store(meta.Type, &shardRouter{rule: rule, meta: meta, field: meta.Shard})
+	return nil
+}
+
+// 获取模型分片路由,未注册分片规则或已在分片内执行时返回nil
+func (self *RDBManager) getShardRouter(model interface{}) *shardRouter {
+	if len(self.shardTable) > 0 || model == nil {
+		return nil
+	}
+	meta, err := GetModelMeta(model)
+	if err != nil || meta.Shard == nil {
+		return nil
+	}
+	if v, ok := shardRules.Load(meta.Type); ok {
+		return v.(*shardRouter)
+	}
+	return nil
+}
+
+// 获取数据表名称,分片执行时返回分片表名称
+func (self *RDBManager) tableName(model interface{}) (string, error) {
+	if len(self.shardTable) > 0 {
+		return self.shardTable, nil
+	}
+	return getTableName(model)
+}
+
+// 在分片中执行函数,分片位于当前数据源时复用当前管理器及事务,仅切换分片表
+// 事务中写入其他数据源分片时返回异常,避免分片写入脱离当前事务提交或回滚
+func (self *RDBManager) withShard(route shardRoute, write bool, fn func(db *RDBManager) error) error {
+	if len(route.DsName) == 0 || route.DsName == self.dsName() {
+		table := self.shardTable
+		self.shardTable = route.Table
+		defer func() { self.shardTable = table }()
+		return fn(self)
+	}
+	if write && self.Tx != nil {
+		return self.Error(util.AddStr("事务中不支持写入其他数据源[", route.DsName, "]分片"))
+	}
+	db, err := self.shard(route.DsName)
+	if err != nil {
+		return err
+	}
+	db.shardTable = route.Table
+	return fn(db)
+}
+
+// 获取其他数据源分片管理器,同一数据源复用连接,不开启事务
+func (self *RDBManager) shard(ds string) (*RDBManager, error) {
+	db := self.shards[ds]
+	if db == nil {
+		option := self.Option
+		option.DsName = ds
+		option.AutoTx = false
+		db = &RDBManager{}
+		if err := db.GetDB(option); err != nil {
+			return nil, self.Error(err)
+		}
+		if self.shards == nil {
+			self.shards = make(map[string]*RDBManager)
+		}
+		self.shards[ds] = db
+	}
+	return db, nil
+}
+
+// 关闭分片数据源管理器,主管理器存在异常时不同步分片缓存数据
+func (self *RDBManager) closeShards() {
+	for _, db := range self.shards {
+		if len(self.Errors) > 0 {
+			db.Errors = append(db.Errors, self.Errors...)
+		}
+		if err := db.Close(); err != nil {
+			self.Error(err)
+		}
+	}
+	self.shards = nil
+}
+
+// 按分片键值计算路由
+func (self *shardRouter) route(value interface{}) (shardRoute, error) {
+	tb := self.meta.Table
+	switch self.field.Shard {
+	case SHARD_MOD:
+		n, err := shardInt(value)
+		if err != nil {
+			return shardRoute{}, err
+		}
+		if n < 0 {
+			n = -n
+		}
+		return self.modRoute(uint64(n)), nil
+	case SHARD_HASH:
+		return self.modRoute(uint64(crc32.ChecksumIEEE([]byte(util.AnyToStr(value))))), nil
+	case SHARD_RANGE:
+		n, err := shardInt(value)
+		if err != nil {
+			return shardRoute{}, err
+		}
+		for e := range self.rule.Ranges {
+			if n < self.rule.Ranges[e] {
+				return shardRoute{DsName: self.rule.DsNames[e], Table: tb}, nil
+			}
+		}
+		return shardRoute{}, util.Error("分片键值[", util.AnyToStr(value), "]超出分片范围")
+	case SHARD_TIME:
+		t, err := shardTime(value)
+		if err != nil {
+			return shardRoute{}, err
+		}
+		return shardRoute{DsName: self.timeDsName(), Table: util.AddStr(tb, "_", t.Format(self.rule.Format))}, nil
+	}
+	return shardRoute{}, util.Error("无效的分片策略: ", self.field.Shard)
+}
+
+// 取模路由,先定位数据源,再定位数据源内分表
+func (self *shardRouter) modRoute(n uint64) shardRoute {
+	tables := uint64(1)
+	if self.rule.Tables > 1 {
+		tables = uint64(self.rule.Tables)
+	}
+	total := tables
+	if len(self.rule.DsNames) > 0 {
+		total = tables * uint64(len(self.rule.DsNames))
+	}
+	index := n % total
+	route := shardRoute{Table: self.meta.Table}
+	if len(self.rule.DsNames) > 0 {
+		route.DsName = self.rule.DsNames[index/tables]
+	}
+	if self.rule.Tables > 1 {
+		route.Table = util.AddStr(self.meta.Table, "_", index%tables)
+	}
+	return route
+}
+
+func (self *shardRouter) timeDsName() string {
+	if len(self.rule.DsNames) > 0 {
+		return self.rule.DsNames[0]
+	}
+	return ""
+}
+
+// 获取全部分片路由
+func (self *shardRouter) all() ([]shardRoute, error) {
+	routes := make([]shardRoute, 0)
+	switch self.field.Shard {
+	case SHARD_MOD, SHARD_HASH:
+		total := 1
+		if self.rule.Tables > 1 {
+			total = self.rule.Tables
+		}
+		if len(self.rule.DsNames) > 0 {
+			total = total * len(self.rule.DsNames)
+		}
+		for i := 0; i < total; i++ {
+			routes = append(routes, self.modRoute(uint64(i)))
+		}
+	case SHARD_RANGE:
+		for e := range self.rule.DsNames {
+			routes = append(routes, shardRoute{DsName: self.rule.DsNames[e], Table: self.meta.Table})
+		}
+	case SHARD_TIME:
+		if self.rule.Since <= 0 {
+			return nil, util.Error("按时间分片查询需指定分片键或设置分片规则Since")
+		}
+		format := self.rule.Format
+		since := util.Int2Time(self.rule.Since)
+		now := util.Int2Time(util.Time())
+		var step func(t time.Time) time.Time
+		if strings.Contains(format, "02") {
+			since = time.Date(since.Year(), since.Month(), since.Day(), 0, 0, 0, 0, since.Location())
+			step = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+		} else if strings.Contains(format, "01") {
+			since = time.Date(since.Year(), since.Month(), 1, 0, 0, 0, 0, since.Location())
+			step = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+		} else {
+			since = time.Date(since.Year(), 1, 1, 0, 0, 0, 0, since.Location())
+			step = func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }
+		}
+		last := ""
+		for t := since; !t.After(now); t = step(t) {
+			if suffix := t.Format(format); suffix != last {
+				routes = append(routes, shardRoute{DsName: self.timeDsName(), Table: util.AddStr(self.meta.Table, "_", suffix)})
+				last = suffix
+			}
+		}
+	}
+	return routes, nil
+}
+
+// 获取对象分片路由
+func (self *shardRouter) routeData(data interface{}) (shardRoute, error) {
+	vof := reflect.ValueOf(data)
+	if vof.Kind() != reflect.Ptr {
+		return shardRoute{}, util.Error("参数值必须为指针类型")
+	}
+	value := vof.Elem().FieldByIndex(self.field.Index)
+	if self.field.IsId && value.Int() <= 0 {
+		return shardRoute{}, util.Error("分片键[", self.field.Column, "]值不能为空")
+	}
+	return self.route(value.Interface())
+}
+
+// 按条件获取分片路由,存在分片键Eq/In条件时定位分片,否则返回全部分片
+func (self *shardRouter) routeCnd(cnd *sqlc.Cnd) ([]shardRoute, error) {
+	for _, condit := range cnd.Conditions {
+		key := condit.Key
+		if i := strings.LastIndex(key, "."); i >= 0 {
+			key = key[i+1:]
+		}
+		if key != self.field.Column {
+			continue
+		}
+		var values []interface{}
+		if condit.Logic == sqlc.EQ_ {
+			values = []interface{}{condit.Value}
+		} else if condit.Logic == sqlc.IN_ {
+			values = condit.Values
+		} else {
+			continue
+		}
+		routes := make([]shardRoute, 0, len(values))
+		exists := make(map[shardRoute]bool, len(values))
+		for e := range values {
+			route, err := self.route(values[e])
+			if err != nil {
+				return nil, err
+			}
+			if !exists[route] {
+				routes = append(routes, route)
+				exists[route] = true
+			}
+		}
+		return routes, nil
+	}
+	return self.all()
+}
+
+// 按对象分片分组执行
+func (self *RDBManager) shardExec(router *shardRouter, datas []interface{}, write bool, fn func(db *RDBManager, datas []interface{}) error) error {
+	routes := make([]shardRoute, 0)
+	groups := make(map[shardRoute][]interface{})
+	for e := range datas {
+		if datas[e] == nil {
+			return self.Error("参数元素不能为空")
+		}
+		route, err := router.routeData(datas[e])
+		if err != nil {
+			return self.Error(err)
+		}
+		if _, b := groups[route]; !b {
+			routes = append(routes, route)
+		}
+		groups[route] = append(groups[route], datas[e])
+	}
+	for _, route := range routes {
+		err := self.withShard(route, write, func(db *RDBManager) error {
+			return fn(db, groups[route])
+		})
+		if err != nil {
+			return self.Error(err)
+		}
+	}
+	return nil
+}
+
+// 按条件分片执行
+func (self *RDBManager) shardExecCnd(router *shardRouter, cnd *sqlc.Cnd, write bool, fn func(db *RDBManager) error) error {
+	routes, err := router.routeCnd(cnd)
+	if err != nil {
+		return self.Error(err)
+	}
+	for _, route := range routes {
+		if err := self.withShard(route, write, fn); err != nil {
+			return self.Error(err)
+		}
+	}
+	return nil
+}
+
+// 分片保存数据,按ID分片且自主ID模式时预先生成ID用于路由
+func (self *RDBManager) shardSave(router *shardRouter, datas []interface{}) error {
+	if router.field.IsId && self.AutoID {
+		for e := range datas {
+			if datas[e] == nil || reflect.ValueOf(datas[e]).Kind() != reflect.Ptr {
+				continue
+			}
+			value := reflect.ValueOf(datas[e]).Elem().FieldByIndex(router.field.Index)
+			if value.Int() > 0 {
+				continue
+			}
+			if valueID, err := util.StrToInt64(util.GetUUID(int64(self.Node))); err != nil {
+				return self.Error(err)
+			} else {
+				value.SetInt(valueID)
+			}
+		}
+	}
+	return self.shardExec(router, datas, true, func(db *RDBManager, datas []interface{}) error {
+		return db.Save(datas...)
+	})
+}
+
+// 分片按条件新增或更新数据,条件需包含分片键等值条件
+func (self *RDBManager) shardUpsertByCnd(router *shardRouter, cnd *sqlc.Cnd) error {
+	routes, err := router.routeCnd(cnd)
+	if err != nil {
+		return self.Error(err)
+	}
+	if len(routes) != 1 {
+		return self.Error(util.AddStr("按条件新增或更新分片数据需指定分片键[", router.field.Column, "]等值条件"))
+	}
+	err = self.withShard(routes[0], true, func(db *RDBManager) error {
+		return db.UpsertByCnd(cnd)
+	})
+	if err != nil {
+		return self.Error(err)
+	}
+	return nil
+}
+
+// 分片按ID查询,分片键非ID字段且为零值时扫描全部分片
+func (self *RDBManager) shardFindById(router *shardRouter, data interface{}) error {
+	vof := reflect.ValueOf(data).Elem()
+	if router.field.IsId || !vof.FieldByIndex(router.field.Index).IsZero() {
+		return self.shardExec(router, []interface{}{data}, false, func(db *RDBManager, datas []interface{}) error {
+			return db.FindById(data)
+		})
+	}
+	vid := router.meta.getId(vof)
+	if vid <= 0 {
+		return self.Error("对象ID值不能为空")
+	}
+	return self.shardFindOne(router, sqlc.M(data).Eq(sqlc.BsonId, vid), data)
+}
+
+// 分片统计数据,合并各分片数量
+func (self *RDBManager) shardCount(router *shardRouter, cnd *sqlc.Cnd) (int64, error) {
+	var pageTotal int64
+	err := self.shardExecCnd(router, cnd, false, func(db *RDBManager) error {
+		sub := *cnd
+		n, err := db.Count(&sub)
+		pageTotal += n
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if pageTotal > 0 && cnd.Pagination.PageSize > 0 {
+		if pageTotal%cnd.Pagination.PageSize == 0 {
+			cnd.Pagination.PageCount = pageTotal / cnd.Pagination.PageSize
+		} else {
+			cnd.Pagination.PageCount = pageTotal/cnd.Pagination.PageSize + 1
+		}
+	} else {
+		cnd.Pagination.PageCount = 0
+	}
+	cnd.Pagination.PageTotal = pageTotal
+	return pageTotal, nil
+}
+
+// 分片查询单条数据,多个分片时按排序条件取首条
+func (self *RDBManager) shardFindOne(router *shardRouter, cnd *sqlc.Cnd, data interface{}) error {
+	routes, err := router.routeCnd(cnd)
+	if err != nil {
+		return self.Error(err)
+	}
+	if len(routes) == 1 {
+		err := self.withShard(routes[0], false, func(db *RDBManager) error {
+			return db.FindOne(cnd, data)
+		})
+		if err != nil {
+			return self.Error(err)
+		}
+		return nil
+	}
+	sub := *cnd
+	sub.Pagination = dialect.Dialect{PageNo: 0, PageSize: 1, Spilled: true, IsOffset: true}
+	result := reflect.New(reflect.SliceOf(reflect.TypeOf(data)))
+	if err := self.shardFindList(router, &sub, result.Interface()); err != nil {
+		return err
+	}
+	if result.Elem().Len() > 0 {
+		reflect.ValueOf(data).Elem().Set(result.Elem().Index(0).Elem())
+	}
+	return nil
+}
+
+// 分片查询数据,多个分片时各分片查询前N条,合并后按排序条件排序并截取分页
+func (self *RDBManager) shardFindList(router *shardRouter, cnd *sqlc.Cnd, data interface{}) error {
+	routes, err := router.routeCnd(cnd)
+	if err != nil {
+		return self.Error(err)
+	}
+	if len(routes) == 1 {
+		err := self.withShard(routes[0], false, func(db *RDBManager) error {
+			return db.FindList(cnd, data)
+		})
+		if err != nil {
+			return self.Error(err)
+		}
+		return nil
+	}
+	if cnd.Keyset.Open {
+		return self.Error("分片模型游标分页条件必须包含分片键")
+	}
+	resultv := reflect.ValueOf(data)
+	if resultv.Kind() != reflect.Ptr || resultv.Elem().Kind() != reflect.Slice {
+		return self.Error("返回值必须为切片指针类型")
+	}
+	pagination := cnd.Pagination
+	var offset, limit int64
+	if pagination.PageNo != 0 || pagination.PageSize != 0 {
+		if pagination.PageSize <= 0 {
+			pagination.PageSize = 10
+		}
+		// 页码小于1时按首页查询,与分页方言一致
+		if pagination.PageNo <= 0 && !pagination.IsOffset {
+			pagination.PageNo = 1
+		}
+		limit = pagination.PageSize
+		if pagination.IsOffset {
+			offset = pagination.PageNo
+		} else {
+			offset = (pagination.PageNo - 1) * pagination.PageSize
+		}
+		if offset < 0 {
+			offset = 0
+		}
+	}
+	var pageTotal int64
+	merged := reflect.MakeSlice(resultv.Elem().Type(), 0, 0)
+	for _, route := range routes {
+		err := self.withShard(route, false, func(db *RDBManager) error {
+			sub := *cnd
+			if limit > 0 {
+				sub.Pagination = dialect.Dialect{PageNo: 0, PageSize: offset + limit, Spilled: true, IsOffset: true}
+			}
+			part := reflect.New(resultv.Elem().Type())
+			if err := db.FindList(&sub, part.Interface()); err != nil {
+				return err
+			}
+			merged = reflect.AppendSlice(merged, part.Elem())
+			if limit > 0 && !pagination.IsOffset {
+				count := *cnd
+				count.Pagination = dialect.Dialect{}
+				n, err := db.Count(&count)
+				if err != nil {
+					return err
+				}
+				pageTotal += n
+			}
+			return nil
+		})
+		if err != nil {
+			return self.Error(err)
+		}
+	}
+	if err := sortShardResult(router.meta, cnd.Orderbys, merged); err != nil {
+		return self.Error(err)
+	}
+	if limit > 0 {
+		end := offset + limit
+		if offset > int64(merged.Len()) {
+			offset = int64(merged.Len())
+		}
+		if end > int64(merged.Len()) {
+			end = int64(merged.Len())
+		}
+		merged = merged.Slice(int(offset), int(end))
+		if !pagination.IsOffset {
+			cnd.Pagination.PageTotal = pageTotal
+			if pageTotal%pagination.PageSize == 0 {
+				cnd.Pagination.PageCount = pageTotal / pagination.PageSize
+			} else {
+				cnd.Pagination.PageCount = pageTotal/pagination.PageSize + 1
+			}
+		}
+	}
+	resultv.Elem().Set(merged)
+	return nil
+}
+
+// 按排序条件对合并结果排序
+func sortShardResult(meta *ModelMeta, orderbys []sqlc.Condition, result reflect.Value) error {
+	if len(orderbys) == 0 || result.Len() < 2 {
+		return nil
+	}
+	fields := make([]*FieldMeta, len(orderbys))
+	for e := range orderbys {
+		key := orderbys[e].Key
+		if i := strings.LastIndex(key, "."); i >= 0 {
+			key = key[i+1:]
+		}
+		if fields[e] = meta.FieldByColumn(key); fields[e] == nil {
+			return util.Error("排序字段[", orderbys[e].Key, "]无效bson标签")
+		}
+	}
+	elem := func(i int) reflect.Value {
+		v := result.Index(i)
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		return v
+	}
+	sort.SliceStable(result.Interface(), func(i, j int) bool {
+		a, b := elem(i), elem(j)
+		for e := range fields {
+			c := compareShardValue(a.FieldByIndex(fields[e].Index), b.FieldByIndex(fields[e].Index))
+			if c == 0 {
+				continue
+			}
+			if orderbys[e].Value == sqlc.DESC_ {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	return nil
+}
+
+// 比较字段值大小,空指针最小
+func compareShardValue(a, b reflect.Value) int {
+	if a.Kind() == reflect.Ptr {
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() && b.IsNil() {
+				return 0
+			} else if a.IsNil() {
+				return -1
+			}
+			return 1
+		}
+		a, b = a.Elem(), b.Elem()
+	}
+	switch {
+	case isIntKind(a.Kind()):
+		return compareOrdered(a.Int() < b.Int(), a.Int() > b.Int())
+	case isUintKind(a.Kind()):
+		return compareOrdered(a.Uint() < b.Uint(), a.Uint() > b.Uint())
+	case a.Kind() == reflect.Float32 || a.Kind() == reflect.Float64:
+		return compareOrdered(a.Float() < b.Float(), a.Float() > b.Float())
+	case a.Kind() == reflect.String:
+		return strings.Compare(a.String(), b.String())
+	case a.Kind() == reflect.Bool:
+		return compareOrdered(!a.Bool() && b.Bool(), a.Bool() && !b.Bool())
+	case a.Type() == timeType:
+		ta, tb := a.Interface().(time.Time), b.Interface().(time.Time)
+		return compareOrdered(ta.Before(tb), ta.After(tb))
+	}
+	return 0
+}
+
+func compareOrdered(less, greater bool) int {
+	if less {
+		return -1
+	} else if greater {
+		return 1
+	}
+	return 0
+}
+
+// 分片键转换整数
+func shardInt(value interface{}) (int64, error) {
+	v := reflect.ValueOf(value)
+	switch {
+	case isIntKind(v.Kind()):
+		return v.Int(), nil
+	case isUintKind(v.Kind()):
+		return int64(v.Uint()), nil
+	case v.Kind() == reflect.String:
+		if n, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+			return n, nil
+		}
+	}
+	return 0, util.Error("分片键值[", util.AnyToStr(value), "]必须为整数")
+}
+
+// 分片键转换时间,支持毫秒时间戳,time.Time及时间字符串
+func shardTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return util.Int2Time(util.Time(v)), nil
+	case *time.Time:
+		if v != nil {
+			return util.Int2Time(util.Time(*v)), nil
+		}
+	case string:
+		if t, err := util.Str2Date(v); err == nil {
+			return util.Int2Time(util.Time(t)), nil
+		}
+	default:
+		if n, err := shardInt(value); err == nil && n > 0 {
+			return util.Int2Time(n), nil
+		}
+	}
+	return time.Time{}, util.Error("分片键值[", util.AnyToStr(value), "]无效时间")
+}
@@ -0,0 +1,182 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/jorm/dialect"
+	"github.com/godaddy-x/jorm/sqlc"
+	"github.com/godaddy-x/jorm/util"
+	"reflect"
+	"testing"
+)
+
+type shardOrder struct {
+	Id     int64  `json:"id" bson:"_id" tb:"shard_order"`
+	UserId int64  `json:"userId" bson:"userId" shard:"mod"`
+	No     string `json:"no" bson:"no"`
+	Ctime  int64  `json:"ctime" bson:"ctime"`
+}
+
+type shardLog struct {
+	Id    int64  `json:"id" bson:"_id" tb:"shard_log"`
+	Ctime int64  `json:"ctime" bson:"ctime" shard:"time"`
+	Msg   string `json:"msg" bson:"msg"`
+}
+
+func TestShardRoute(t *testing.T) {
+	if err := RegShardRule(&shardOrder{}, ShardRule{DsNames: []string{"DS0", "DS1"}, Tables: 2}); err != nil {
+		t.Fatal(err)
+	}
+	router := new(RDBManager).getShardRouter(&shardOrder{})
+	if router == nil {
+		t.Fatal("expected shard router")
+	}
+	route, err := router.routeData(&shardOrder{UserId: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if route != (shardRoute{DsName: "DS1", Table: "shard_order_1"}) {
+		t.Errorf("unexpected mod route: %+v", route)
+	}
+	routes, err := router.routeCnd(sqlc.M(&shardOrder{}).In("userId", 1, 3, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []shardRoute{{"DS0", "shard_order_1"}, {"DS1", "shard_order_1"}, {"DS0", "shard_order_0"}}
+	if !reflect.DeepEqual(routes, expected) {
+		t.Errorf("unexpected in routes: %+v", routes)
+	}
+	if routes, err := router.routeCnd(sqlc.M(&shardOrder{}).Eq("no", "x")); err != nil || len(routes) != 4 {
+		t.Errorf("expected scatter to 4 shards, got: %+v %v", routes, err)
+	}
+	if err := RegShardRule(&shardLog{}, ShardRule{Format: "200601"}); err != nil {
+		t.Fatal(err)
+	}
+	logRouter := new(RDBManager).getShardRouter(&shardLog{})
+	if route, err := logRouter.route("2019-10-16 10:20:30"); err != nil || route.Table != "shard_log_201910" {
+		t.Errorf("unexpected time route: %+v %v", route, err)
+	}
+	if _, err := logRouter.all(); err == nil {
+		t.Error("expected error when scattering time shards without Since")
+	}
+	if db := (&RDBManager{shardTable: "shard_order_1"}); db.getShardRouter(&shardOrder{}) != nil {
+		t.Error("routing should be skipped inside a shard")
+	}
+}
+
+func TestShardSortResult(t *testing.T) {
+	meta, _ := GetModelMeta(&shardOrder{})
+	result := []*shardOrder{{Id: 1, Ctime: 2}, {Id: 2, Ctime: 3}, {Id: 3, Ctime: 2}, {Id: 4, Ctime: 1}}
+	orderbys := sqlc.M(&shardOrder{}).Orderby("a.ctime", sqlc.DESC_).Orderby("id", sqlc.ASC_).Orderbys
+	if err := sortShardResult(meta, orderbys, reflect.ValueOf(result)); err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]int64, 0, len(result))
+	for _, v := range result {
+		ids = append(ids, v.Id)
+	}
+	if !reflect.DeepEqual(ids, []int64{2, 1, 3, 4}) {
+		t.Errorf("unexpected sort result: %v", ids)
+	}
+}
+
+type liteShard struct {
+	Id     int64 `json:"id" bson:"_id" tb:"lite_shard"`
+	UserId int64 `json:"userId" bson:"userId" shard:"mod"`
+	Rank   int64 `json:"rank" bson:"rank"`
+}
+
+func TestSqliteShardFindList(t *testing.T) {
+	db := newSqliteManager(t)
+	defer db.Close()
+	if err := RegShardRule(&liteShard{}, ShardRule{Tables: 2}); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"lite_shard_0", "lite_shard_1"} {
+		if _, err := db.ExecSQL("create table if not exists "+table+" (id integer not null primary key, userId bigint null, rank bigint null)", nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.ExecSQL("delete from "+table, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := int64(1); i <= 5; i++ {
+		if err := db.Save(&liteShard{UserId: i, Rank: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	find := func(pagination dialect.Dialect) ([]*liteShard, *sqlc.Cnd) {
+		cnd := sqlc.M(&liteShard{}).Orderby("rank", sqlc.ASC_)
+		cnd.Pagination = pagination
+		result := make([]*liteShard, 0)
+		if err := db.FindList(cnd, &result); err != nil {
+			t.Fatal(err)
+		}
+		return result, cnd
+	}
+	// 页码为0时按首页查询
+	if result, cnd := find(dialect.Dialect{PageNo: 0, PageSize: 2}); len(result) != 2 || result[0].Rank != 1 || result[1].Rank != 2 || cnd.Pagination.PageTotal != 5 {
+		t.Errorf("unexpected first page: %d %+v", len(result), cnd.Pagination)
+	}
+	if result, cnd := find(dialect.Dialect{PageNo: 3, PageSize: 2}); len(result) != 1 || result[0].Rank != 5 || cnd.Pagination.PageCount != 3 {
+		t.Errorf("unexpected last page: %d %+v", len(result), cnd.Pagination)
+	}
+	if result, _ := find(dialect.Dialect{PageNo: 10, PageSize: 2}); len(result) != 0 {
+		t.Errorf("expected empty page past the end: %d", len(result))
+	}
+	if result, _ := find(dialect.Dialect{PageNo: -1, PageSize: 2, IsOffset: true}); len(result) != 2 || result[0].Rank != 1 {
+		t.Errorf("unexpected negative offset result: %d", len(result))
+	}
+}
+
+type liteShardDs struct {
+	Id     int64 `json:"id" bson:"_id" tb:"lite_shard_ds"`
+	UserId int64 `json:"userId" bson:"userId" shard:"mod"`
+}
+
+func TestSqliteShardTx(t *testing.T) {
+	db := newSqliteManager(t)
+	defer db.Close()
+	if err := RegShardRule(&liteShard{}, ShardRule{Tables: 2}); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"lite_shard_0", "lite_shard_1"} {
+		if _, err := db.ExecSQL("create table if not exists "+table+" (id integer not null primary key, userId bigint null, rank bigint null)", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count := func() int64 {
+		total, err := db.Count(sqlc.M(&liteShard{}).Eq("rank", 100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return total
+	}
+	// 当前数据源分片加入事务,回滚后不保留
+	err := db.WithTx(func(tx *RDBManager) error {
+		if err := tx.Save(&liteShard{UserId: 1, Rank: 100}, &liteShard{UserId: 2, Rank: 100}); err != nil {
+			return err
+		}
+		if total, err := tx.Count(sqlc.M(&liteShard{}).Eq("rank", 100)); err != nil || total != 2 {
+			t.Errorf("unexpected count in tx: %d %v", total, err)
+		}
+		return util.Error("rollback")
+	})
+	if err == nil || err.Error() != "rollback" {
+		t.Fatal(err)
+	}
+	if total := count(); total != 0 {
+		t.Errorf("expected shard writes rolled back: %d", total)
+	}
+	if len(db.shards) != 0 || len(db.shardTable) != 0 {
+		t.Errorf("unexpected shard state: %v %s", db.shards, db.shardTable)
+	}
+	// 事务中不支持写入其他数据源分片
+	if err := RegShardRule(&liteShardDs{}, ShardRule{DsNames: []string{"SQLITE_OTHER"}}); err != nil {
+		t.Fatal(err)
+	}
+	err = db.WithTx(func(tx *RDBManager) error {
+		return tx.Save(&liteShardDs{UserId: 1})
+	})
+	if err == nil {
+		t.Error("expected cross data source shard write rejected in transaction")
+	}
+}
@@ -0,0 +1,97 @@
+package sqld
+
+import (
+	"bytes"
+	"github.com/godaddy-x/jorm/sqlc"
+	"github.com/godaddy-x/jorm/util"
+	"reflect"
+	"strings"
+)
+
+/********************************** 逻辑删除实现 **********************************/
+
+// 获取逻辑删除字段(softdelete:"true"),仅支持整数类型,字段值为0表示未删除
+func getSoftDeleteField(model interface{}) (*FieldMeta, bool) {
+	if model == nil {
+		return nil, false
+	}
+	meta, err := GetModelMeta(model)
+	if err != nil || meta.SoftDelete == nil {
+		return nil, false
+	}
+	return meta.SoftDelete, true
+}
+
+// 逻辑删除标记值,int64类型为删除时间戳,其他整数类型为1
+func softDeleteValue(field *FieldMeta) int64 {
+	if field.Kind == reflect.Int64 {
+		return util.Time()
+	}
+	return 1
+}
+
+// 逻辑删除字段条件名称,复杂查询时使用主表别名
+func softDeleteKey(cnd *sqlc.Cnd, name string) string {
+	if from := strings.Fields(cnd.FromCond.Table); len(from) > 0 {
+		return util.AddStr(from[len(from)-1], ".", name)
+	}
+	return name
+}
+
+// 物理删除数据,忽略逻辑删除字段
+func (self *RDBManager) ForceDelete(datas ...interface{}) error {
+	if datas == nil || len(datas) == 0 {
+		return self.Error("参数列表不能为空")
+	}
+	if router := self.getShardRouter(datas[0]); router != nil {
+		return self.shardExec(router, datas, true, func(db *RDBManager, datas []interface{}) error {
+			return db.ForceDelete(datas...)
+		})
+	}
+	if err := runHooks(self, beforeDelete, datas...); err != nil {
+		return err
+	}
+	ids := make([]interface{}, 0, len(datas))
+	for e := range datas {
+		data := datas[e]
+		if data == nil {
+			return self.Error("参数元素不能为空")
+		}
+		if reflect.ValueOf(data).Kind() != reflect.Ptr {
+			return self.Error("参数值必须为指针类型")
+		}
+		if reflect.TypeOf(data) != reflect.TypeOf(datas[0]) {
+			return self.Error("参数列表对象类型必须一致")
+		}
+		if vid := getDataID(data); vid <= 0 {
+			return self.Error("对象ID值不能为空")
+		} else {
+			ids = append(ids, vid)
+		}
+	}
+	if err := self.deleteByIDs("ForceDelete", datas[0], ids, true); err != nil {
+		return err
+	}
+	if err := runHooks(self, afterDelete, datas...); err != nil {
+		return err
+	}
+	return self.AddCacheDelCnd(sqlc.M(datas[0]).In(sqlc.BsonId, ids...).Unscoped())
+}
+
+// 按条件逻辑删除数据
+func (self *RDBManager) softDeleteByCnd(cnd *sqlc.Cnd, field *FieldMeta, part bytes.Buffer, valuePart []interface{}, start int64) error {
+	s := part.String()
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString("update ")
+	if tb, err := self.tableName(cnd.Model); err != nil {
+		return self.Error(err)
+	} else {
+		sqlbuf.WriteString(self.quote(tb))
+	}
+	sqlbuf.WriteString(" set ")
+	sqlbuf.WriteString(self.quote(field.Column))
+	sqlbuf.WriteString(" = ? where")
+	sqlbuf.WriteString(util.Substr(s, 0, len(s)-3))
+	valuePart = append([]interface{}{softDeleteValue(field)}, valuePart...)
+	return self.exec(self.invocation("DeleteByCnd", cnd.Model, sqlbuf.String(), valuePart, start), "逻辑删除数据失败: ", nil)
+}
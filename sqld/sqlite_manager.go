@@ -0,0 +1,80 @@
+package sqld
+
+import (
+	"database/sql"
+	"github.com/godaddy-x/jorm/cache"
+	"github.com/godaddy-x/jorm/util"
+	_ "github.com/mattn/go-sqlite3"
+	"time"
+)
+
+// sqlite配置参数,Database为数据库文件路径,:memory:为进程内存数据库
+type SqliteConfig struct {
+	DBConfig
+	MaxIdleConns    int
+	MaxOpenConns    int
+	ConnMaxLifetime int
+}
+
+// sqlite连接管理器
+type SqliteManager struct {
+	RDBManager
+}
+
+func (self *SqliteManager) Get(option ...Option) (*SqliteManager, error) {
+	if option != nil && len(option) > 0 {
+		if err := self.GetDB(option[0]); err != nil {
+			return nil, err
+		}
+		return self, nil
+	} else {
+		if err := self.GetDB(); err != nil {
+			return nil, err
+		}
+		return self, nil
+	}
+}
+
+func (self *SqliteManager) InitConfig(input ...SqliteConfig) error {
+	return self.buildByConfig(nil, input...)
+}
+
+func (self *SqliteManager) InitConfigAndCache(manager cache.ICache, input ...SqliteConfig) error {
+	return self.buildByConfig(manager, input...)
+}
+
+func (self *SqliteManager) buildByConfig(manager cache.ICache, input ...SqliteConfig) error {
+	for _, conf := range input {
+		if len(conf.Database) == 0 {
+			return util.Error("sqlite数据库文件路径不能为空")
+		}
+		buildRDB(SQLITE, conf.DBConfig, manager, conf.open)
+	}
+	if len(rdbs) == 0 {
+		panic("sqlite连接初始化失败: 数据源为0")
+	}
+	return nil
+}
+
+// 按配置创建sqlite连接池,内存数据库按数据源名称共享缓存,连接全部关闭后数据丢失
+func (self *SqliteConfig) open(host string, port int, username, password string) *sql.DB {
+	link := util.AddStr("file:", self.Database, "?_busy_timeout=5000")
+	if self.Database == ":memory:" {
+		ds := self.DsName
+		if len(ds) == 0 {
+			ds = MASTER
+		}
+		link = util.AddStr("file:", ds, "?mode=memory&cache=shared&_busy_timeout=5000")
+	}
+	db, err := sql.Open(SQLITE, link)
+	if err != nil {
+		panic(util.AddStr("sqlite初始化失败: ", err.Error()))
+	}
+	// 空闲连接数为0时内存数据库随连接释放而清空
+	if self.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(self.MaxIdleConns)
+	}
+	db.SetMaxOpenConns(self.MaxOpenConns)
+	db.SetConnMaxLifetime(time.Second * time.Duration(self.ConnMaxLifetime))
+	return db
+}
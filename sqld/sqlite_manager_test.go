@@ -0,0 +1,260 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/jorm/dialect"
+	"github.com/godaddy-x/jorm/sqlc"
+	"github.com/godaddy-x/jorm/util"
+	"reflect"
+	"testing"
+)
+
+type liteWallet struct {
+	Id       int64  `json:"id" bson:"_id" tb:"lite_wallet"`
+	AppID    string `json:"appID" bson:"appID" size:"64" index:"true"`
+	WalletID string `json:"walletID" bson:"walletID" size:"64" unique:"true"`
+	Balance  int64  `json:"balance" bson:"balance"`
+	Applied  int64  `json:"applied" bson:"applied" date:"true"`
+	Trust    bool   `json:"trust" bson:"trust"`
+}
+
+func newSqliteManager(t *testing.T) *SqliteManager {
+	if _, ok := rdbs["SQLITE_TEST"]; !ok {
+		if err := new(SqliteManager).InitConfig(SqliteConfig{DBConfig: DBConfig{Database: ":memory:", DsName: "SQLITE_TEST"}, MaxIdleConns: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := new(SqliteManager).Get(Option{DsName: "SQLITE_TEST"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSqliteCreateTable(t *testing.T) {
+	stmts, err := (&RDBManager{Driver: SQLITE}).BuildCreateTable(&ddlWallet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"create table if not exists \"ddl_wallet\" (\n" +
+			"  \"id\" integer not null,\n" +
+			"  \"appID\" varchar(64) null,\n" +
+			"  \"walletID\" varchar(64) null,\n" +
+			"  \"balance\" decimal(20,8) null,\n" +
+			"  \"applied\" text null,\n" +
+			"  \"trust\" boolean null,\n" +
+			"  \"tags\" text null,\n" +
+			"  \"remark\" varchar(255) null,\n" +
+			"  primary key (\"id\")\n" +
+			")",
+		"create index \"idx_app_wallet\" on \"ddl_wallet\" (\"appID\", \"walletID\")",
+		"create unique index \"uk_ddl_wallet_walletID\" on \"ddl_wallet\" (\"walletID\")",
+	}
+	if !reflect.DeepEqual(stmts, expected) {
+		t.Errorf("unexpected ddl:\n%v", stmts)
+	}
+}
+
+func TestSqliteManager(t *testing.T) {
+	db := newSqliteManager(t)
+	defer db.Close()
+	if err := db.AutoMigrate(&liteWallet{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&liteWallet{}); err != nil {
+		t.Fatal("repeated migrate: ", err)
+	}
+	applied := int64(1700000000000)
+	wallets := []interface{}{
+		&liteWallet{AppID: "app", WalletID: "w1", Balance: 10, Applied: applied, Trust: true},
+		&liteWallet{AppID: "app", WalletID: "w2", Balance: 20, Applied: applied},
+		&liteWallet{AppID: "other", WalletID: "w3", Balance: 30, Applied: applied},
+	}
+	if err := db.Save(wallets...); err != nil {
+		t.Fatal(err)
+	}
+	first := wallets[0].(*liteWallet)
+	if first.Id <= 0 || wallets[2].(*liteWallet).Id != first.Id+2 {
+		t.Fatalf("unexpected generated ids: %d %d", first.Id, wallets[2].(*liteWallet).Id)
+	}
+	found := &liteWallet{Id: first.Id}
+	if err := db.FindById(found); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(found, first) {
+		t.Errorf("unexpected found wallet: %+v", found)
+	}
+	first.Balance = 15
+	if err := db.Update(first); err != nil {
+		t.Fatal(err)
+	}
+	result := make([]*liteWallet, 0)
+	if err := db.FindList(sqlc.M(&liteWallet{}).Eq("appID", "app").Like("walletID", "w").Orderby("id", sqlc.DESC_).Limit(1, 1), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[0].WalletID != "w2" {
+		t.Errorf("unexpected page result: %+v", result)
+	}
+	if total, err := db.Count(sqlc.M(&liteWallet{}).Gte("balance", 15)); err != nil || total != 3 {
+		t.Errorf("unexpected count: %d %v", total, err)
+	}
+	if err := db.Upsert(&liteWallet{Id: first.Id, AppID: "app", WalletID: "w1", Balance: 99, Applied: applied}); err != nil {
+		t.Fatal(err)
+	}
+	var balance int64
+	if err := db.FindBySQL("select balance from lite_wallet where walletID = :walletID", map[string]interface{}{"walletID": "w1"}, &balance); err != nil || balance != 99 {
+		t.Errorf("unexpected upsert balance: %d %v", balance, err)
+	}
+	page := &dialect.Dialect{PageNo: 1, PageSize: 2}
+	raws := make([]*liteWallet, 0)
+	if err := db.FindBySQL("select * from lite_wallet order by id", nil, &raws, page); err != nil {
+		t.Fatal(err)
+	}
+	if len(raws) != 2 || page.PageTotal != 3 || page.PageCount != 2 {
+		t.Errorf("unexpected sql page: %d %+v", len(raws), page)
+	}
+	if err := db.Delete(first); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.ExecSQL("delete from lite_wallet where appID = ?", []interface{}{"app"}); err != nil || n != 1 {
+		t.Errorf("unexpected exec result: %d %v", n, err)
+	}
+	if total, err := db.Count(sqlc.M(&liteWallet{})); err != nil || total != 1 {
+		t.Errorf("unexpected remaining count: %d %v", total, err)
+	}
+}
+
+type liteVersion struct {
+	Id      int64  `json:"id" bson:"_id" tb:"lite_version"`
+	Name    string `json:"name" bson:"name"`
+	Version int64  `json:"version" bson:"version" version:"true"`
+}
+
+func TestSqliteVersion(t *testing.T) {
+	db := newSqliteManager(t)
+	defer db.Close()
+	if err := db.AutoMigrate(&liteVersion{}); err != nil {
+		t.Fatal(err)
+	}
+	data := &liteVersion{Name: "a"}
+	if err := db.Save(data); err != nil {
+		t.Fatal(err)
+	}
+	stale := &liteVersion{Id: data.Id, Name: "stale", Version: data.Version}
+	data.Name = "b"
+	if err := db.Update(data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Version != 1 {
+		t.Errorf("unexpected version: %d", data.Version)
+	}
+	if err := db.Update(stale); err != ErrStaleObject {
+		t.Errorf("expected stale object error: %v", err)
+	}
+	found := &liteVersion{Id: data.Id}
+	if err := db.FindById(found); err != nil {
+		t.Fatal(err)
+	}
+	if found.Name != "b" || found.Version != 1 {
+		t.Errorf("unexpected updated data: %+v", found)
+	}
+}
+
+type litePage struct {
+	Id   int64  `json:"id" bson:"_id" tb:"lite_page"`
+	Name string `json:"name" bson:"name"`
+	Rank int64  `json:"rank" bson:"rank"`
+}
+
+// 行号分页方言在结果中追加rownum_列,按列名解析结果
+func TestSqliteRowNumberDialect(t *testing.T) {
+	db := newSqliteManager(t)
+	defer db.Close()
+	if err := db.AutoMigrate(&litePage{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteByCnd(sqlc.M(&litePage{}).Gte("id", 0)); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 5; i++ {
+		if err := db.Save(&litePage{Name: util.AnyToStr(i), Rank: i * 10}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer dialect.RegDialect(SQLITE, func(p dialect.Dialect) dialect.IDialect { return &dialect.SqliteDialect{Dialect: p} })
+	creators := map[string]dialect.Creator{
+		// SQL Server 2005行号列在首列
+		"mssql2005": func(p dialect.Dialect) dialect.IDialect { return &dialect.SQLServer2005{Dialect: p} },
+		// 与Oracle ROWNUM分页一致,行号列在末列
+		"oracle": func(p dialect.Dialect) dialect.IDialect {
+			return &trailingRownum{SqliteDialect: dialect.SqliteDialect{Dialect: p}}
+		},
+	}
+	for name, creator := range creators {
+		if err := dialect.RegDialect(SQLITE, creator); err != nil {
+			t.Fatal(err)
+		}
+		list := make([]*litePage, 0)
+		if err := db.FindList(sqlc.M(&litePage{}).Orderby("id", sqlc.ASC_).Limit(2, 2), &list); err != nil {
+			t.Fatal(name, err)
+		}
+		if len(list) != 2 || list[0].Id == 0 || list[0].Name != "3" || list[0].Rank != 30 || list[1].Rank != 40 {
+			t.Errorf("unexpected [%s] list: %+v %+v", name, list[0], list[len(list)-1])
+		}
+		one := litePage{}
+		if err := db.FindOne(sqlc.M(&litePage{}).Eq("name", "5"), &one); err != nil {
+			t.Fatal(name, err)
+		}
+		if one.Id != list[1].Id+1 || one.Name != "5" || one.Rank != 50 {
+			t.Errorf("unexpected [%s] one: %+v", name, one)
+		}
+	}
+}
+
+type trailingRownum struct {
+	dialect.SqliteDialect
+}
+
+func (self *trailingRownum) GetLimitSql(sql string) (string, error) {
+	limitSql, err := self.SqliteDialect.GetLimitSql(sql)
+	if err != nil {
+		return "", err
+	}
+	return "select cba1.*, 0 rownum_ from (" + limitSql + ") cba1", nil
+}
+
+func TestSqliteBatchSave(t *testing.T) {
+	newSqliteManager(t).Close()
+	db, err := new(SqliteManager).Get(Option{DsName: "SQLITE_TEST", BatchSave: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.AutoMigrate(&litePage{}); err != nil {
+		t.Fatal(err)
+	}
+	// 每行2个占位符,按占位符数量拆分为多条语句
+	limit := BatchMaxArgs[SQLITE]
+	BatchMaxArgs[SQLITE] = 4
+	defer func() { BatchMaxArgs[SQLITE] = limit }()
+	datas := make([]interface{}, 0, 5)
+	for i := 0; i < 5; i++ {
+		datas = append(datas, &litePage{Name: util.AnyToStr(i), Rank: int64(i)})
+	}
+	if err := db.Save(datas...); err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range datas {
+		saved := data.(*litePage)
+		found := &litePage{Id: saved.Id}
+		if err := db.FindById(found); err != nil {
+			t.Fatal(err)
+		}
+		if saved.Id == 0 || found.Name != saved.Name || found.Rank != saved.Rank {
+			t.Errorf("unexpected batch id: %+v -> %+v", saved, found)
+		}
+	}
+	if err := db.DeleteByCnd(sqlc.M(&litePage{}).Gte("id", datas[0].(*litePage).Id)); err != nil {
+		t.Fatal(err)
+	}
+}
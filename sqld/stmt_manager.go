@@ -0,0 +1,189 @@
+package sqld
+
+import (
+	"container/list"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+/********************************** 预编译语句缓存实现 **********************************/
+
+// 预编译语句默认缓存数量
+const defaultStmtCacheSize = 256
+
+// 预编译语句缓存统计
+type StmtStats struct {
+	Hits      int64 // 命中次数
+	Misses    int64 // 未命中次数
+	Evictions int64 // 淘汰次数,包含容量淘汰及连接异常失效
+	Size      int   // 当前缓存数量
+}
+
+// 缓存键,主库及从库连接池分别预编译
+type stmtKey struct {
+	db    *sql.DB
+	query string
+}
+
+type stmtEntry struct {
+	key     stmtKey
+	stmt    *sql.Stmt
+	refs    int  // 使用中的引用数,淘汰后引用归零时关闭
+	evicted bool // 是否已移出缓存
+}
+
+// 预编译语句LRU缓存,同一数据源的管理器共享
+type stmtCache struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[stmtKey]*list.Element
+	lru      *list.List
+	stats    StmtStats
+}
+
+// 创建预编译语句缓存,size为0时使用默认数量,小于0时不缓存
+func newStmtCache(size int) *stmtCache {
+	if size < 0 {
+		return nil
+	}
+	if size == 0 {
+		size = defaultStmtCacheSize
+	}
+	return &stmtCache{capacity: size, items: make(map[stmtKey]*list.Element, size), lru: list.New()}
+}
+
+// 获取缓存语句并增加引用,未命中时返回nil
+func (self *stmtCache) get(key stmtKey) *stmtEntry {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if elem, ok := self.items[key]; ok {
+		entry := elem.Value.(*stmtEntry)
+		entry.refs++
+		self.lru.MoveToFront(elem)
+		self.stats.Hits++
+		return entry
+	}
+	self.stats.Misses++
+	return nil
+}
+
+// 获取预编译语句,未命中时预编译并加入缓存,超出容量时淘汰最久未使用的语句
+func (self *stmtCache) acquire(db *sql.DB, query string, prepare func() (*sql.Stmt, error)) (*stmtEntry, error) {
+	key := stmtKey{db: db, query: query}
+	if entry := self.get(key); entry != nil {
+		return entry, nil
+	}
+	// 预编译期间不持有锁,并发预编译同一语句时保留先加入缓存的语句
+	stmt, err := prepare()
+	if err != nil {
+		return nil, err
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if elem, ok := self.items[key]; ok {
+		stmt.Close()
+		entry := elem.Value.(*stmtEntry)
+		entry.refs++
+		self.lru.MoveToFront(elem)
+		return entry, nil
+	}
+	entry := &stmtEntry{key: key, stmt: stmt, refs: 1}
+	self.items[key] = self.lru.PushFront(entry)
+	for self.lru.Len() > self.capacity {
+		self.evict(self.lru.Back().Value.(*stmtEntry))
+	}
+	return entry, nil
+}
+
+// 释放语句引用,执行异常为连接异常时使缓存失效
+func (self *stmtCache) release(entry *stmtEntry, err error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	entry.refs--
+	if isConnError(err) && !entry.evicted {
+		self.evict(entry)
+	} else if entry.evicted && entry.refs == 0 {
+		entry.stmt.Close()
+	}
+}
+
+// 移出缓存,无引用时立即关闭,否则由最后一个引用释放时关闭
+func (self *stmtCache) evict(entry *stmtEntry) {
+	if elem, ok := self.items[entry.key]; ok && elem.Value == entry {
+		self.lru.Remove(elem)
+		delete(self.items, entry.key)
+	}
+	entry.evicted = true
+	self.stats.Evictions++
+	if entry.refs == 0 {
+		entry.stmt.Close()
+	}
+}
+
+func (self *stmtCache) snapshot() StmtStats {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	stats := self.stats
+	stats.Size = self.lru.Len()
+	return stats
+}
+
+// 是否连接异常,连接失效后缓存语句需重新预编译
+func isConnError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr)
+}
+
+// 获取预编译语句,release传入执行异常释放语句
+func (self *RDBManager) prepareStmt(db *sql.DB, query string) (*sql.Stmt, func(err error), error) {
+	prepare := func() (*sql.Stmt, error) {
+		return db.PrepareContext(self.getContext(), query)
+	}
+	if self.stmts == nil {
+		stmt, err := prepare()
+		if err != nil {
+			return nil, nil, err
+		}
+		return stmt, func(error) { stmt.Close() }, nil
+	}
+	entry, err := self.stmts.acquire(db, query, prepare)
+	if err != nil {
+		return nil, nil, err
+	}
+	return entry.stmt, func(err error) { self.stmts.release(entry, err) }, nil
+}
+
+// 获取事务预编译语句,命中缓存时通过tx.Stmt绑定到事务连接,未命中时在事务连接上预编译且不缓存,
+// 避免事务占用连接时另取连接预编译
+func (self *RDBManager) prepareTx(query string) (*sql.Stmt, func(err error), error) {
+	if self.stmts != nil {
+		if entry := self.stmts.get(stmtKey{db: self.Db, query: query}); entry != nil {
+			stmt := self.Tx.StmtContext(self.getContext(), entry.stmt)
+			return stmt, func(err error) {
+				stmt.Close()
+				self.stmts.release(entry, err)
+			}, nil
+		}
+	}
+	stmt, err := self.Tx.PrepareContext(self.getContext(), query)
+	if err != nil {
+		return nil, nil, err
+	}
+	return stmt, func(error) { stmt.Close() }, nil
+}
+
+// 预编译语句缓存统计,未启用缓存时返回零值
+func (self *RDBManager) StmtStats() StmtStats {
+	if self.stmts == nil {
+		return StmtStats{}
+	}
+	return self.stmts.snapshot()
+}
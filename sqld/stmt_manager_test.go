@@ -0,0 +1,158 @@
+package sqld
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"github.com/godaddy-x/jorm/sqlc"
+	"github.com/godaddy-x/jorm/util"
+	"io"
+	"testing"
+)
+
+func TestStmtCacheLRU(t *testing.T) {
+	db := newSqliteManager(t)
+	defer db.Close()
+	cache := newStmtCache(2)
+	prepare := func(query string) *stmtEntry {
+		entry, err := cache.acquire(db.Db, query, func() (*sql.Stmt, error) {
+			return db.Db.Prepare(query)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entry
+	}
+	a := prepare("select 1")
+	cache.release(a, nil)
+	b := prepare("select 2")
+	cache.release(b, nil)
+	if prepare("select 1") != a {
+		t.Error("expected cached statement")
+	}
+	cache.release(a, nil)
+	// 容量为2,淘汰最久未使用的select 2
+	c := prepare("select 3")
+	if !b.evicted || a.evicted {
+		t.Error("expected least recently used statement evicted")
+	}
+	// 使用中的语句淘汰后延迟关闭,仍可执行
+	cache.release(prepare("select 1"), nil)
+	cache.release(prepare("select 4"), nil)
+	if !c.evicted {
+		t.Error("expected in-use statement evicted")
+	}
+	var n int
+	if err := c.stmt.QueryRow().Scan(&n); err != nil || n != 3 {
+		t.Errorf("expected evicted statement usable until released: %d %v", n, err)
+	}
+	cache.release(c, nil)
+	if err := c.stmt.QueryRow().Scan(&n); err == nil {
+		t.Error("expected statement closed after release")
+	}
+	// 连接异常时失效
+	a = prepare("select 1")
+	cache.release(a, driver.ErrBadConn)
+	if !a.evicted || cache.items[a.key] != nil {
+		t.Error("expected statement invalidated on connection error")
+	}
+	if stats := cache.snapshot(); stats.Hits != 3 || stats.Misses != 4 || stats.Evictions != 3 || stats.Size != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if newStmtCache(-1) != nil || newStmtCache(0).capacity != defaultStmtCacheSize {
+		t.Error("unexpected cache size")
+	}
+}
+
+func TestSqliteStmtCache(t *testing.T) {
+	db := newSqliteManager(t)
+	defer db.Close()
+	if err := db.AutoMigrate(&liteWallet{}); err != nil {
+		t.Fatal(err)
+	}
+	before := db.StmtStats()
+	for i := 0; i < 3; i++ {
+		if _, err := db.Count(sqlc.M(&liteWallet{}).Eq("appID", "stmt")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	after := db.StmtStats()
+	if after.Hits-before.Hits < 2 || after.Size == 0 {
+		t.Errorf("expected statement reused: %+v -> %+v", before, after)
+	}
+	// 事务中命中的缓存语句绑定到事务连接
+	err := db.WithTx(func(tx *RDBManager) error {
+		if err := tx.Save(&liteWallet{AppID: "stmt", WalletID: "stmt-1"}); err != nil {
+			return err
+		}
+		total, err := tx.Count(sqlc.M(&liteWallet{}).Eq("appID", "stmt"))
+		if err != nil {
+			return err
+		}
+		if total != 1 {
+			t.Errorf("unexpected count in tx: %d", total)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.StmtStats().Hits <= after.Hits {
+		t.Error("expected cached statement used in transaction")
+	}
+	if err := db.DeleteByCnd(sqlc.M(&liteWallet{}).Eq("appID", "stmt")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 遍历结果时返回连接异常的测试驱动
+type brokenDriver struct{}
+type brokenConn struct{}
+type brokenStmt struct{}
+type brokenRows struct{}
+
+func (brokenDriver) Open(name string) (driver.Conn, error)         { return brokenConn{}, nil }
+func (brokenConn) Prepare(query string) (driver.Stmt, error)       { return brokenStmt{}, nil }
+func (brokenConn) Close() error                                    { return nil }
+func (brokenConn) Begin() (driver.Tx, error)                       { return nil, driver.ErrSkip }
+func (brokenStmt) Close() error                                    { return nil }
+func (brokenStmt) NumInput() int                                   { return -1 }
+func (brokenStmt) Exec(args []driver.Value) (driver.Result, error) { return nil, driver.ErrSkip }
+func (brokenStmt) Query(args []driver.Value) (driver.Rows, error)  { return brokenRows{}, nil }
+func (brokenRows) Columns() []string                               { return []string{"id"} }
+func (brokenRows) Close() error                                    { return nil }
+func (brokenRows) Next(dest []driver.Value) error                  { return io.ErrUnexpectedEOF }
+
+func TestStmtCacheQueryConnError(t *testing.T) {
+	sql.Register("jorm_broken", brokenDriver{})
+	conn, err := sql.Open("jorm_broken", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	db := &RDBManager{Db: conn, stmts: newStmtCache(0)}
+	inv := &Invocation{Op: "FindList", SQL: "select id from t"}
+	err = db.query(inv, false, func(rows *sql.Rows) error {
+		if _, err := EchoResultRows(rows, 1); err != nil {
+			return util.Error("读取查询结果失败: ", err.Error())
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected query error")
+	}
+	if stats := db.StmtStats(); stats.Evictions != 1 || stats.Size != 0 {
+		t.Errorf("expected statement evicted on connection error: %+v", stats)
+	}
+	cursor, err := db.FindCursor(sqlc.M(&cacheWallet{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for cursor.Next(&cacheWallet{}) {
+	}
+	if cursor.Close() == nil {
+		t.Error("expected cursor error")
+	}
+	if stats := db.StmtStats(); stats.Evictions != 2 || stats.Size != 0 {
+		t.Errorf("expected cursor statement evicted on connection error: %+v", stats)
+	}
+}
@@ -0,0 +1,157 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/jorm/sqlc"
+	"github.com/godaddy-x/jorm/util"
+)
+
+/********************************** 关系数据库事务实现 **********************************/
+
+// 事务保存点,记录开启时的异常和缓存同步对象位置,回滚时据此恢复
+type savepoint struct {
+	errors      int
+	cacheObject int
+	cacheDelete int
+	cacheDelCnd int
+	cacheUpsert int
+	cacheUpsCnd int
+	cacheCnd    *sqlc.Cnd
+}
+
+// 开启事务,已存在事务时创建保存点(SAVEPOINT)
+func (self *RDBManager) Begin() error {
+	if self.Db == nil {
+		return self.Error("数据库连接尚未初始化,请先调用GetDB")
+	}
+	if self.Tx == nil {
+		tx, err := self.Db.BeginTx(self.getContext(), nil)
+		if err != nil {
+			return self.ctxError(err, "数据库开启事务失败: ")
+		}
+		self.Tx = tx
+		self.AutoTx = true
+		self.savepoints = []savepoint{self.savepoint()}
+		return nil
+	}
+	name := util.AddStr("sp", len(self.savepoints))
+	if _, err := self.Tx.ExecContext(self.getContext(), util.AddStr("savepoint ", name)); err != nil {
+		return self.ctxError(err, "创建事务保存点[", name, "]失败: ")
+	}
+	self.savepoints = append(self.savepoints, self.savepoint())
+	return nil
+}
+
+// 提交事务,嵌套事务时释放当前保存点
+func (self *RDBManager) Commit() error {
+	if self.Tx == nil {
+		return self.Error("事务尚未开启")
+	}
+	if len(self.savepoints) > 1 {
+		name := util.AddStr("sp", len(self.savepoints)-1)
+		if _, err := self.Tx.ExecContext(self.getContext(), util.AddStr("release savepoint ", name)); err != nil {
+			return self.ctxError(err, "释放事务保存点[", name, "]失败: ")
+		}
+		self.savepoints = self.savepoints[:len(self.savepoints)-1]
+		return nil
+	}
+	tx := self.Tx
+	tables := self.cacheTables
+	self.endTx()
+	if err := tx.Commit(); err != nil {
+		return self.ctxError(err, "事务提交失败: ")
+	}
+	for _, table := range tables {
+		self.expireTable(table)
+	}
+	return nil
+}
+
+// 回滚事务,嵌套事务时回滚到当前保存点
+func (self *RDBManager) Rollback() error {
+	if self.Tx == nil {
+		return self.Error("事务尚未开启")
+	}
+	sp := self.savepoints[len(self.savepoints)-1]
+	if len(self.savepoints) > 1 {
+		name := util.AddStr("sp", len(self.savepoints)-1)
+		if _, err := self.Tx.ExecContext(self.getContext(), util.AddStr("rollback to savepoint ", name)); err != nil {
+			return self.ctxError(err, "回滚事务保存点[", name, "]失败: ")
+		}
+		self.savepoints = self.savepoints[:len(self.savepoints)-1]
+		self.restore(sp)
+		return nil
+	}
+	tx := self.Tx
+	self.endTx()
+	sp.errors = len(self.Errors)
+	self.restore(sp)
+	if err := tx.Rollback(); err != nil {
+		return self.ctxError(err, "事务回滚失败: ")
+	}
+	return nil
+}
+
+// 在事务中执行函数,返回异常或发生panic时回滚,否则提交;已存在事务时以保存点嵌套执行
+func (self *RDBManager) WithTx(fn func(db *RDBManager) error) (err error) {
+	if err := self.Begin(); err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			self.Rollback()
+			panic(r)
+		}
+	}()
+	if err := fn(self); err != nil {
+		if rerr := self.Rollback(); rerr != nil {
+			return rerr
+		}
+		return err
+	}
+	return self.Commit()
+}
+
+// 获取数据源并在事务中执行函数,事务提交后同步缓存数据
+func WithTx(option Option, fn func(db *RDBManager) error) error {
+	option.AutoTx = false
+	db := &RDBManager{}
+	if err := db.GetDB(option); err != nil {
+		return err
+	}
+	if err := db.WithTx(fn); err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+// 当前事务保存点信息
+func (self *RDBManager) savepoint() savepoint {
+	return savepoint{
+		errors:      len(self.Errors),
+		cacheObject: len(self.CacheObject),
+		cacheDelete: len(self.CacheDelete),
+		cacheDelCnd: len(self.CacheDelCnd),
+		cacheUpsert: len(self.CacheUpsert),
+		cacheUpsCnd: len(self.CacheUpsCnd),
+		cacheCnd:    self.CacheCnd,
+	}
+}
+
+// 回滚后恢复异常和缓存同步对象,已回滚的操作不再同步
+func (self *RDBManager) restore(sp savepoint) {
+	self.Errors = self.Errors[:sp.errors]
+	self.CacheObject = self.CacheObject[:sp.cacheObject]
+	self.CacheDelete = self.CacheDelete[:sp.cacheDelete]
+	self.CacheDelCnd = self.CacheDelCnd[:sp.cacheDelCnd]
+	self.CacheUpsert = self.CacheUpsert[:sp.cacheUpsert]
+	self.CacheUpsCnd = self.CacheUpsCnd[:sp.cacheUpsCnd]
+	self.CacheCnd = sp.cacheCnd
+}
+
+// 结束事务
+func (self *RDBManager) endTx() {
+	self.Tx = nil
+	self.AutoTx = false
+	self.savepoints = nil
+	self.cacheTables = nil
+}
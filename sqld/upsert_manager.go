@@ -0,0 +1,235 @@
+package sqld
+
+import (
+	"bytes"
+	"database/sql"
+	"github.com/godaddy-x/jorm/sqlc"
+	"github.com/godaddy-x/jorm/util"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+/********************************** 关系数据库Upsert实现 **********************************/
+
+// 新增或更新数据,MySQL使用ON DUPLICATE KEY UPDATE,PostgreSQL/SQLite使用ON CONFLICT (id) DO UPDATE,PostgreSQL通过RETURNING回填ID
+// 冲突时更新UpsertFields指定字段,为空时更新全部非ID字段
+func (self *RDBManager) Upsert(datas ...interface{}) error {
+	if datas == nil || len(datas) == 0 {
+		return self.Error("参数列表不能为空")
+	}
+	if router := self.getShardRouter(datas[0]); router != nil {
+		return self.shardExec(router, datas, true, func(db *RDBManager, datas []interface{}) error {
+			return db.Upsert(datas...)
+		})
+	}
+	for e := range datas {
+		data := datas[e]
+		start := util.Time()
+		if data == nil {
+			return self.Error("参数元素不能为空")
+		}
+		if reflect.ValueOf(data).Kind() != reflect.Ptr {
+			return self.Error("参数值必须为指针类型")
+		}
+		setAutoTime(data, false)
+		columns, s2, valuePart, idValue, err := self.buildInsertPart(data, true)
+		if err != nil {
+			return self.Error(err)
+		}
+		tb, err := self.tableName(data)
+		if err != nil {
+			return self.Error(err)
+		}
+		fields := self.upsertFields(data, columns)
+		if len(fields) == 0 {
+			return self.Error("更新字段不能为空")
+		}
+		upsql, err := self.buildUpsertSql(tb, self.quoteColumns(columns), s2, []string{sqlc.BsonId}, fields)
+		if err != nil {
+			return self.Error(err)
+		}
+		if self.Driver == POSTGRES && idValue.IsValid() {
+			upsql = util.AddStr(upsql, " returning ", self.quote(sqlc.BsonId))
+			err = self.query(self.invocation("Upsert", data, upsql, valuePart, start), false, func(rows *sql.Rows) error {
+				if _, err := scanReturning(rows, []reflect.Value{idValue}); err != nil {
+					return self.ctxError(err, "新增或更新数据失败: ")
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err = self.exec(self.invocation("Upsert", data, upsql, valuePart, start), "新增或更新数据失败: ", func(ret sql.Result) error {
+			if self.Driver == MYSQL && idValue.IsValid() {
+				if lastInsertId, err := ret.LastInsertId(); err != nil {
+					return self.ctxError(err, "新增或更新数据失败: ")
+				} else if lastInsertId > 0 {
+					idValue.SetInt(lastInsertId)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return self.AddCacheUpsert(datas...)
+}
+
+// 按条件新增或更新数据,等值条件(Eq)为冲突键,UpdateKV为新增或更新字段
+func (self *RDBManager) UpsertByCnd(cnd *sqlc.Cnd) error {
+	start := util.Time()
+	if cnd == nil {
+		return self.Error("条件参数不能为空")
+	}
+	var elem = cnd.Model
+	if elem == nil {
+		return self.Error("ORM对象类型不能为空,请通过M(...)方法设置对象类型")
+	}
+	if len(cnd.UpdateKV) == 0 {
+		return self.Error("更新条件不能为空")
+	}
+	if router := self.getShardRouter(elem); router != nil {
+		return self.shardUpsertByCnd(router, cnd)
+	}
+	if err := self.checkIdents(cnd); err != nil {
+		return self.Error(err)
+	}
+	upsert := *cnd
+	upsert.UpdateKV = autoUpdateKV(elem, cnd.UpdateKV, true)
+	keys, fields, valuePart, err := buildUpsertCnd(&upsert)
+	if err != nil {
+		return self.Error(err)
+	}
+	columns := append(append([]string{}, keys...), fields...)
+	// 创建时间字段仅在新增时写入
+	now := util.Time()
+	for _, field := range getAutoTimeFields(elem, true) {
+		if name := field.Column; !util.CheckStr(name, columns...) {
+			columns = append(columns, name)
+			valuePart = append(valuePart, autoTimeValue(field, now, true))
+		}
+	}
+	if self.AutoID && !util.CheckStr(sqlc.BsonId, columns...) {
+		if valueID, err := util.StrToInt64(util.GetUUID(int64(self.Node))); err != nil {
+			return self.Error(err)
+		} else {
+			columns = append(columns, sqlc.BsonId)
+			valuePart = append(valuePart, valueID)
+		}
+	}
+	tb, err := self.tableName(elem)
+	if err != nil {
+		return self.Error(err)
+	}
+	holders := strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",")
+	upsql, err := self.buildUpsertSql(tb, self.quoteColumns(columns), holders, keys, fields)
+	if err != nil {
+		return self.Error(err)
+	}
+	if err := self.exec(self.invocation("UpsertByCnd", elem, upsql, valuePart, start), "新增或更新数据失败: ", nil); err != nil {
+		return err
+	}
+	return self.AddCacheUpsCnd(cnd)
+}
+
+// 获取冲突时需要更新的字段,ID和创建时间字段不更新
+func (self *RDBManager) upsertFields(data interface{}, columns []string) []string {
+	var ctimes []string
+	for _, field := range getAutoTimeFields(data, true) {
+		ctimes = append(ctimes, field.Column)
+	}
+	fields := make([]string, 0, len(columns))
+	for e := range columns {
+		if len(columns[e]) == 0 || columns[e] == sqlc.BsonId || util.CheckStr(columns[e], ctimes...) {
+			continue
+		}
+		if len(self.UpsertFields) > 0 && !util.CheckStr(columns[e], self.UpsertFields...) {
+			continue
+		}
+		fields = append(fields, columns[e])
+	}
+	return fields
+}
+
+// 构建新增或更新语句
+func (self *RDBManager) buildUpsertSql(tb, columns, holders string, keys, fields []string) (string, error) {
+	var sqlbuf bytes.Buffer
+	sqlbuf.WriteString("insert into ")
+	sqlbuf.WriteString(self.quote(tb))
+	sqlbuf.WriteString(" (")
+	sqlbuf.WriteString(columns)
+	sqlbuf.WriteString(") values (")
+	sqlbuf.WriteString(holders)
+	sqlbuf.WriteString(")")
+	switch self.Driver {
+	case MYSQL, "":
+		// id = last_insert_id(id) 使冲突更新时LastInsertId返回已存在记录ID
+		id := self.quote(sqlc.BsonId)
+		sqlbuf.WriteString(util.AddStr(" on duplicate key update ", id, " = last_insert_id(", id, ")"))
+		for e := range fields {
+			field := self.quote(fields[e])
+			sqlbuf.WriteString(", ")
+			sqlbuf.WriteString(field)
+			sqlbuf.WriteString(" = values(")
+			sqlbuf.WriteString(field)
+			sqlbuf.WriteString(")")
+		}
+	case POSTGRES, SQLITE:
+		sqlbuf.WriteString(" on conflict (")
+		for e := range keys {
+			if e > 0 {
+				sqlbuf.WriteString(",")
+			}
+			sqlbuf.WriteString(self.quote(keys[e]))
+		}
+		sqlbuf.WriteString(") do update set ")
+		for e := range fields {
+			field := self.quote(fields[e])
+			if e > 0 {
+				sqlbuf.WriteString(", ")
+			}
+			sqlbuf.WriteString(field)
+			sqlbuf.WriteString(" = excluded.")
+			sqlbuf.WriteString(field)
+		}
+	default:
+		return "", util.Error("数据库驱动[", self.Driver, "]不支持Upsert")
+	}
+	return sqlbuf.String(), nil
+}
+
+// 解析按条件新增或更新参数,返回冲突键,更新字段及对应参数值
+func buildUpsertCnd(cnd *sqlc.Cnd) ([]string, []string, []interface{}, error) {
+	keys := make([]string, 0, len(cnd.Conditions))
+	valuePart := make([]interface{}, 0, len(cnd.Conditions)+len(cnd.UpdateKV))
+	for e := range cnd.Conditions {
+		condit := cnd.Conditions[e]
+		if condit.Logic != sqlc.EQ_ {
+			return nil, nil, nil, util.Error("冲突键条件仅支持等值条件(Eq)")
+		}
+		keys = append(keys, condit.Key)
+		valuePart = append(valuePart, encodeArg(condit.Value))
+	}
+	if len(keys) == 0 {
+		return nil, nil, nil, util.Error("冲突键条件不能为空")
+	}
+	fields := make([]string, 0, len(cnd.UpdateKV))
+	for k := range cnd.UpdateKV {
+		if util.CheckStr(k, keys...) {
+			continue
+		}
+		fields = append(fields, k)
+	}
+	if len(fields) == 0 {
+		return nil, nil, nil, util.Error("更新字段不能为空")
+	}
+	sort.Strings(fields)
+	for e := range fields {
+		valuePart = append(valuePart, encodeArg(cnd.UpdateKV[fields[e]]))
+	}
+	return keys, fields, valuePart, nil
+}
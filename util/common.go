@@ -32,6 +32,7 @@ import (
 var (
 	cst_sh, _  = time.LoadLocation("Asia/Shanghai") //上海
 	time_formt = "2006-01-02 15:04:05"
+	date_formt = "2006-01-02 15:04:05.999999"
 	snowflakes = make(map[int64]*snowflake.Node, 0)
 	mu         sync.Mutex
 )
@@ -206,6 +207,22 @@ func Str2Time(s string) (int64, error) {
 	return Time(t), nil
 }
 
+// time转格式字符串,保留微秒
+func Date2Str(t time.Time) string {
+	return t.In(cst_sh).Format(date_formt)
+}
+
+// 格式字符串转time,支持yyyy-MM-dd HH:mm:ss[.ffffff],yyyy-MM-dd及RFC3339格式
+func Str2Date(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation(date_formt, s, cst_sh); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, cst_sh); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
 // 获取当前时间/纳秒
 func Nano() int64 {
 	return time.Now().In(cst_sh).UnixNano()
@@ -259,8 +276,7 @@ func GetLocalIP() string {
 		log.Println(err)
 		return ""
 	}
-	for _,
-	address := range addrs { // 检查ip地址判断是否回环地址
+	for _, address := range addrs { // 检查ip地址判断是否回环地址
 		if ipnet, ok := address.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
 			if ipnet.IP.To4() != nil {
 				return ipnet.IP.String()
@@ -472,10 +488,10 @@ func GetUUID(sec ...int64) string {
 	if sec != nil && len(sec) > 0 && sec[0] > 0 {
 		seed = sec[0]
 	}
-	node, ok := snowflakes[seed];
+	node, ok := snowflakes[seed]
 	if !ok || node == nil {
 		mu.Lock()
-		node, ok = snowflakes[seed];
+		node, ok = snowflakes[seed]
 		if !ok || node == nil {
 			node, _ = snowflake.NewNode(seed)
 			snowflakes[seed] = node
@@ -507,6 +523,38 @@ func ValidDate(field reflect.StructField) bool {
 	return false
 }
 
+// 校验是否乐观锁版本字段
+func ValidVersion(field reflect.StructField) bool {
+	if field.Tag.Get(sqlc.Version) == sqlc.True {
+		return true
+	}
+	return false
+}
+
+// 校验是否逻辑删除字段
+func ValidSoftDelete(field reflect.StructField) bool {
+	if field.Tag.Get(sqlc.SoftDelete) == sqlc.True {
+		return true
+	}
+	return false
+}
+
+// 校验是否自动创建时间字段
+func ValidAutoCreateTime(field reflect.StructField) bool {
+	if field.Tag.Get(sqlc.AutoCreateTime) == sqlc.True {
+		return true
+	}
+	return false
+}
+
+// 校验是否自动更新时间字段
+func ValidAutoUpdateTime(field reflect.StructField) bool {
+	if field.Tag.Get(sqlc.AutoUpdateTime) == sqlc.True {
+		return true
+	}
+	return false
+}
+
 // 读取文件
 func ReadFile(path string) (string, error) {
 	if len(path) == 0 {
@@ -543,7 +591,7 @@ func Pow(x, n int64) int64 {
 	return ret
 }
 
-//只用于计算10的n次方，转换string
+// 只用于计算10的n次方，转换string
 func PowString(n int) string {
 	target := "1"
 	for i := 0; i < n; i++ {
@@ -705,4 +753,4 @@ func CheckStr(c string, vs ...string) bool {
 		}
 	}
 	return false
-}
\ No newline at end of file
+}
@@ -121,7 +121,7 @@ func (self *HttpNode) InitContext(ob, output, input interface{}) error {
 	o.SessionManager = self.SessionManager
 	o.Output = w
 	o.Input = r
-	o.Context = &Context{Response: &Response{ContentEncoding: UTF8, ContentType: APPLICATION_JSON, TemplDir: self.TemplDir}}
+	o.Context = &Context{Response: &Response{ContentEncoding: UTF8, ContentType: APPLICATION_JSON, TemplDir: self.TemplDir}, Ctx: r.Context()}
 	if err := o.GetHeader(r); err != nil {
 		return err
 	}
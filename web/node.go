@@ -1,5 +1,7 @@
 package node
 
+import "context"
+
 const (
 	HTTP    = 0
 	WEBSOCK = 1
@@ -60,6 +62,7 @@ type Context struct {
 	Params     map[string]interface{}
 	Session    Session
 	Response   *Response
+	Ctx        context.Context // 请求上下文,请求取消时随之取消
 }
 
 type Response struct {